@@ -40,7 +40,8 @@ var doc = `{
                     "application/json"
                 ],
                 "produces": [
-                    "application/json"
+                    "application/json",
+                    "application/problem+json"
                 ],
                 "summary": "Return short URL info",
                 "parameters": [
@@ -62,13 +63,34 @@ var doc = `{
                         }
                     },
                     "400": {
-                        "description": "Payload cannot be decoded"
+                        "description": "Payload cannot be decoded",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
                     },
                     "404": {
-                        "description": "Key not found"
+                        "description": "Key not found",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests from the client, retry after the Retry-After header seconds",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
                     },
                     "500": {
-                        "description": "The server has encountered an unknown error"
+                        "description": "The server has encountered an unknown error",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    },
+                    "503": {
+                        "description": "The storage did not respond in time",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
                     }
                 }
             },
@@ -77,6 +99,9 @@ var doc = `{
                 "consumes": [
                     "application/json"
                 ],
+                "produces": [
+                    "application/problem+json"
+                ],
                 "summary": "Add short url",
                 "parameters": [
                     {
@@ -87,6 +112,12 @@ var doc = `{
                         "schema": {
                             "$ref": "#/definitions/routes.addURLRequestPayload"
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "API key identifying the owner of the link",
+                        "name": "X-API-Key",
+                        "in": "header"
                     }
                 ],
                 "responses": {
@@ -94,24 +125,63 @@ var doc = `{
                         "description": "Key-url association added"
                     },
                     "400": {
-                        "description": "Payload cannot be decoded"
+                        "description": "Payload cannot be decoded",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    },
+                    "401": {
+                        "description": "The API key is not valid",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    },
+                    "403": {
+                        "description": "The quota of the API key would be exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
                     },
                     "409": {
-                        "description": "A key-url association already exists for the provided key"
+                        "description": "A key-url association already exists for the provided key",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
                     },
                     "422": {
-                        "description": "URL in the payload is malformed"
+                        "description": "Key or URL in the payload is malformed or not allowed, the URL is blocklisted or the activation window is empty",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests from the client, retry after the Retry-After header seconds",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
                     },
                     "500": {
-                        "description": "The server has encountered an unknown error"
+                        "description": "The server has encountered an unknown error",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    },
+                    "503": {
+                        "description": "The storage did not respond in time",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
                     }
                 }
             },
             "delete": {
-                "description": "Deletes a key-url association",
+                "description": "Deletes a key-url association, which is only allowed with the API key that added it, or without API key for links added anonymously",
                 "consumes": [
                     "application/json"
                 ],
+                "produces": [
+                    "application/problem+json"
+                ],
                 "summary": "Delete short url",
                 "parameters": [
                     {
@@ -122,6 +192,12 @@ var doc = `{
                         "schema": {
                             "$ref": "#/definitions/routes.deleteURLRequestPayload"
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "API key owning the link",
+                        "name": "X-API-Key",
+                        "in": "header"
                     }
                 ],
                 "responses": {
@@ -129,13 +205,407 @@ var doc = `{
                         "description": "Key-url association deleted"
                     },
                     "400": {
-                        "description": "Payload cannot be decoded"
+                        "description": "Payload cannot be decoded",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    },
+                    "401": {
+                        "description": "The API key is not valid",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    },
+                    "403": {
+                        "description": "The link is owned by another API key",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
                     },
                     "404": {
-                        "description": "Key-url association not found for key"
+                        "description": "Key-url association not found for key",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests from the client, retry after the Retry-After header seconds",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    },
+                    "500": {
+                        "description": "The server has encountered an unknown error",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    },
+                    "503": {
+                        "description": "The storage did not respond in time",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/domains": {
+            "get": {
+                "description": "Returns the short domains served in addition to the default one",
+                "produces": [
+                    "application/json",
+                    "application/problem+json"
+                ],
+                "summary": "List short domains",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/routes.domainPayload"
+                            }
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests from the client, retry after the Retry-After header seconds",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Registers a short domain with its own keyspace, replacing its settings if already registered by the same API key. The domain is persisted in the storage when it supports it.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json",
+                    "application/problem+json"
+                ],
+                "summary": "Register short domain",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API key owning the domain",
+                        "name": "X-API-Key",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Domain to register",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/routes.domainPayload"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/routes.domainPayload"
+                        }
+                    },
+                    "400": {
+                        "description": "Payload cannot be decoded",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    },
+                    "401": {
+                        "description": "API key not valid",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    },
+                    "403": {
+                        "description": "Domain registered by another API key or configured at startup",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    },
+                    "422": {
+                        "description": "Host or fallback URL in the payload is malformed or not allowed",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests from the client, retry after the Retry-After header seconds",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    },
+                    "500": {
+                        "description": "The server has encountered an unknown error",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    },
+                    "503": {
+                        "description": "The storage did not respond in time",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Stops serving a short domain. Its links are kept and served again if the domain is registered anew. Only the API key that registered the domain can remove it.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/problem+json"
+                ],
+                "summary": "Remove short domain",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API key owning the domain",
+                        "name": "X-API-Key",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Domain to remove",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/routes.deleteDomainRequestPayload"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Domain removed"
+                    },
+                    "400": {
+                        "description": "Payload cannot be decoded",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    },
+                    "401": {
+                        "description": "API key not valid",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    },
+                    "403": {
+                        "description": "Domain registered by another API key or configured at startup",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    },
+                    "404": {
+                        "description": "Domain not registered",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests from the client, retry after the Retry-After header seconds",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    },
+                    "500": {
+                        "description": "The server has encountered an unknown error",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    },
+                    "503": {
+                        "description": "The storage did not respond in time",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/links": {
+            "get": {
+                "description": "Lists the stored links in key order, optionally restricted to a short domain and to the links in a state of their activation window",
+                "produces": [
+                    "application/json",
+                    "application/problem+json"
+                ],
+                "summary": "List short urls",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "State of the links: scheduled, active or ended, all if empty",
+                        "name": "state",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Short domain of the links, all domains if empty",
+                        "name": "domain",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/routes.linkPayload"
+                            }
+                        }
+                    },
+                    "422": {
+                        "description": "The state is unknown or the domain is not registered",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests from the client, retry after the Retry-After header seconds",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    },
+                    "500": {
+                        "description": "The server has encountered an unknown error",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    },
+                    "503": {
+                        "description": "The storage did not respond in time",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/misses": {
+            "get": {
+                "description": "Returns the keys requested most often without existing, the most missed first",
+                "produces": [
+                    "application/json",
+                    "application/problem+json"
+                ],
+                "summary": "List missed keys",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of keys to return, 100 by default",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/routes.missPayload"
+                            }
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests from the client, retry after the Retry-After header seconds",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/stats": {
+            "get": {
+                "description": "Returns the number of links and hits, in total and grouped by campaign, and the hits of each variant of split links, optionally restricted to a short domain",
+                "produces": [
+                    "application/json",
+                    "application/problem+json"
+                ],
+                "summary": "Return link statistics",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Short domain of the links, all domains if empty",
+                        "name": "domain",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/routes.statsResponsePayload"
+                        }
+                    },
+                    "422": {
+                        "description": "The domain is not registered",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests from the client, retry after the Retry-After header seconds",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
                     },
                     "500": {
-                        "description": "The server has encountered an unknown error"
+                        "description": "The server has encountered an unknown error",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    },
+                    "503": {
+                        "description": "The storage did not respond in time",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/usage": {
+            "get": {
+                "description": "Returns the number of links and the storage used by the API key, along with its quota",
+                "produces": [
+                    "application/json",
+                    "application/problem+json"
+                ],
+                "summary": "Return quota usage",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API key for which usage is requested, anonymous usage if empty",
+                        "name": "X-API-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/routes.usageResponsePayload"
+                        }
+                    },
+                    "401": {
+                        "description": "The API key is not valid",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests from the client, retry after the Retry-After header seconds",
+                        "schema": {
+                            "$ref": "#/definitions/routes.problemPayload"
+                        }
                     }
                 }
             }
@@ -145,28 +615,172 @@ var doc = `{
         "routes.addURLRequestPayload": {
             "type": "object",
             "properties": {
+                "campaign": {
+                    "description": "Optional campaign parameters added to the query of the URL, replacing the ones already present",
+                    "type": "object",
+                    "$ref": "#/definitions/routes.campaignPayload"
+                },
+                "comingSoonURL": {
+                    "description": "Optional url clients are redirected to before NotBefore, instead of showing a coming soon page",
+                    "type": "string"
+                },
+                "domain": {
+                    "description": "Optional short domain of the key, the default domain if empty",
+                    "type": "string"
+                },
+                "interstitial": {
+                    "description": "If true the preview page is always shown before redirecting",
+                    "type": "boolean"
+                },
                 "key": {
                     "description": "Key for which the association should be added",
                     "type": "string"
                 },
+                "notAfter": {
+                    "description": "Optional end of the activation window of the link, in RFC 3339 format",
+                    "type": "string"
+                },
+                "notBefore": {
+                    "description": "Optional start of the activation window of the link, in RFC 3339 format",
+                    "type": "string"
+                },
+                "passthrough": {
+                    "description": "If true the path after the key and the query of requests are forwarded to the URL",
+                    "type": "boolean"
+                },
+                "password": {
+                    "description": "Optional password asked before redirecting, stored hashed",
+                    "type": "string"
+                },
+                "queryPrecedence": {
+                    "description": "Values kept for query parameters in both the request and the URL of a passthrough link:\nrequest (default), target or both",
+                    "type": "string"
+                },
+                "rules": {
+                    "description": "Optional rules evaluated in order on each redirect, the first one matched by the client replacing the URL",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/routes.rulePayload"
+                    }
+                },
+                "sticky": {
+                    "description": "If true clients are assigned a variant with a cookie and keep being redirected to it",
+                    "type": "boolean"
+                },
+                "template": {
+                    "description": "If true the URL is a template whose placeholders {1} to {9} are replaced by the path segments after the key",
+                    "type": "boolean"
+                },
+                "title": {
+                    "description": "Optional title shown in the preview page",
+                    "type": "string"
+                },
                 "url": {
                     "description": "URL to add for the key",
                     "type": "string"
+                },
+                "variants": {
+                    "description": "Optional urls requests are distributed across by weight, in which case URL must be empty and\nthe first variant is reported as the URL of the link",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/routes.variantPayload"
+                    }
+                }
+            }
+        },
+        "routes.campaignPayload": {
+            "type": "object",
+            "properties": {
+                "content": {
+                    "description": "Content differentiating links to the same URL, added as utm_content",
+                    "type": "string"
+                },
+                "medium": {
+                    "description": "Marketing medium, added as utm_medium",
+                    "type": "string"
+                },
+                "name": {
+                    "description": "Campaign name, added as utm_campaign",
+                    "type": "string"
+                },
+                "source": {
+                    "description": "Referrer of the visitors, added as utm_source, required if any other parameter is set",
+                    "type": "string"
+                },
+                "term": {
+                    "description": "Paid keywords, added as utm_term",
+                    "type": "string"
+                }
+            }
+        },
+        "routes.campaignStatsPayload": {
+            "type": "object",
+            "properties": {
+                "campaign": {
+                    "description": "Campaign parameters, all empty for links without campaign",
+                    "type": "object",
+                    "$ref": "#/definitions/routes.campaignPayload"
+                },
+                "hits": {
+                    "description": "Number of times the links of the campaign have been requested",
+                    "type": "integer"
+                },
+                "links": {
+                    "description": "Number of links of the campaign",
+                    "type": "integer"
+                }
+            }
+        },
+        "routes.deleteDomainRequestPayload": {
+            "type": "object",
+            "properties": {
+                "host": {
+                    "description": "Host name of the short domain to remove",
+                    "type": "string"
                 }
             }
         },
         "routes.deleteURLRequestPayload": {
             "type": "object",
             "properties": {
+                "domain": {
+                    "description": "Optional short domain of the key, the default domain if empty",
+                    "type": "string"
+                },
                 "key": {
                     "description": "Key for which the association should be deleted",
                     "type": "string"
                 }
             }
         },
+        "routes.domainPayload": {
+            "type": "object",
+            "properties": {
+                "brand": {
+                    "description": "Optional name shown on the not found page, the host if empty",
+                    "type": "string"
+                },
+                "fallbackURL": {
+                    "description": "Optional URL to redirect to when a key is not found, linked from the not found page",
+                    "type": "string"
+                },
+                "host": {
+                    "description": "Host name of the short domain",
+                    "type": "string"
+                },
+                "notFound": {
+                    "description": "Response to unknown keys: plain, redirect or page, redirect if empty and a fallback URL is set, plain otherwise",
+                    "type": "string"
+                }
+            }
+        },
         "routes.infoRequestPayload": {
             "type": "object",
             "properties": {
+                "domain": {
+                    "description": "Optional short domain of the key, the default domain if empty",
+                    "type": "string"
+                },
                 "key": {
                     "description": "Key for which information is requested",
                     "type": "string"
@@ -176,17 +790,266 @@ var doc = `{
         "routes.infoResponsePayload": {
             "type": "object",
             "properties": {
-                "hits": {
+                "ComingSoonURL": {
+                    "description": "URL clients are redirected to before NotBefore, omitted if a coming soon page is shown",
+                    "type": "string"
+                },
+                "Domain": {
+                    "description": "Short domain of the key, omitted for the default domain",
+                    "type": "string"
+                },
+                "Hits": {
                     "description": "Number of times the url has been requested",
                     "type": "integer"
                 },
-                "key": {
+                "Key": {
                     "description": "Key for which information was requested",
                     "type": "string"
                 },
+                "NotAfter": {
+                    "description": "When the link stops redirecting, omitted if it never does",
+                    "type": "string"
+                },
+                "NotBefore": {
+                    "description": "When the link starts redirecting, omitted if it was active since its creation",
+                    "type": "string"
+                },
+                "Protected": {
+                    "description": "True if a password is asked before redirecting",
+                    "type": "boolean"
+                },
+                "Rules": {
+                    "description": "Routing rules replacing the URL for the clients matching them, omitted if there are none",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/routes.rulePayload"
+                    }
+                },
+                "State": {
+                    "description": "Whether the link redirects now: scheduled, active or ended",
+                    "type": "string"
+                },
+                "Sticky": {
+                    "description": "If true clients keep being redirected to the same variant",
+                    "type": "boolean"
+                },
+                "URL": {
+                    "description": "URL to redirect to",
+                    "type": "string"
+                },
+                "Variants": {
+                    "description": "Variants of a split link with their hits, omitted for other links",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/routes.variantStatsPayload"
+                    }
+                }
+            }
+        },
+        "routes.linkPayload": {
+            "type": "object",
+            "properties": {
+                "Domain": {
+                    "description": "Short domain of the key, omitted for the default domain",
+                    "type": "string"
+                },
+                "Key": {
+                    "description": "Key of the link",
+                    "type": "string"
+                },
+                "NotAfter": {
+                    "description": "When the link stops redirecting, omitted if it never does",
+                    "type": "string"
+                },
+                "NotBefore": {
+                    "description": "When the link starts redirecting, omitted if active since its creation",
+                    "type": "string"
+                },
+                "State": {
+                    "description": "Whether the link redirects: scheduled, active or ended",
+                    "type": "string"
+                },
+                "URL": {
+                    "description": "URL to redirect to",
+                    "type": "string"
+                }
+            }
+        },
+        "routes.missPayload": {
+            "type": "object",
+            "properties": {
+                "Count": {
+                    "description": "Number of requests of the key",
+                    "type": "integer"
+                },
+                "Domain": {
+                    "description": "Short domain of the key, omitted for the default domain",
+                    "type": "string"
+                },
+                "Key": {
+                    "description": "Missed key",
+                    "type": "string"
+                },
+                "LastSeen": {
+                    "description": "Time of the last request of the key",
+                    "type": "string"
+                }
+            }
+        },
+        "routes.problemPayload": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "Stable machine-readable error code",
+                    "type": "string"
+                },
+                "detail": {
+                    "description": "Human-readable explanation of this occurrence of the problem",
+                    "type": "string"
+                },
+                "field": {
+                    "description": "Name of the offending field in the request payload, if any",
+                    "type": "string"
+                },
+                "status": {
+                    "description": "HTTP status code",
+                    "type": "integer"
+                },
+                "title": {
+                    "description": "Short summary of the problem type",
+                    "type": "string"
+                },
+                "type": {
+                    "description": "URI identifying the problem type, always about:blank",
+                    "type": "string"
+                }
+            }
+        },
+        "routes.rulePayload": {
+            "type": "object",
+            "properties": {
+                "Countries": {
+                    "description": "ISO 3166-1 alpha-2 codes of the country of the client address",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "Languages": {
+                    "description": "Preferred language of the client, pt matching pt-BR as well",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "Platforms": {
+                    "description": "Platforms of the client: ios, android, windows, macos or linux",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "URL": {
+                    "description": "URL to redirect to when all conditions are satisfied",
+                    "type": "string"
+                }
+            }
+        },
+        "routes.splitStatsPayload": {
+            "type": "object",
+            "properties": {
+                "Domain": {
+                    "description": "Short domain of the key, omitted for the default domain",
+                    "type": "string"
+                },
+                "Key": {
+                    "description": "Key of the split link",
+                    "type": "string"
+                },
+                "Variants": {
+                    "description": "Variants of the link with their hits",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/routes.variantStatsPayload"
+                    }
+                }
+            }
+        },
+        "routes.statsResponsePayload": {
+            "type": "object",
+            "properties": {
+                "campaigns": {
+                    "description": "Links and hits grouped by campaign, the most requested first",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/routes.campaignStatsPayload"
+                    }
+                },
+                "hits": {
+                    "description": "Number of times the links have been requested",
+                    "type": "integer"
+                },
+                "links": {
+                    "description": "Number of links",
+                    "type": "integer"
+                },
+                "splits": {
+                    "description": "Hits of each variant of the split links, by key",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/routes.splitStatsPayload"
+                    }
+                }
+            }
+        },
+        "routes.usageResponsePayload": {
+            "type": "object",
+            "properties": {
+                "bytes": {
+                    "description": "Storage used by the links",
+                    "type": "integer"
+                },
+                "links": {
+                    "description": "Number of active links",
+                    "type": "integer"
+                },
+                "maxBytes": {
+                    "description": "Maximum storage used by the links, 0 if unlimited",
+                    "type": "integer"
+                },
+                "maxLinks": {
+                    "description": "Maximum number of active links, 0 if unlimited",
+                    "type": "integer"
+                }
+            }
+        },
+        "routes.variantPayload": {
+            "type": "object",
+            "properties": {
                 "url": {
                     "description": "URL to redirect to",
                     "type": "string"
+                },
+                "weight": {
+                    "description": "Share of the requests sent to the variant, relative to the sum of all weights",
+                    "type": "integer"
+                }
+            }
+        },
+        "routes.variantStatsPayload": {
+            "type": "object",
+            "properties": {
+                "Hits": {
+                    "description": "Number of requests redirected to the variant",
+                    "type": "integer"
+                },
+                "URL": {
+                    "description": "URL of the variant",
+                    "type": "string"
+                },
+                "Weight": {
+                    "description": "Share of the requests sent to the variant",
+                    "type": "integer"
                 }
             }
         }
@@ -1,20 +1,323 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
 	"os"
+	"strings"
+	"time"
 
 	_ "github.com/giannimassi/shorturl/docs"
+	"github.com/giannimassi/shorturl/pkg/cache"
+	"github.com/giannimassi/shorturl/pkg/domains"
+	"github.com/giannimassi/shorturl/pkg/geo"
+	"github.com/giannimassi/shorturl/pkg/logging"
+	"github.com/giannimassi/shorturl/pkg/metrics"
+	"github.com/giannimassi/shorturl/pkg/notfound"
+	"github.com/giannimassi/shorturl/pkg/pubsub"
+	"github.com/giannimassi/shorturl/pkg/quota"
+	"github.com/giannimassi/shorturl/pkg/ratelimit"
+	"github.com/giannimassi/shorturl/pkg/resp"
 	"github.com/giannimassi/shorturl/pkg/routes"
+	"github.com/giannimassi/shorturl/pkg/screening"
 	"github.com/giannimassi/shorturl/pkg/storage"
+	"github.com/giannimassi/shorturl/pkg/tracing"
+	"github.com/giannimassi/shorturl/pkg/validation"
 )
 
+var (
+	storageBackend      = flag.String("storage", "memory", "storage backend: memory or redis")
+	memoryShards        = flag.Int("memory-shards", storage.DefaultShards, "number of independently locked shards of the memory storage backend")
+	redisAddr           = flag.String("redis-addr", "localhost:6379", "address of the Redis server used by the redis storage backend")
+	redisPrefix         = flag.String("redis-prefix", "shorturl:", "prefix of the keys written by the redis storage backend")
+	linkTTL             = flag.Duration("link-ttl", 0, "time after which links expire with the redis storage backend, 0 for never")
+	selfHosts           = flag.String("self-hosts", "localhost,127.0.0.1,::1", "comma separated hosts the service is reachable at, which links cannot point to; the host name of the machine and the short domains are always included")
+	allowedSchemes      = flag.String("allowed-schemes", "http,https", "comma separated schemes links can point to, all if empty")
+	allowedHosts        = flag.String("allowed-hosts", "", "comma separated hosts links can point to, along with their subdomains, all if empty")
+	deniedHosts         = flag.String("denied-hosts", "", "comma separated hosts links cannot point to, along with their subdomains")
+	maxURLLength        = flag.Int("max-url-length", validation.DefaultMaxURLLength, "maximum length of the urls links point to, 0 for no limit")
+	blocklistPath       = flag.String("blocklist", "", "path of a file listing blocked domains, one per line")
+	recheckInterval     = flag.Duration("recheck-interval", time.Hour, "interval between screenings of stored links, 0 to disable")
+	logLevel            = flag.String("log-level", "info", "minimum level of logged records: debug, info, warn or error")
+	redirectLogSampling = flag.Int("log-redirect-sampling", 1, "log only one out of every n followed redirects")
+	storageTimeout      = flag.Duration("storage-timeout", 2*time.Second, "maximum duration of each storage operation performed while serving a request, 0 for none")
+	shutdownDelay       = flag.Duration("shutdown-delay", 5*time.Second, "time during which the server reports not to be ready before shutting down")
+	traceOutput         = flag.String("trace-output", "", "write spans as JSON lines to this file, or to stdout if set to -")
+	traceCollector      = flag.String("trace-collector", "", "send spans to this OTLP/HTTP collector url, e.g. http://localhost:4318/v1/traces")
+	apiRate             = flag.Float64("api-rate", 10, "management requests allowed per second to each client, 0 to disable")
+	apiBurst            = flag.Int("api-burst", 20, "management requests allowed at once to each client")
+	redirectRate        = flag.Float64("redirect-rate", 50, "redirects allowed per second to each client, 0 to disable")
+	redirectBurst       = flag.Int("redirect-burst", 100, "redirects allowed at once to each client")
+	apiKeys             = flag.String("api-keys", "", "comma separated API keys accepted in the X-API-Key header, identifying the clients of management requests")
+	trustedProxies      = flag.String("trusted-proxies", "", "comma separated CIDRs of the proxies trusted to set the client IP address")
+	quotaLinks          = flag.Int("quota-links", 0, "maximum number of active links per API key, 0 for no limit")
+	shortDomains        = flag.String("domains", "", "comma separated short domains served with their own keyspace, as host or host=fallback-url")
+	domainReload        = flag.Duration("domain-reload-interval", time.Minute, "interval between reloads of the short domains registered by other replicas, 0 to disable")
+	notFoundMode        = flag.String("not-found", "plain", "response to unknown keys on the default domain: plain, page or redirect")
+	notFoundURL         = flag.String("not-found-url", "", "url visitors of unknown keys are redirected to, or linked from the not found page")
+	notFoundBrand       = flag.String("not-found-brand", "", "name shown on the not found page of the default domain")
+	missedKeys          = flag.Int("missed-keys", notfound.DefaultTrackerSize, "number of missed keys tracked and listed on /api/misses, 0 to disable")
+	quotaBytes          = flag.Int64("quota-bytes", 0, "maximum storage used by the links of each API key, 0 for no limit")
+	quotaReload         = flag.Duration("quota-reload-interval", 10*time.Minute, "interval between reloads of the quota usage from the storage, releasing expired links, 0 to disable")
+	cacheSize           = flag.Int("cache-size", 0, "number of links cached in memory in front of the storage, 0 to disable")
+	cacheTTL            = flag.Duration("cache-ttl", time.Minute, "time after which cached links are reloaded from the storage")
+	cacheNegativeTTL    = flag.Duration("cache-negative-ttl", 10*time.Second, "time during which unknown keys are cached, 0 to disable")
+	cacheInvalidation   = flag.String("cache-invalidation", "", "address of a Redis server used to broadcast cache invalidations between replicas")
+	hitFlushInterval    = flag.Duration("hit-flush-interval", 10*time.Second, "interval between flushes of the hits served from the cache")
+	geoDatabase         = flag.String("geo-db", "", "path of a CSV file mapping address ranges to countries, used by the country conditions of routing rules")
+	accessSecret        = flag.String("access-secret", "", "secret signing the cookies of password protected links, random if empty")
+	accessTTL           = flag.Duration("access-ttl", 15*time.Minute, "time during which a client can follow a protected link after entering its password")
+	passwordAttempts    = flag.Int("password-attempts", 5, "wrong passwords allowed at once for each protected link from each client IP, 0 for no limit")
+	passwordLinkLimit   = flag.Int("password-link-attempts", 50, "wrong passwords allowed at once for each protected link from all clients together, then ten every -password-lockout, 0 for no limit")
+	passwordLockout     = flag.Duration("password-lockout", time.Minute, "time after which a client IP can submit another wrong password for a protected link")
+	clientIPHeaders     = flag.String("client-ip-headers", "X-Forwarded-For,X-Real-IP", "comma separated headers carrying the client IP address, checked in order")
+)
+
+// invalidationChannel is the pub/sub channel on which the modified keys are published
+const invalidationChannel = "shorturl:invalidations"
+
+// redisTimeout is the timeout of connections and commands sent to Redis
+const redisTimeout = 2 * time.Second
+
+// redisMaxIdle is the maximum number of idle connections kept to the Redis storage backend
+const redisMaxIdle = 16
+
+// traceFlushInterval is the maximum time spans are buffered before being sent to the collector
+const traceFlushInterval = 5 * time.Second
+
 func main() {
-	if err := run(); err != nil {
-		println("Unexpected error:", err)
+	flag.Parse()
+	level, err := logging.ParseLevel(*logLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	logger := logging.New(os.Stderr, level)
+	if err := run(logger); err != nil {
+		logger.Error("unexpected error", "error", err)
 		os.Exit(1)
 	}
 }
 
-func run() error {
-	return routes.Start(storage.NewMemoryStore())
+func run(logger *logging.Logger) error {
+	reg := metrics.NewRegistry()
+	opts := []routes.Option{
+		routes.WithMetrics(reg),
+		routes.WithLogger(logger, *redirectLogSampling),
+		routes.WithShutdownDelay(*shutdownDelay),
+		routes.WithStorageTimeout(*storageTimeout),
+		routes.WithRateLimits(
+			ratelimit.Limit{Rate: *apiRate, Burst: *apiBurst},
+			ratelimit.Limit{Rate: *redirectRate, Burst: *redirectBurst},
+		),
+		routes.WithAPIKeys(splitList(*apiKeys)...),
+		routes.WithURLPolicy(urlPolicy()),
+	}
+	if *trustedProxies != "" {
+		proxies, err := parseCIDRs(*trustedProxies)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, routes.WithTrustedProxies(proxies, splitList(*clientIPHeaders)...))
+	}
+	if exporter, err := newTraceExporter(); err != nil {
+		return err
+	} else if exporter != nil {
+		onError := func(err error) {
+			logger.Warn("exporting spans", "error", err)
+		}
+		if e, ok := exporter.(*tracing.HTTPExporter); ok {
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				e.Run(ctx, traceFlushInterval, onError)
+				close(done)
+			}()
+			defer func() {
+				cancel()
+				<-done
+			}()
+		}
+		opts = append(opts, routes.WithTracer(tracing.NewTracer(exporter, onError)))
+	}
+	domainRegistry, err := parseDomains(*shortDomains)
+	if err != nil {
+		return err
+	}
+	opts = append(opts, routes.WithDomains(domainRegistry))
+	defaultDomain := domains.Domain{NotFound: domains.NotFoundMode(*notFoundMode), FallbackURL: *notFoundURL, Brand: *notFoundBrand}
+	if err := defaultDomain.Validate(); err != nil {
+		return fmt.Errorf("parsing not found settings: %w", err)
+	}
+	opts = append(opts, routes.WithNotFound(defaultDomain))
+	if *missedKeys > 0 {
+		opts = append(opts, routes.WithMissedKeys(notfound.NewTracker(*missedKeys)))
+	}
+	if *quotaLinks > 0 || *quotaBytes > 0 {
+		opts = append(opts, routes.WithQuotas(quota.NewTracker(quota.Quota{MaxLinks: *quotaLinks, MaxBytes: *quotaBytes}), *quotaReload))
+	}
+	if *blocklistPath != "" {
+		b, err := loadBlocklist(*blocklistPath)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, routes.WithScreener(b, *recheckInterval))
+	}
+	opts = append(opts, routes.WithAccessCookies([]byte(*accessSecret), *accessTTL))
+	attempts, linkAttempts := ratelimit.Limit{}, ratelimit.Limit{}
+	if *passwordLockout > 0 {
+		attempts = ratelimit.Limit{Rate: 1 / passwordLockout.Seconds(), Burst: *passwordAttempts}
+		linkAttempts = ratelimit.Limit{Rate: 10 / passwordLockout.Seconds(), Burst: *passwordLinkLimit}
+	}
+	opts = append(opts, routes.WithPasswordAttempts(attempts, linkAttempts))
+	if *geoDatabase != "" {
+		db, err := geo.LoadDatabase(*geoDatabase)
+		if err != nil {
+			return err
+		}
+		logger.Info("geo database loaded", "ranges", db.Len())
+		opts = append(opts, routes.WithGeoResolver(db))
+	}
+
+	store, err := newStore()
+	if err != nil {
+		return err
+	}
+	if ds, ok := store.(domains.Store); ok {
+		ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+		err := domainRegistry.Load(ctx, ds)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("loading domains: %w", err)
+		}
+		go domainRegistry.Run(context.Background(), ds, *domainReload)
+	}
+	// the backend is instrumented before being cached, so that its metrics are not skewed by the
+	// requests served from the cache
+	store = metrics.InstrumentProvider(store, *storageBackend, reg)
+	if *cacheSize > 0 {
+		c := cache.New(store, *cacheSize, *cacheTTL, *cacheNegativeTTL)
+		reg.NewGaugeFunc("shorturl_pending_hits", "Number of hits served from the cache waiting to be flushed to the storage.", func() float64 {
+			return float64(c.PendingHits())
+		})
+		if *cacheInvalidation != "" {
+			c.Broadcast(pubsub.NewRedis(*cacheInvalidation, redisTimeout), invalidationChannel, func(err error) {
+				logger.Warn("cache invalidation", "error", err)
+			})
+			go c.Listen(context.Background())
+		}
+		go c.Run(context.Background(), *hitFlushInterval)
+		defer func() {
+			if err := c.Flush(context.Background()); err != nil {
+				logger.Error("flushing cached hits", "error", err)
+			}
+		}()
+		store = c
+	}
+	return routes.Start(store, opts...)
+}
+
+// newStore returns the storage backend selected by the storage flags
+func newStore() (storage.Provider, error) {
+	switch *storageBackend {
+	case "memory":
+		return storage.NewShardedStore(*memoryShards), nil
+	case "redis":
+		if *linkTTL < 0 || (*linkTTL > 0 && *linkTTL < time.Second) {
+			return nil, fmt.Errorf("link-ttl must be 0 or at least 1s, got %v", *linkTTL)
+		}
+		pool := resp.NewPool(*redisAddr, redisTimeout, redisMaxIdle)
+		return storage.NewRedisStore(pool, *redisPrefix, *linkTTL), nil
+	}
+	return nil, fmt.Errorf("unknown storage backend %q", *storageBackend)
+}
+
+// urlPolicy returns the policy configured by the url flags. The host name of the machine is added to
+// the self hosts, so that links to the service itself are rejected without configuration.
+func urlPolicy() validation.URLPolicy {
+	p := validation.URLPolicy{
+		AllowedSchemes: splitList(*allowedSchemes),
+		AllowedHosts:   splitList(*allowedHosts),
+		DeniedHosts:    splitList(*deniedHosts),
+		SelfHosts:      splitList(*selfHosts),
+		MaxLength:      *maxURLLength,
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		p.SelfHosts = append(p.SelfHosts, hostname)
+	}
+	return p
+}
+
+// parseCIDRs parses a comma separated list of CIDRs
+func parseCIDRs(s string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, c := range splitList(s) {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, fmt.Errorf("parsing trusted proxies: %w", err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// parseDomains returns a registry of the domains in a comma separated list of host or
+// host=fallback-url items
+func parseDomains(s string) (*domains.Registry, error) {
+	reg := domains.NewRegistry()
+	for _, item := range splitList(s) {
+		parts := strings.SplitN(item, "=", 2)
+		d := domains.Domain{Host: parts[0]}
+		if len(parts) == 2 {
+			d.FallbackURL = parts[1]
+		}
+		if _, err := reg.Register(d); err != nil {
+			return nil, fmt.Errorf("parsing domains: %w", err)
+		}
+	}
+	return reg, nil
+}
+
+// splitList splits a comma separated list, dropping empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func loadBlocklist(path string) (*screening.Blocklist, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening blocklist: %w", err)
+	}
+	defer f.Close()
+	b := screening.NewBlocklist(nil, nil)
+	if err := b.Load(f, storage.FlagDisabled); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// newTraceExporter returns the exporter configured by the tracing flags, or nil if tracing is
+// disabled. HTTP exporters must be run by the caller.
+func newTraceExporter() (tracing.Exporter, error) {
+	switch {
+	case *traceCollector != "":
+		return tracing.NewHTTPExporter(*traceCollector, "shorturl", tracing.DefaultBatchSize), nil
+	case *traceOutput == "-":
+		return tracing.NewWriterExporter(os.Stdout), nil
+	case *traceOutput != "":
+		f, err := os.OpenFile(*traceOutput, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("opening trace output: %w", err)
+		}
+		return tracing.NewWriterExporter(f), nil
+	}
+	return nil, nil
 }
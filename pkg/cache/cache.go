@@ -0,0 +1,354 @@
+// Package cache implements a read-through cache in front of a storage.Provider
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/giannimassi/shorturl/pkg/storage"
+)
+
+// resubscribeDelay is the time waited before subscribing again to invalidations after a failure
+const resubscribeDelay = time.Second
+
+// Broadcaster distributes messages to all the replicas sharing a store
+type Broadcaster interface {
+	Publish(channel, msg string) error
+	Subscribe(ctx context.Context, channel string, handler func(msg string)) error
+}
+
+// Provider is a storage.Provider caching the urls and metadata of the most recently used keys,
+// as well as the keys that are not found. Entries are invalidated when modified through the
+// Provider, and expire after a TTL to bound staleness when the store is shared.
+//
+// If the decorated provider supports storage.HitCounter, cached urls are served without
+// querying it and hits are accumulated until Flush is called. Otherwise every ShortURL call is
+// forwarded so that hits are counted by the decorated provider. Variant hits and pings are always
+// forwarded.
+type Provider struct {
+	storage.Forwarder
+
+	next        storage.Provider
+	counter     storage.HitCounter
+	size        int
+	ttl         time.Duration
+	negativeTTL time.Duration
+	now         func() time.Time
+
+	broadcaster Broadcaster
+	channel     string
+	onError     func(error)
+
+	m       sync.Mutex
+	lru     *list.List // of *entry, most recently used first
+	entries map[string]*list.Element
+	gen     uint64 // incremented on every invalidation
+	pending map[string]int
+}
+
+type entry struct {
+	key     string
+	missing bool              // The key is not found in the store
+	url     *url.URL          // nil if not loaded yet
+	md      *storage.Metadata // nil if not loaded yet
+	expires time.Time
+}
+
+// New returns a Provider caching up to size keys of next for ttl, and unknown keys for negativeTTL.
+// Negative caching is disabled if negativeTTL is zero.
+func New(next storage.Provider, size int, ttl, negativeTTL time.Duration) *Provider {
+	return &Provider{
+		Forwarder:   storage.Forwarder{Next: next},
+		next:        next,
+		counter:     storage.HitCounterOf(next),
+		size:        size,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		now:         time.Now,
+		lru:         list.New(),
+		entries:     make(map[string]*list.Element),
+		pending:     make(map[string]int),
+	}
+}
+
+// Broadcast publishes the keys modified through p on channel, so that the caches of the other
+// replicas subscribed with Listen invalidate them. Publishing errors are reported to onError.
+// It must be called before p is used.
+func (p *Provider) Broadcast(b Broadcaster, channel string, onError func(error)) {
+	p.broadcaster, p.channel, p.onError = b, channel, onError
+}
+
+// Listen invalidates the keys published by the other replicas until ctx is done, subscribing again
+// after failures. All entries are dropped on every subscription, since invalidations may have been
+// missed in the meantime.
+func (p *Provider) Listen(ctx context.Context) {
+	if p.broadcaster == nil {
+		return
+	}
+	for {
+		p.purge()
+		err := p.broadcaster.Subscribe(ctx, p.channel, p.invalidate)
+		if ctx.Err() != nil {
+			return
+		}
+		p.onError(fmt.Errorf("subscribing to invalidations: %w", err))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(resubscribeDelay):
+		}
+	}
+}
+
+// ShortURL returns the url associated with the provided key, counting a hit
+func (p *Provider) ShortURL(ctx context.Context, key string) (*url.URL, error) {
+	p.m.Lock()
+	e := p.get(key)
+	switch {
+	case e != nil && e.missing:
+		p.m.Unlock()
+		return nil, storage.ErrKeyNotFound
+	case e != nil && e.url != nil && p.counter != nil:
+		p.pending[key]++
+		u := *e.url
+		p.m.Unlock()
+		return &u, nil
+	}
+	gen := p.gen
+	p.m.Unlock()
+
+	u, err := p.next.ShortURL(ctx, key)
+	p.store(key, gen, err, func(e *entry) {
+		cached := *u
+		e.url = &cached
+	})
+	return u, err
+}
+
+// AddURL stores the key-url association and invalidates the cached entry for key
+func (p *Provider) AddURL(ctx context.Context, key string, u url.URL, md storage.Metadata) error {
+	defer p.modified(key)
+	return p.next.AddURL(ctx, key, u, md)
+}
+
+// DeleteURL deletes the key-url association and invalidates the cached entry for key, discarding
+// its pending hits
+func (p *Provider) DeleteURL(ctx context.Context, key string) error {
+	defer p.modified(key)
+	err := p.next.DeleteURL(ctx, key)
+	p.m.Lock()
+	delete(p.pending, key)
+	p.m.Unlock()
+	return err
+}
+
+// ShortURLInfo returns the url and the number of hits for the provided key, including the pending ones.
+// Only unknown keys are served from the cache, since the number of hits changes on every redirect.
+func (p *Provider) ShortURLInfo(ctx context.Context, key string) (*url.URL, int, error) {
+	p.m.Lock()
+	if e := p.get(key); e != nil && e.missing {
+		p.m.Unlock()
+		return nil, 0, storage.ErrKeyNotFound
+	}
+	gen := p.gen
+	p.m.Unlock()
+
+	u, hits, err := p.next.ShortURLInfo(ctx, key)
+	p.store(key, gen, err, func(e *entry) {
+		cached := *u
+		e.url = &cached
+	})
+	if err == nil {
+		p.m.Lock()
+		hits += p.pending[key]
+		p.m.Unlock()
+	}
+	return u, hits, err
+}
+
+// Metadata returns the metadata stored for the provided key
+func (p *Provider) Metadata(ctx context.Context, key string) (storage.Metadata, error) {
+	p.m.Lock()
+	e := p.get(key)
+	switch {
+	case e != nil && e.missing:
+		p.m.Unlock()
+		return storage.Metadata{}, storage.ErrKeyNotFound
+	case e != nil && e.md != nil:
+		md := *e.md
+		p.m.Unlock()
+		return md, nil
+	}
+	gen := p.gen
+	p.m.Unlock()
+
+	md, err := p.next.Metadata(ctx, key)
+	p.store(key, gen, err, func(e *entry) {
+		cached := md
+		e.md = &cached
+	})
+	return md, err
+}
+
+// SetMetadata replaces the metadata stored for the provided key and invalidates the cached entry for key
+func (p *Provider) SetMetadata(ctx context.Context, key string, md storage.Metadata) error {
+	defer p.modified(key)
+	return p.next.SetMetadata(ctx, key, md)
+}
+
+// Keys returns all the stored keys, which are never cached
+func (p *Provider) Keys(ctx context.Context) ([]string, error) {
+	return p.next.Keys(ctx)
+}
+
+// QueuesHits returns true, since hits served from the cache are aggregated until flushed
+func (p *Provider) QueuesHits() bool {
+	return true
+}
+
+// PendingHits returns the number of hits served from the cache and not yet flushed
+func (p *Provider) PendingHits() int {
+	p.m.Lock()
+	defer p.m.Unlock()
+	var n int
+	for _, hits := range p.pending {
+		n += hits
+	}
+	return n
+}
+
+// Flush adds the pending hits to the decorated provider. Hits that cannot be added because of an
+// error other than storage.ErrKeyNotFound are kept for the next flush.
+func (p *Provider) Flush(ctx context.Context) error {
+	if p.counter == nil {
+		return nil
+	}
+	p.m.Lock()
+	pending := p.pending
+	p.pending = make(map[string]int)
+	p.m.Unlock()
+
+	var firstErr error
+	for key, hits := range pending {
+		err := p.counter.AddHits(ctx, key, hits)
+		if err == nil || errors.Is(err, storage.ErrKeyNotFound) {
+			continue
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		p.m.Lock()
+		p.pending[key] += hits
+		p.m.Unlock()
+	}
+	return firstErr
+}
+
+// Run flushes the pending hits every interval until ctx is done, then flushes them one last time
+func (p *Provider) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			_ = p.Flush(context.Background())
+			return
+		case <-t.C:
+			_ = p.Flush(ctx)
+		}
+	}
+}
+
+// Len returns the number of cached keys
+func (p *Provider) Len() int {
+	p.m.Lock()
+	defer p.m.Unlock()
+	return p.lru.Len()
+}
+
+// get returns the unexpired entry for key, marking it as recently used. It must be called with p.m held.
+func (p *Provider) get(key string) *entry {
+	el, found := p.entries[key]
+	if !found {
+		return nil
+	}
+	e := el.Value.(*entry)
+	if !p.now().Before(e.expires) {
+		p.lru.Remove(el)
+		delete(p.entries, key)
+		return nil
+	}
+	p.lru.MoveToFront(el)
+	return e
+}
+
+// store caches the outcome of a load of key started at generation gen: a missing entry if err is
+// storage.ErrKeyNotFound, the loaded values set by update if err is nil. Nothing is cached if
+// an invalidation happened in the meantime.
+func (p *Provider) store(key string, gen uint64, err error, update func(e *entry)) {
+	missing := errors.Is(err, storage.ErrKeyNotFound)
+	if (err != nil && !missing) || (missing && p.negativeTTL <= 0) || p.size <= 0 {
+		return
+	}
+
+	p.m.Lock()
+	defer p.m.Unlock()
+	if p.gen != gen {
+		return
+	}
+	e := p.get(key)
+	if e == nil || e.missing != missing {
+		if e != nil {
+			p.lru.Remove(p.entries[key])
+		}
+		ttl := p.ttl
+		if missing {
+			ttl = p.negativeTTL
+		}
+		e = &entry{key: key, missing: missing, expires: p.now().Add(ttl)}
+		p.entries[key] = p.lru.PushFront(e)
+		for p.lru.Len() > p.size {
+			oldest := p.lru.Back()
+			p.lru.Remove(oldest)
+			delete(p.entries, oldest.Value.(*entry).key)
+		}
+	}
+	if !missing {
+		update(e)
+	}
+}
+
+// modified invalidates key and publishes it to the other replicas
+func (p *Provider) modified(key string) {
+	p.invalidate(key)
+	if p.broadcaster == nil {
+		return
+	}
+	if err := p.broadcaster.Publish(p.channel, key); err != nil {
+		p.onError(fmt.Errorf("publishing invalidation of %q: %w", key, err))
+	}
+}
+
+// purge drops all entries
+func (p *Provider) purge() {
+	p.m.Lock()
+	defer p.m.Unlock()
+	p.gen++
+	p.lru.Init()
+	p.entries = make(map[string]*list.Element)
+}
+
+func (p *Provider) invalidate(key string) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	p.gen++
+	if el, found := p.entries[key]; found {
+		p.lru.Remove(el)
+		delete(p.entries, key)
+	}
+}
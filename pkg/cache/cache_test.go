@@ -0,0 +1,205 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/giannimassi/shorturl/pkg/pubsub"
+	"github.com/giannimassi/shorturl/pkg/storage"
+)
+
+// countingStore counts the calls reaching a MemoryStore
+type countingStore struct {
+	*storage.MemoryStore
+	calls map[string]int
+}
+
+func newCountingStore() *countingStore {
+	return &countingStore{MemoryStore: storage.NewMemoryStore(), calls: make(map[string]int)}
+}
+
+func (s *countingStore) ShortURL(ctx context.Context, key string) (*url.URL, error) {
+	s.calls["ShortURL"]++
+	return s.MemoryStore.ShortURL(ctx, key)
+}
+
+func (s *countingStore) Metadata(ctx context.Context, key string) (storage.Metadata, error) {
+	s.calls["Metadata"]++
+	return s.MemoryStore.Metadata(ctx, key)
+}
+
+// noCounterStore hides the storage.HitCounter implementation of countingStore
+type noCounterStore struct {
+	storage.Provider
+}
+
+func TestProvider(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2020, 7, 30, 10, 0, 0, 0, time.UTC)
+	s := newCountingStore()
+	p := New(s, 10, time.Minute, time.Second)
+	p.now = func() time.Time { return now }
+
+	// negative caching
+	for i := 0; i < 2; i++ {
+		if _, err := p.ShortURL(ctx, "a"); !errors.Is(err, storage.ErrKeyNotFound) {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+	if s.calls["ShortURL"] != 1 {
+		t.Errorf("unknown key should be cached: %d calls", s.calls["ShortURL"])
+	}
+
+	// invalidation on add
+	if err := p.AddURL(ctx, "a", mustMkURL("https://example.org/a"), storage.Metadata{Title: "A"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		u, err := p.ShortURL(ctx, "a")
+		if err != nil || u.String() != "https://example.org/a" {
+			t.Fatalf("unexpected result: %v, %v", u, err)
+		}
+		u.Path = "/modified"
+		if md, err := p.Metadata(ctx, "a"); err != nil || md.Title != "A" {
+			t.Fatalf("unexpected metadata: %+v, %v", md, err)
+		}
+	}
+	if s.calls["ShortURL"] != 2 || s.calls["Metadata"] != 1 {
+		t.Errorf("cached key should not reach the store: %v", s.calls)
+	}
+
+	// hits are forwarded on flush
+	if _, hits, _ := p.ShortURLInfo(ctx, "a"); hits != 3 {
+		t.Errorf("unexpected hits before flush: %d", hits)
+	}
+	if p.PendingHits() != 2 {
+		t.Errorf("unexpected pending hits: %d", p.PendingHits())
+	}
+	if err := p.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, hits, _ := s.ShortURLInfo(ctx, "a"); hits != 3 || p.PendingHits() != 0 {
+		t.Errorf("unexpected hits after flush: %d (%d pending)", hits, p.PendingHits())
+	}
+
+	// invalidation on metadata update
+	if err := p.SetMetadata(ctx, "a", storage.Metadata{Title: "B"}); err != nil {
+		t.Fatal(err)
+	}
+	if md, _ := p.Metadata(ctx, "a"); md.Title != "B" {
+		t.Errorf("stale metadata: %+v", md)
+	}
+
+	// expiration
+	now = now.Add(time.Minute)
+	if _, err := p.ShortURL(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if s.calls["ShortURL"] != 3 {
+		t.Errorf("expired key should reach the store: %d calls", s.calls["ShortURL"])
+	}
+
+	// invalidation on delete
+	if err := p.DeleteURL(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.ShortURL(ctx, "a"); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Errorf("unexpected err after delete: %v", err)
+	}
+	if p.PendingHits() != 0 {
+		t.Errorf("pending hits of deleted keys should be discarded")
+	}
+}
+
+func TestProvider_eviction(t *testing.T) {
+	ctx := context.Background()
+	s := newCountingStore()
+	p := New(s, 2, time.Minute, time.Minute)
+	for _, key := range []string{"a", "b", "c"} {
+		if err := s.AddURL(ctx, key, mustMkURL("https://example.org/"+key), storage.Metadata{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, key := range []string{"a", "b", "a", "c", "a", "b"} {
+		if _, err := p.ShortURL(ctx, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// b is evicted by c, then c by b
+	if s.calls["ShortURL"] != 4 || p.Len() != 2 {
+		t.Errorf("unexpected store calls %d and cached keys %d", s.calls["ShortURL"], p.Len())
+	}
+}
+
+func TestProvider_noHitCounter(t *testing.T) {
+	ctx := context.Background()
+	s := newCountingStore()
+	p := New(noCounterStore{s}, 10, time.Minute, time.Minute)
+	if err := p.AddURL(ctx, "a", mustMkURL("https://example.org/a"), storage.Metadata{}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := p.ShortURL(ctx, "a"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, hits, _ := s.ShortURLInfo(ctx, "a"); hits != 3 || s.calls["ShortURL"] != 3 {
+		t.Errorf("hits should be counted by the store: %d hits, %d calls", hits, s.calls["ShortURL"])
+	}
+}
+
+func mustMkURL(str string) url.URL {
+	u, err := url.Parse(str)
+	if err != nil {
+		panic(err)
+	}
+	return *u
+}
+
+func TestProvider_Broadcast(t *testing.T) {
+	s := newCountingStore()
+	bus := pubsub.NewMemory()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	replicas := make([]*Provider, 2)
+	for i := range replicas {
+		replicas[i] = New(s, 10, time.Minute, time.Minute)
+		replicas[i].Broadcast(bus, "invalidations", func(err error) { t.Errorf("unexpected err: %v", err) })
+		go replicas[i].Listen(ctx)
+	}
+	// wait for the subscriptions
+	for {
+		if err := replicas[0].AddURL(ctx, "probe", mustMkURL("https://example.org/"), storage.Metadata{}); err != nil {
+			t.Fatal(err)
+		}
+		_, _ = replicas[1].ShortURL(ctx, "probe")
+		_ = replicas[0].DeleteURL(ctx, "probe")
+		if _, err := replicas[1].ShortURL(ctx, "probe"); errors.Is(err, storage.ErrKeyNotFound) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// both replicas cache the key as unknown
+	for _, r := range replicas {
+		if _, err := r.ShortURL(ctx, "a"); !errors.Is(err, storage.ErrKeyNotFound) {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+	if err := replicas[0].AddURL(ctx, "a", mustMkURL("https://example.org/a"), storage.Metadata{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := replicas[1].ShortURL(ctx, "a"); err != nil {
+		t.Errorf("addition on a replica should invalidate the other: %v", err)
+	}
+	if err := replicas[0].DeleteURL(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := replicas[1].ShortURL(ctx, "a"); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Errorf("deletion on a replica should invalidate the other: %v", err)
+	}
+}
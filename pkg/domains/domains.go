@@ -0,0 +1,310 @@
+// Package domains keeps track of the short domains served in addition to the default one, each with
+// its own keyspace
+package domains
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/giannimassi/shorturl/pkg/validation"
+	"golang.org/x/net/idna"
+)
+
+// Errors returned when a domain is not registered, or is managed by another owner
+var (
+	ErrNotFound = errors.New("domain not found")
+	ErrNotOwner = errors.New("domain owned by another API key")
+)
+
+// HostField is the name of the field reported in host validation errors
+const HostField = "Host"
+
+// CodeUnknownDomain is used when a request refers to a domain that is not registered
+const CodeUnknownDomain = "unknown_domain"
+
+// keySeparator separates the host from the key in scoped keys. It is never allowed in hosts nor
+// in keys, so that scoped keys cannot collide with each other or with keys of the default domain.
+const keySeparator = "/"
+
+// NotFoundMode selects the response to requests of keys that do not exist
+type NotFoundMode string
+
+// Responses to requests of keys that do not exist
+const (
+	NotFoundPlain    NotFoundMode = "plain"    // Bare 404 status
+	NotFoundRedirect NotFoundMode = "redirect" // Temporary redirect to the fallback url
+	NotFoundPage     NotFoundMode = "page"     // Branded page suggesting similar keys
+)
+
+// NotFoundField is the name of the field reported in not found mode validation errors
+const NotFoundField = "NotFound"
+
+// Domain is a short domain with its own keyspace
+type Domain struct {
+	Host        string       // Normalized host name
+	NotFound    NotFoundMode // Response to unknown keys, see OnNotFound
+	FallbackURL string       // URL to redirect to when a key is not found
+	Brand       string       // Name shown on the not found page, the host if empty
+	Owner       string       // API key of the client that saved the domain, empty for anonymous clients
+}
+
+// OnNotFound returns the response to unknown keys: the configured mode if any, otherwise a redirect
+// if the domain has a fallback url and a plain 404 if not
+func (d Domain) OnNotFound() NotFoundMode {
+	switch {
+	case d.NotFound != "":
+		return d.NotFound
+	case d.FallbackURL != "":
+		return NotFoundRedirect
+	}
+	return NotFoundPlain
+}
+
+// Validate checks the not found settings of d, reporting failures as *validation.Error
+func (d Domain) Validate() error {
+	switch d.NotFound {
+	case "", NotFoundPlain, NotFoundPage:
+	case NotFoundRedirect:
+		if d.FallbackURL == "" {
+			return &validation.Error{Field: validation.URLField, Code: validation.CodeEmpty, Message: "redirect mode requires a fallback url"}
+		}
+	default:
+		return &validation.Error{Field: NotFoundField, Code: validation.CodeMalformed, Message: "unknown not found mode " + string(d.NotFound)}
+	}
+	return nil
+}
+
+// ScopedKey returns the key under which key is stored for host. Keys of the default domain,
+// identified by the empty host, are stored as they are.
+func ScopedKey(host, key string) string {
+	if host == "" {
+		return key
+	}
+	return host + keySeparator + key
+}
+
+// SplitKey returns the host and the key of a stored key, the host being empty for the default domain
+func SplitKey(stored string) (host, key string) {
+	i := strings.LastIndex(stored, keySeparator)
+	if i < 0 {
+		return "", stored
+	}
+	return stored[:i], stored[i+len(keySeparator):]
+}
+
+// NormalizeHost lowercases host, removes its port and trailing dot and converts it to its ASCII
+// (punycode) form. Failures are reported as *validation.Error.
+func NormalizeHost(host string) (string, error) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimSpace(host), ".")
+	if host == "" {
+		return "", &validation.Error{Field: HostField, Code: validation.CodeEmpty, Message: "host is empty"}
+	}
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil || strings.Contains(ascii, keySeparator) {
+		return "", &validation.Error{Field: HostField, Code: validation.CodeInvalidHost, Message: "host " + host + " is not a valid domain name"}
+	}
+	return ascii, nil
+}
+
+// Store persists the domains registered through Save, so that they survive restarts and are shared
+// by the replicas using the same storage. Records are opaque to the store.
+type Store interface {
+	Domains(ctx context.Context) (map[string]string, error)
+	SetDomain(ctx context.Context, host, record string) error
+	DeleteDomain(ctx context.Context, host string) error
+}
+
+// Registry holds the registered domains, safe for concurrent use. Domains added with Register are
+// kept in memory only, while those added with Save are written to the Store set by Load.
+type Registry struct {
+	m       sync.RWMutex
+	domains map[string]Domain
+	static  map[string]Domain // Registered with Register, kept across loads
+
+	// w serializes the writes to the store and the loads, so that a load never drops a domain
+	// saved while it was reading
+	w     sync.Mutex
+	store Store
+}
+
+// NewRegistry returns an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{domains: make(map[string]Domain), static: make(map[string]Domain)}
+}
+
+// Register adds d to the registry, replacing the domain with the same host if any. The host is
+// normalized with NormalizeHost, the fallback url is stored as is. The domain is not persisted:
+// Register is meant for the domains configured at startup.
+func (r *Registry) Register(d Domain) (Domain, error) {
+	d, err := normalize(d)
+	if err != nil {
+		return Domain{}, err
+	}
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.domains[d.Host] = d
+	r.static[d.Host] = d
+	return d, nil
+}
+
+// Save is like Register, but also writes d to the store if any, returning its error. It returns
+// ErrNotOwner if the host is already registered with another owner or was registered with Register.
+func (r *Registry) Save(ctx context.Context, d Domain) (Domain, error) {
+	d, err := normalize(d)
+	if err != nil {
+		return Domain{}, err
+	}
+	r.w.Lock()
+	defer r.w.Unlock()
+	if err := r.checkOwner(d.Host, d.Owner); err != nil && err != ErrNotFound {
+		return Domain{}, err
+	}
+	if r.store != nil {
+		record, err := json.Marshal(d)
+		if err != nil {
+			return Domain{}, err
+		}
+		if err := r.store.SetDomain(ctx, d.Host, string(record)); err != nil {
+			return Domain{}, err
+		}
+	}
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.domains[d.Host] = d
+	return d, nil
+}
+
+// Remove removes the domain of host saved by owner from the registry and from the store if any.
+// Links stored in its keyspace are kept and served again if the domain is registered anew. It
+// returns ErrNotOwner if the domain was saved by another owner or was registered with Register.
+func (r *Registry) Remove(ctx context.Context, host, owner string) error {
+	host, err := NormalizeHost(host)
+	if err != nil {
+		return ErrNotFound
+	}
+	r.w.Lock()
+	defer r.w.Unlock()
+	if err := r.checkOwner(host, owner); err != nil {
+		return err
+	}
+	if r.store != nil {
+		if err := r.store.DeleteDomain(ctx, host); err != nil {
+			return err
+		}
+	}
+	r.m.Lock()
+	defer r.m.Unlock()
+	delete(r.domains, host)
+	return nil
+}
+
+// checkOwner returns ErrNotFound if host is not registered and ErrNotOwner if it was not saved by
+// owner. Domains registered with Register are owned by the configuration only.
+func (r *Registry) checkOwner(host, owner string) error {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	d, found := r.domains[host]
+	if !found {
+		return ErrNotFound
+	}
+	if _, static := r.static[host]; static || d.Owner != owner {
+		return ErrNotOwner
+	}
+	return nil
+}
+
+// Load sets the store of the registry and replaces the saved domains with those read from it.
+// Domains added with Register are kept, unless the store has a record for the same host. Records
+// that cannot be decoded or are no longer valid are skipped.
+func (r *Registry) Load(ctx context.Context, s Store) error {
+	r.w.Lock()
+	defer r.w.Unlock()
+	records, err := s.Domains(ctx)
+	if err != nil {
+		return err
+	}
+	r.store = s
+
+	r.m.Lock()
+	defer r.m.Unlock()
+	domains := make(map[string]Domain, len(r.static)+len(records))
+	for host, d := range r.static {
+		domains[host] = d
+	}
+	for host, record := range records {
+		var d Domain
+		if err := json.Unmarshal([]byte(record), &d); err != nil {
+			continue
+		}
+		if d, err = normalize(d); err != nil || d.Host != host {
+			continue
+		}
+		domains[host] = d
+	}
+	r.domains = domains
+	return nil
+}
+
+// Run loads the domains from s every interval until ctx is done, so that the domains saved or
+// removed by other replicas are picked up. Errors are ignored, the last loaded domains being kept.
+func (r *Registry) Run(ctx context.Context, s Store, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = r.Load(ctx, s)
+		}
+	}
+}
+
+// normalize normalizes the host of d and validates its not found settings
+func normalize(d Domain) (Domain, error) {
+	host, err := NormalizeHost(d.Host)
+	if err != nil {
+		return Domain{}, err
+	}
+	if err := d.Validate(); err != nil {
+		return Domain{}, err
+	}
+	d.Host = host
+	return d, nil
+}
+
+// Lookup returns the domain registered for host, which may include a port
+func (r *Registry) Lookup(host string) (Domain, bool) {
+	host, err := NormalizeHost(host)
+	if err != nil {
+		return Domain{}, false
+	}
+	r.m.RLock()
+	defer r.m.RUnlock()
+	d, found := r.domains[host]
+	return d, found
+}
+
+// List returns the registered domains sorted by host
+func (r *Registry) List() []Domain {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	list := make([]Domain, 0, len(r.domains))
+	for _, d := range r.domains {
+		list = append(list, d)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Host < list[j].Host })
+	return list
+}
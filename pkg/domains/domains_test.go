@@ -0,0 +1,224 @@
+package domains
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/giannimassi/shorturl/pkg/validation"
+)
+
+func TestNormalizeHost(t *testing.T) {
+	tests := []struct {
+		host     string
+		expected string
+		code     string
+	}{
+		{host: "go.company", expected: "go.company"},
+		{host: "Links.Brand:8080", expected: "links.brand"},
+		{host: "links.brand.", expected: "links.brand"},
+		{host: "bücher.example", expected: "xn--bcher-kva.example"},
+		{host: "", code: validation.CodeEmpty},
+		{host: "a/b", code: validation.CodeInvalidHost},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			host, err := NormalizeHost(tt.host)
+			if tt.code != "" {
+				var vErr *validation.Error
+				if !errors.As(err, &vErr) || vErr.Code != tt.code {
+					t.Fatalf("expected %s error, got %v", tt.code, err)
+				}
+				return
+			}
+			if err != nil || host != tt.expected {
+				t.Errorf("got %q, %v want %q", host, err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestScopedKey(t *testing.T) {
+	if k := ScopedKey("", "abc"); k != "abc" {
+		t.Errorf("default domain keys should not be scoped, got %q", k)
+	}
+	k := ScopedKey("go.company", "abc")
+	if host, key := SplitKey(k); host != "go.company" || key != "abc" {
+		t.Errorf("unexpected split of %q: %q %q", k, host, key)
+	}
+	if host, key := SplitKey("abc"); host != "" || key != "abc" {
+		t.Errorf("unexpected split of default domain key: %q %q", host, key)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	if _, err := r.Register(Domain{Host: "Links.Brand", FallbackURL: "https://brand.example"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Register(Domain{Host: "go.company"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Register(Domain{}); err == nil {
+		t.Error("expected empty host to be rejected")
+	}
+	if _, err := r.Register(Domain{Host: "x.brand", NotFound: NotFoundRedirect}); err == nil {
+		t.Error("expected redirect mode without fallback url to be rejected")
+	}
+	if _, err := r.Register(Domain{Host: "x.brand", NotFound: "teapot"}); err == nil {
+		t.Error("expected unknown not found mode to be rejected")
+	}
+
+	d, found := r.Lookup("links.brand:443")
+	if !found || d.FallbackURL != "https://brand.example" {
+		t.Errorf("unexpected lookup result: %+v %v", d, found)
+	}
+	if _, found := r.Lookup("other.example"); found {
+		t.Error("unexpected domain found")
+	}
+	if list := r.List(); len(list) != 2 || list[0].Host != "go.company" || list[1].Host != "links.brand" {
+		t.Errorf("unexpected list: %+v", list)
+	}
+
+	// domains configured at startup cannot be replaced nor removed, saved domains only by their owner
+	ctx := context.Background()
+	if _, err := r.Save(ctx, Domain{Host: "go.company"}); !errors.Is(err, ErrNotOwner) {
+		t.Errorf("expected ErrNotOwner replacing a configured domain, got %v", err)
+	}
+	if err := r.Remove(ctx, "go.company", ""); !errors.Is(err, ErrNotOwner) {
+		t.Errorf("expected ErrNotOwner removing a configured domain, got %v", err)
+	}
+	if _, err := r.Save(ctx, Domain{Host: "team.brand", Owner: "team1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Save(ctx, Domain{Host: "team.brand", Owner: "team2"}); !errors.Is(err, ErrNotOwner) {
+		t.Errorf("expected ErrNotOwner replacing another owner's domain, got %v", err)
+	}
+	if _, err := r.Save(ctx, Domain{Host: "team.brand", Owner: "team1", Brand: "Team"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Remove(ctx, "team.brand", ""); !errors.Is(err, ErrNotOwner) {
+		t.Errorf("expected ErrNotOwner removing another owner's domain, got %v", err)
+	}
+	if err := r.Remove(ctx, "team.brand", "team1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Remove(ctx, "team.brand", "team1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+// mapStore is a Store keeping the records in a map
+type mapStore struct {
+	m       sync.Mutex
+	records map[string]string
+	err     error
+}
+
+func (s *mapStore) Domains(context.Context) (map[string]string, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	records := make(map[string]string, len(s.records))
+	for host, record := range s.records {
+		records[host] = record
+	}
+	return records, nil
+}
+
+func (s *mapStore) SetDomain(_ context.Context, host, record string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.records[host] = record
+	return nil
+}
+
+func (s *mapStore) DeleteDomain(_ context.Context, host string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	delete(s.records, host)
+	return nil
+}
+
+func TestRegistry_Load(t *testing.T) {
+	ctx := context.Background()
+	store := &mapStore{records: map[string]string{
+		"links.brand": `{"Host":"links.brand","FallbackURL":"https://brand.example"}`,
+		"bad.brand":   `{"Host":"bad.brand","NotFound":"teapot"}`,
+		"garbage":     `{`,
+	}}
+
+	// domains configured at startup are kept, those registered through a replica are persisted
+	r := NewRegistry()
+	if _, err := r.Register(Domain{Host: "go.company"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Load(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+	if list := r.List(); len(list) != 2 || list[0].Host != "go.company" || list[1].FallbackURL != "https://brand.example" {
+		t.Errorf("unexpected list after load: %+v", list)
+	}
+	if _, err := r.Save(ctx, Domain{Host: "New.Brand", Brand: "New"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Remove(ctx, "links.brand", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// a restarted replica sees the same domains
+	restarted := NewRegistry()
+	if _, err := restarted.Register(Domain{Host: "go.company"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := restarted.Load(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(restarted.List(), r.List()) {
+		t.Errorf("unexpected list after restart: %+v, want %+v", restarted.List(), r.List())
+	}
+	if d, found := restarted.Lookup("new.brand"); !found || d.Brand != "New" {
+		t.Errorf("unexpected saved domain: %+v %v", d, found)
+	}
+
+	// failed writes leave the registry unchanged, failed loads keep the last domains
+	store.err = errors.New("unavailable")
+	if _, err := r.Save(ctx, Domain{Host: "other.brand"}); err == nil {
+		t.Error("expected the store error")
+	}
+	if err := r.Remove(ctx, "new.brand", ""); err == nil {
+		t.Error("expected the store error")
+	}
+	if err := r.Load(ctx, store); err == nil {
+		t.Error("expected the store error")
+	}
+	if list := r.List(); len(list) != 2 || list[1].Host != "new.brand" {
+		t.Errorf("unexpected list after failures: %+v", list)
+	}
+}
+
+func TestDomain_OnNotFound(t *testing.T) {
+	tests := []struct {
+		d        Domain
+		expected NotFoundMode
+	}{
+		{d: Domain{}, expected: NotFoundPlain},
+		{d: Domain{FallbackURL: "https://example.org"}, expected: NotFoundRedirect},
+		{d: Domain{NotFound: NotFoundPage, FallbackURL: "https://example.org"}, expected: NotFoundPage},
+	}
+	for _, tt := range tests {
+		if mode := tt.d.OnNotFound(); mode != tt.expected {
+			t.Errorf("%+v: got %v want %v", tt.d, mode, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+// Package geo resolves the country of IP addresses
+package geo
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ErrUnknown is returned when the country of an address is not known
+var ErrUnknown = errors.New("geo: unknown address")
+
+// Resolver returns the ISO 3166-1 alpha-2 code of the country of an IP address, in upper case
+type Resolver interface {
+	Country(ip net.IP) (string, error)
+}
+
+// ipRange is an inclusive range of addresses, stored in their 16 byte form
+type ipRange struct {
+	start, end net.IP
+	country    string
+}
+
+// Database is a Resolver backed by a list of address ranges loaded in memory
+type Database struct {
+	ranges []ipRange // sorted by start, not overlapping
+}
+
+// LoadDatabase reads the database file at path, in the format accepted by ReadDatabase
+func LoadDatabase(path string) (*Database, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening geo database: %w", err)
+	}
+	defer f.Close()
+	return ReadDatabase(f)
+}
+
+// ReadDatabase reads a list of address ranges from r, one per line as comma separated values:
+// either "cidr,country" or "first address,last address,country", as in the freely available
+// country databases. IPv4 and IPv6 ranges can be mixed. Empty lines and lines starting with '#'
+// are ignored, as are double quotes around values. Ranges must not overlap.
+func ReadDatabase(r io.Reader) (*Database, error) {
+	db := &Database{}
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rng, err := parseRange(line)
+		if err != nil {
+			return nil, fmt.Errorf("geo database line %d: %w", n, err)
+		}
+		db.ranges = append(db.ranges, rng)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("reading geo database: %w", err)
+	}
+
+	sort.Slice(db.ranges, func(i, j int) bool {
+		return bytes.Compare(db.ranges[i].start, db.ranges[j].start) < 0
+	})
+	for i := 1; i < len(db.ranges); i++ {
+		if bytes.Compare(db.ranges[i].start, db.ranges[i-1].end) <= 0 {
+			return nil, fmt.Errorf("geo database: range starting at %v overlaps the one starting at %v", db.ranges[i].start, db.ranges[i-1].start)
+		}
+	}
+	return db, nil
+}
+
+// Len returns the number of ranges in the database
+func (db *Database) Len() int {
+	return len(db.ranges)
+}
+
+// Country implements Resolver
+func (db *Database) Country(ip net.IP) (string, error) {
+	ip = ip.To16()
+	if ip == nil {
+		return "", ErrUnknown
+	}
+	// the first range starting after ip is preceded by the only one that may contain it
+	i := sort.Search(len(db.ranges), func(i int) bool {
+		return bytes.Compare(db.ranges[i].start, ip) > 0
+	})
+	if i == 0 || bytes.Compare(ip, db.ranges[i-1].end) > 0 {
+		return "", ErrUnknown
+	}
+	return db.ranges[i-1].country, nil
+}
+
+func parseRange(line string) (ipRange, error) {
+	fields := strings.Split(line, ",")
+	for i, f := range fields {
+		fields[i] = strings.Trim(strings.TrimSpace(f), `"`)
+	}
+	var rng ipRange
+	switch len(fields) {
+	case 2:
+		_, network, err := net.ParseCIDR(fields[0])
+		if err != nil {
+			return rng, err
+		}
+		rng.start = network.IP.To16()
+		rng.end = make(net.IP, net.IPv6len)
+		// the mask of IPv4 networks is 4 bytes long and applies to the last 4 bytes of the address
+		offset := net.IPv6len - len(network.Mask)
+		for i := range rng.end {
+			rng.end[i] = rng.start[i]
+			if i >= offset {
+				rng.end[i] |= ^network.Mask[i-offset]
+			}
+		}
+	case 3:
+		rng.start, rng.end = net.ParseIP(fields[0]).To16(), net.ParseIP(fields[1]).To16()
+		if rng.start == nil || rng.end == nil {
+			return rng, fmt.Errorf("malformed address range %s-%s", fields[0], fields[1])
+		}
+		if (rng.start.To4() == nil) != (rng.end.To4() == nil) || bytes.Compare(rng.start, rng.end) > 0 {
+			return rng, fmt.Errorf("invalid address range %s-%s", fields[0], fields[1])
+		}
+	default:
+		return rng, fmt.Errorf("expected 2 or 3 fields, got %d", len(fields))
+	}
+
+	rng.country = strings.ToUpper(fields[len(fields)-1])
+	if !ValidCountry(rng.country) {
+		return rng, fmt.Errorf("malformed country code %q", fields[len(fields)-1])
+	}
+	return rng, nil
+}
+
+// ValidCountry returns true if code is made of two ASCII letters in upper case
+func ValidCountry(code string) bool {
+	if len(code) != 2 {
+		return false
+	}
+	for i := 0; i < len(code); i++ {
+		if code[i] < 'A' || code[i] > 'Z' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,67 @@
+package geo
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+const testDatabase = `# sample ranges
+2.16.0.0/13,IT
+"5.0.0.0","5.0.0.255","de"
+2001:db8::/32,FR
+`
+
+func TestDatabase_Country(t *testing.T) {
+	db, err := ReadDatabase(strings.NewReader(testDatabase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.Len() != 3 {
+		t.Fatalf("wrong number of ranges: %d", db.Len())
+	}
+
+	tests := []struct {
+		ip      string
+		country string
+	}{
+		{ip: "2.16.0.0", country: "IT"},
+		{ip: "2.23.255.255", country: "IT"},
+		{ip: "2.24.0.0"},
+		{ip: "5.0.0.17", country: "DE"},
+		{ip: "4.255.255.255"},
+		{ip: "2001:db8:1::1", country: "FR"},
+		{ip: "2001:db9::1"},
+		{ip: "::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			country, err := db.Country(net.ParseIP(tt.ip))
+			if tt.country == "" {
+				if !errors.Is(err, ErrUnknown) {
+					t.Errorf("expected ErrUnknown, got %q %v", country, err)
+				}
+				return
+			}
+			if err != nil || country != tt.country {
+				t.Errorf("got %q %v want %q", country, err, tt.country)
+			}
+		})
+	}
+}
+
+func TestReadDatabase_errors(t *testing.T) {
+	for _, data := range []string{
+		"2.16.0.0/33,IT",
+		"5.0.0.255,5.0.0.0,DE",
+		"5.0.0.0,2001:db8::1,DE",
+		"5.0.0.0/24,ITA",
+		"5.0.0.0/24",
+		"5.0.0.0/16,IT\n5.0.1.0/24,DE",
+	} {
+		if _, err := ReadDatabase(strings.NewReader(data)); err == nil {
+			t.Errorf("expected an error reading %q", data)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+// Package linktemplate implements url templates with positional placeholders, e.g.
+// https://jira.example/browse/{1}, expanded with the path segments following the key of a link
+package linktemplate
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// MaxPlaceholders is the highest placeholder index allowed in a template
+const MaxPlaceholders = 9
+
+// ErrArguments is returned by Expand when the number of arguments does not match the template
+var ErrArguments = errors.New("linktemplate: wrong number of arguments")
+
+// part is either a literal piece of the template or a placeholder
+type part struct {
+	literal string
+	index   int // 1-based index of the placeholder, 0 for literals
+	query   bool
+}
+
+// Template is a parsed url template
+type Template struct {
+	raw   string
+	parts []part
+	arity int
+}
+
+// Parse parses raw, in which {1} to {9} are replaced by the arguments of Expand. Placeholders must be
+// numbered from 1 without gaps and may appear in the path, query and fragment but not in the scheme
+// or host, so that expanded urls always point to the same host. Literal braces are not allowed.
+func Parse(raw string) (*Template, error) {
+	t := &Template{raw: raw}
+	used := make(map[int]bool)
+	query := false
+	rest := raw
+	for rest != "" {
+		open := strings.IndexAny(rest, "{}")
+		if open < 0 {
+			t.parts = append(t.parts, part{literal: rest})
+			break
+		}
+		if open > 0 {
+			literal := rest[:open]
+			t.parts = append(t.parts, part{literal: literal})
+			query = query || strings.ContainsAny(literal, "?#")
+		}
+		rest = rest[open:]
+		if len(rest) < 3 || rest[0] != '{' || rest[2] != '}' || rest[1] < '1' || rest[1] > '0'+MaxPlaceholders {
+			return nil, fmt.Errorf("malformed placeholder at %q, want {1} to {%d}", truncate(rest, 4), MaxPlaceholders)
+		}
+		index := int(rest[1] - '0')
+		used[index] = true
+		if index > t.arity {
+			t.arity = index
+		}
+		t.parts = append(t.parts, part{index: index, query: query})
+		rest = rest[3:]
+	}
+	if t.arity == 0 {
+		return nil, errors.New("template has no placeholders")
+	}
+	for i := 1; i <= t.arity; i++ {
+		if !used[i] {
+			return nil, fmt.Errorf("placeholder {%d} is missing", i)
+		}
+	}
+
+	// placeholders in the scheme or host would change the authority of the expanded urls
+	a, err := t.expand(sampleArgs(t.arity, "a"))
+	if err != nil {
+		return nil, err
+	}
+	b, err := t.expand(sampleArgs(t.arity, "b"))
+	if err != nil {
+		return nil, err
+	}
+	if a.Scheme != b.Scheme || a.User.String() != b.User.String() || a.Host != b.Host {
+		return nil, errors.New("placeholders are only allowed in the path, query and fragment")
+	}
+	return t, nil
+}
+
+// Arity returns the number of arguments of the template
+func (t *Template) Arity() int {
+	return t.arity
+}
+
+// String returns the template as parsed
+func (t *Template) String() string {
+	return t.raw
+}
+
+// Expand returns the url obtained replacing each placeholder with its argument. Arguments are
+// escaped so that they cannot alter the structure of the url: slashes are escaped in the path, and
+// ampersands and equal signs in the query.
+func (t *Template) Expand(args ...string) (*url.URL, error) {
+	if len(args) != t.arity {
+		return nil, fmt.Errorf("%w: got %d want %d", ErrArguments, len(args), t.arity)
+	}
+	return t.expand(args)
+}
+
+// Base returns the url obtained cutting the template at its first placeholder, e.g.
+// https://jira.example/browse/ for https://jira.example/browse/{1}, used when a link is requested
+// without arguments
+func (t *Template) Base() (*url.URL, error) {
+	var b strings.Builder
+	for _, p := range t.parts {
+		if p.index != 0 {
+			break
+		}
+		b.WriteString(p.literal)
+	}
+	u, err := url.Parse(b.String())
+	if err != nil {
+		return nil, fmt.Errorf("linktemplate: base url is malformed: %w", err)
+	}
+	return u, nil
+}
+
+func (t *Template) expand(args []string) (*url.URL, error) {
+	var b strings.Builder
+	for _, p := range t.parts {
+		switch {
+		case p.index == 0:
+			b.WriteString(p.literal)
+		case p.query:
+			b.WriteString(url.QueryEscape(args[p.index-1]))
+		default:
+			b.WriteString(url.PathEscape(args[p.index-1]))
+		}
+	}
+	u, err := url.Parse(b.String())
+	if err != nil {
+		return nil, fmt.Errorf("linktemplate: expanded url is malformed: %w", err)
+	}
+	return u, nil
+}
+
+func sampleArgs(n int, value string) []string {
+	args := make([]string, n)
+	for i := range args {
+		args[i] = value
+	}
+	return args
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
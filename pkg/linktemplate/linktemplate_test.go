@@ -0,0 +1,75 @@
+package linktemplate
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		raw   string
+		arity int
+		ok    bool
+	}{
+		{raw: "https://jira.example/browse/{1}", arity: 1, ok: true},
+		{raw: "https://github.com/{1}/{2}/issues?q={3}", arity: 3, ok: true},
+		{raw: "https://example.org/{2}/{1}/{1}", arity: 2, ok: true},
+		{raw: "https://example.org/", ok: false},
+		{raw: "https://example.org/{2}", ok: false},
+		{raw: "https://example.org/{0}", ok: false},
+		{raw: "https://example.org/{10}", ok: false},
+		{raw: "https://example.org/{a}", ok: false},
+		{raw: "https://example.org/{1", ok: false},
+		{raw: "https://example.org/}", ok: false},
+		{raw: "https://{1}.example.org/", ok: false},
+		{raw: "https://example.org{1}", ok: false},
+		{raw: "{1}://example.org/", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			tmpl, err := Parse(tt.raw)
+			if (err == nil) != tt.ok {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if tt.ok && tmpl.Arity() != tt.arity {
+				t.Errorf("wrong arity: got %d want %d", tmpl.Arity(), tt.arity)
+			}
+		})
+	}
+}
+
+func TestTemplate_Expand(t *testing.T) {
+	tests := []struct {
+		raw      string
+		args     []string
+		expected string
+	}{
+		{raw: "https://jira.example/browse/{1}", args: []string{"ABC-123"}, expected: "https://jira.example/browse/ABC-123"},
+		{raw: "https://example.org/{1}", args: []string{"../a/b?c"}, expected: "https://example.org/..%2Fa%2Fb%3Fc"},
+		{raw: "https://example.org/search?q={1}&lang=en", args: []string{"a&lang=it b"}, expected: "https://example.org/search?q=a%26lang%3Dit+b&lang=en"},
+		{raw: "https://github.com/{1}/{2}", args: []string{"org", "repo"}, expected: "https://github.com/org/repo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			tmpl, err := Parse(tt.raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			u, err := tmpl.Expand(tt.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u.String() != tt.expected {
+				t.Errorf("got %v want %v", u, tt.expected)
+			}
+		})
+	}
+
+	tmpl, _ := Parse("https://github.com/{1}/{2}")
+	if _, err := tmpl.Expand("org"); !errors.Is(err, ErrArguments) {
+		t.Errorf("expected ErrArguments, got %v", err)
+	}
+	if base, err := tmpl.Base(); err != nil || base.String() != "https://github.com/" {
+		t.Errorf("unexpected base url: %v %v", base, err)
+	}
+}
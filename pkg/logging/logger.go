@@ -0,0 +1,160 @@
+// Package logging implements a leveled logger writing one JSON object per line
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Level is the severity of a log record
+type Level int
+
+// Supported levels, in increasing order of severity
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel returns the level with the provided name, e.g. "info"
+func ParseLevel(name string) (Level, error) {
+	for i, n := range levelNames {
+		if strings.EqualFold(n, name) {
+			return Level(i), nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", name)
+}
+
+// Logger writes structured records as JSON lines. Fields are passed as alternating keys and values.
+// A Logger is safe for concurrent use.
+type Logger struct {
+	out    *output
+	level  Level
+	fields []interface{}
+
+	sampleEvery uint64
+	sampled     *uint64
+}
+
+// output serializes writes of records from a Logger and all the loggers derived from it
+type output struct {
+	m   sync.Mutex
+	w   io.Writer
+	now func() time.Time
+}
+
+// New returns a Logger writing records with a severity of at least level to w
+func New(w io.Writer, level Level) *Logger {
+	return &Logger{out: &output{w: w, now: time.Now}, level: level}
+}
+
+// Discard returns a Logger that drops all records
+func Discard() *Logger {
+	return New(ioutil.Discard, LevelError+1)
+}
+
+// With returns a Logger adding the provided fields to every record
+func (l *Logger) With(kv ...interface{}) *Logger {
+	cp := *l
+	cp.fields = append(append([]interface{}(nil), l.fields...), kv...)
+	return &cp
+}
+
+// Sample returns a Logger writing only one out of every n records below LevelWarn.
+// Records at LevelWarn and above are always written.
+func (l *Logger) Sample(n int) *Logger {
+	cp := *l
+	cp.sampleEvery = uint64(n)
+	cp.sampled = new(uint64)
+	return &cp
+}
+
+// Enabled returns true if records with the provided level are written
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level
+}
+
+// Debug writes a record with LevelDebug
+func (l *Logger) Debug(msg string, kv ...interface{}) { l.Log(LevelDebug, msg, kv...) }
+
+// Info writes a record with LevelInfo
+func (l *Logger) Info(msg string, kv ...interface{}) { l.Log(LevelInfo, msg, kv...) }
+
+// Warn writes a record with LevelWarn
+func (l *Logger) Warn(msg string, kv ...interface{}) { l.Log(LevelWarn, msg, kv...) }
+
+// Error writes a record with LevelError
+func (l *Logger) Error(msg string, kv ...interface{}) { l.Log(LevelError, msg, kv...) }
+
+// Log writes a record with the provided level, message and fields
+func (l *Logger) Log(level Level, msg string, kv ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	if l.sampleEvery > 1 && level < LevelWarn && (atomic.AddUint64(l.sampled, 1)-1)%l.sampleEvery != 0 {
+		return
+	}
+
+	buf := bytes.Buffer{}
+	buf.WriteString(`{"time":`)
+	writeValue(&buf, l.out.now().UTC().Format(time.RFC3339Nano))
+	buf.WriteString(`,"level":`)
+	writeValue(&buf, level.String())
+	buf.WriteString(`,"msg":`)
+	writeValue(&buf, msg)
+	writeFields(&buf, l.fields)
+	writeFields(&buf, kv)
+	buf.WriteString("}\n")
+
+	l.out.m.Lock()
+	defer l.out.m.Unlock()
+	_, _ = l.out.w.Write(buf.Bytes())
+}
+
+func writeFields(buf *bytes.Buffer, kv []interface{}) {
+	for i := 0; i < len(kv); i += 2 {
+		key := fmt.Sprint(kv[i])
+		var v interface{} = "(missing)"
+		if i+1 < len(kv) {
+			v = kv[i+1]
+		}
+		buf.WriteByte(',')
+		writeValue(buf, key)
+		buf.WriteByte(':')
+		writeValue(buf, v)
+	}
+}
+
+func writeValue(buf *bytes.Buffer, v interface{}) {
+	switch tv := v.(type) {
+	case error:
+		v = tv.Error()
+	case time.Duration:
+		v = tv.Seconds()
+	case fmt.Stringer:
+		v = tv.String()
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprint(v))
+	}
+	buf.Write(b)
+}
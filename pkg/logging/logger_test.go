@@ -0,0 +1,89 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLogger(level Level) (*Logger, *bytes.Buffer) {
+	buf := &bytes.Buffer{}
+	l := New(buf, level)
+	l.out.now = func() time.Time { return time.Date(2020, 7, 30, 10, 0, 0, 0, time.UTC) }
+	return l, buf
+}
+
+func records(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var recs []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		rec := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("invalid record %q: %v", line, err)
+		}
+		recs = append(recs, rec)
+	}
+	return recs
+}
+
+func TestLogger(t *testing.T) {
+	l, buf := newTestLogger(LevelInfo)
+	l.Debug("hidden")
+	l.With("component", "test").Info("hello", "key", "a", "latency", 1500*time.Millisecond, "err", errors.New("boom"), "odd")
+	l.Error("failed", "status", 500)
+
+	expected := `{"time":"2020-07-30T10:00:00Z","level":"info","msg":"hello","component":"test","key":"a","latency":1.5,"err":"boom","odd":"(missing)"}
+{"time":"2020-07-30T10:00:00Z","level":"error","msg":"failed","status":500}
+`
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", buf.String(), expected)
+	}
+}
+
+func TestLogger_Sample(t *testing.T) {
+	l, buf := newTestLogger(LevelDebug)
+	sampled := l.Sample(3)
+	for i := 0; i < 7; i++ {
+		sampled.Info("sampled", "i", i)
+	}
+	sampled.Warn("always")
+	l.Info("not sampled")
+
+	recs := records(t, buf)
+	if len(recs) != 5 {
+		t.Fatalf("unexpected number of records: got %d, want 5\n%s", len(recs), buf.String())
+	}
+	for i, expected := range []float64{0, 3, 6} {
+		if recs[i]["i"] != expected {
+			t.Errorf("unexpected sampled record %d: %v", i, recs[i])
+		}
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, name := range []string{"debug", "INFO", "Warn", "error"} {
+		level, err := ParseLevel(name)
+		if err != nil || !strings.EqualFold(level.String(), name) {
+			t.Errorf("unexpected level for %s: %v (%v)", name, level, err)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Errorf("expected error for unknown level")
+	}
+}
+
+func TestContext(t *testing.T) {
+	l, buf := newTestLogger(LevelInfo)
+	FromContext(context.Background()).Error("dropped")
+	FromContext(NewContext(context.Background(), l)).Info("kept")
+	if recs := records(t, buf); len(recs) != 1 || recs[0]["msg"] != "kept" {
+		t.Errorf("unexpected records: %v", recs)
+	}
+}
@@ -0,0 +1,171 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/giannimassi/shorturl/pkg/storage"
+)
+
+// provider decorates a storage.Provider recording latency and outcome of every operation
+type provider struct {
+	storage.Forwarder
+	next    storage.Provider
+	backend string
+
+	latency    *Histogram
+	operations *Counter
+}
+
+// Bounds of the listing of the keys counted by the shorturl_keys gauge, which reads every key
+const (
+	keyCountTTL     = 30 * time.Second
+	keyCountTimeout = 5 * time.Second
+)
+
+// keyCounter counts the stored keys, caching the count for ttl so that frequent scrapes do not
+// list the keys every time
+type keyCounter struct {
+	p       storage.Provider
+	ttl     time.Duration
+	timeout time.Duration
+	now     func() time.Time
+
+	m       sync.Mutex
+	count   float64
+	at      time.Time
+	listing bool // The keys are being listed
+}
+
+// Count returns the number of stored keys, listing them if the cached count is older than ttl.
+// A single listing runs at a time, without holding the lock: concurrent scrapes get the last
+// count. The listing is given up after timeout, in which case the last count is returned.
+func (c *keyCounter) Count() float64 {
+	c.m.Lock()
+	now := c.now()
+	if c.listing || (!c.at.IsZero() && now.Sub(c.at) < c.ttl) {
+		defer c.m.Unlock()
+		return c.count
+	}
+	c.listing = true
+	c.m.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	keys, err := c.p.Keys(ctx)
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.listing = false
+	c.at = now
+	if err == nil {
+		c.count = float64(len(keys))
+	}
+	return c.count
+}
+
+// InstrumentProvider returns a storage.Provider recording metrics about the operations performed on p
+// in reg, labelled with the backend name. The number of stored keys is also exposed, refreshed at
+// most every keyCountTTL, as well as the number of pending hits if p implements storage.HitQueue.
+func InstrumentProvider(p storage.Provider, backend string, reg *Registry) storage.Provider {
+	keys := &keyCounter{p: p, ttl: keyCountTTL, timeout: keyCountTimeout, now: time.Now}
+	reg.NewGaugeFunc("shorturl_keys", "Number of keys currently stored.", keys.Count)
+	if q := storage.HitQueueOf(p); q != nil {
+		reg.NewGaugeFunc("shorturl_pending_hits", "Number of hits waiting to be aggregated by the storage backend.", func() float64 {
+			return float64(q.PendingHits())
+		})
+	}
+	ip := &provider{
+		next:    p,
+		backend: backend,
+		latency: reg.NewHistogram("shorturl_storage_operation_duration_seconds",
+			"Latency of storage operations.", DefBuckets, "backend", "method"),
+		operations: reg.NewCounter("shorturl_storage_operations_total",
+			"Number of storage operations by outcome.", "backend", "method", "outcome"),
+	}
+	ip.Forwarder = storage.Forwarder{Next: p, Wrap: ip.wrap}
+	return ip
+}
+
+func (p *provider) observe(method string, start time.Time, err error) {
+	p.latency.Observe(time.Since(start).Seconds(), p.backend, method)
+	p.operations.Inc(p.backend, method, outcome(err))
+}
+
+// outcome returns a label value describing err
+func outcome(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, storage.ErrKeyNotFound):
+		return "not_found"
+	case errors.Is(err, storage.ErrKeyAlreadyExists):
+		return "already_exists"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	default:
+		return "error"
+	}
+}
+
+func (p *provider) ShortURL(ctx context.Context, key string) (*url.URL, error) {
+	start := time.Now()
+	u, err := p.next.ShortURL(ctx, key)
+	p.observe("ShortURL", start, err)
+	return u, err
+}
+
+func (p *provider) AddURL(ctx context.Context, key string, u url.URL, md storage.Metadata) error {
+	start := time.Now()
+	err := p.next.AddURL(ctx, key, u, md)
+	p.observe("AddURL", start, err)
+	return err
+}
+
+func (p *provider) DeleteURL(ctx context.Context, key string) error {
+	start := time.Now()
+	err := p.next.DeleteURL(ctx, key)
+	p.observe("DeleteURL", start, err)
+	return err
+}
+
+func (p *provider) ShortURLInfo(ctx context.Context, key string) (*url.URL, int, error) {
+	start := time.Now()
+	u, hits, err := p.next.ShortURLInfo(ctx, key)
+	p.observe("ShortURLInfo", start, err)
+	return u, hits, err
+}
+
+func (p *provider) Metadata(ctx context.Context, key string) (storage.Metadata, error) {
+	start := time.Now()
+	md, err := p.next.Metadata(ctx, key)
+	p.observe("Metadata", start, err)
+	return md, err
+}
+
+func (p *provider) SetMetadata(ctx context.Context, key string, md storage.Metadata) error {
+	start := time.Now()
+	err := p.next.SetMetadata(ctx, key, md)
+	p.observe("SetMetadata", start, err)
+	return err
+}
+
+func (p *provider) Keys(ctx context.Context) ([]string, error) {
+	start := time.Now()
+	keys, err := p.next.Keys(ctx)
+	p.observe("Keys", start, err)
+	return keys, err
+}
+
+// wrap records the metrics of the optional operations forwarded by storage.Forwarder
+func (p *provider) wrap(ctx context.Context, method, _ string, call func(ctx context.Context) error) error {
+	start := time.Now()
+	err := call(ctx)
+	p.observe(method, start, err)
+	return err
+}
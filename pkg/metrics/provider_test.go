@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/giannimassi/shorturl/pkg/storage"
+)
+
+func TestInstrumentProvider(t *testing.T) {
+	ctx := context.Background()
+	reg := NewRegistry()
+	s := InstrumentProvider(storage.NewMemoryStore(), "memory", reg)
+	if err := s.AddURL(ctx, "a", mustMkURL("https://example.com/"), storage.Metadata{}); err != nil {
+		t.Fatal(err)
+	}
+	_ = s.AddURL(ctx, "a", mustMkURL("https://example.com/"), storage.Metadata{})
+	_, _ = s.ShortURL(ctx, "b")
+
+	buf := bytes.Buffer{}
+	if err := reg.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		`shorturl_keys 1`,
+		`shorturl_storage_operations_total{backend="memory",method="AddURL",outcome="ok"} 1`,
+		`shorturl_storage_operations_total{backend="memory",method="AddURL",outcome="already_exists"} 1`,
+		`shorturl_storage_operations_total{backend="memory",method="ShortURL",outcome="not_found"} 1`,
+		`shorturl_storage_operation_duration_seconds_count{backend="memory",method="AddURL"} 2`,
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected %q in metrics:\n%s", expected, buf.String())
+		}
+	}
+}
+
+func mustMkURL(str string) url.URL {
+	u, err := url.Parse(str)
+	if err != nil {
+		panic(err)
+	}
+	return *u
+}
+
+type pingerStore struct {
+	*storage.MemoryStore
+	err error
+}
+
+func (s pingerStore) Ping(ctx context.Context) error { return s.err }
+
+func TestInstrumentProvider_Ping(t *testing.T) {
+	ctx := context.Background()
+	pingErr := errors.New("unreachable")
+	p := InstrumentProvider(pingerStore{MemoryStore: storage.NewMemoryStore(), err: pingErr}, "mock", NewRegistry())
+	pinger, ok := p.(storage.Pinger)
+	if !ok {
+		t.Fatal("decorated provider should implement storage.Pinger")
+	}
+	if err := pinger.Ping(ctx); err != pingErr {
+		t.Errorf("unexpected ping error: %v", err)
+	}
+}
+
+// keysStore counts the calls to Keys, which block until ctx is done if block is set
+type keysStore struct {
+	*storage.MemoryStore
+	calls   int
+	block   bool
+	started chan struct{} // Receives a value when a blocking listing starts, if not nil
+}
+
+func (s *keysStore) Keys(ctx context.Context) ([]string, error) {
+	s.calls++
+	if s.block {
+		if s.started != nil {
+			s.started <- struct{}{}
+		}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return s.MemoryStore.Keys(ctx)
+}
+
+func TestKeyCounter(t *testing.T) {
+	ctx := context.Background()
+	s := &keysStore{MemoryStore: storage.NewMemoryStore()}
+	now := time.Date(2020, 7, 30, 10, 0, 0, 0, time.UTC)
+	c := &keyCounter{p: s, ttl: time.Minute, timeout: 10 * time.Millisecond, now: func() time.Time { return now }}
+
+	_ = s.AddURL(ctx, "a", mustMkURL("https://example.com/"), storage.Metadata{})
+	if n := c.Count(); n != 1 || s.calls != 1 {
+		t.Fatalf("unexpected count %v after %d calls", n, s.calls)
+	}
+	_ = s.AddURL(ctx, "b", mustMkURL("https://example.com/"), storage.Metadata{})
+	if n := c.Count(); n != 1 || s.calls != 1 {
+		t.Errorf("expected the cached count, got %v after %d calls", n, s.calls)
+	}
+	now = now.Add(time.Minute)
+	if n := c.Count(); n != 2 || s.calls != 2 {
+		t.Errorf("expected a new count, got %v after %d calls", n, s.calls)
+	}
+
+	// slow listings are given up, keeping the last count
+	s.block = true
+	now = now.Add(time.Minute)
+	if n := c.Count(); n != 2 || s.calls != 3 {
+		t.Errorf("expected the last count, got %v after %d calls", n, s.calls)
+	}
+
+	// scrapes during a listing get the last count without waiting for it
+	s.started = make(chan struct{})
+	c.timeout = 500 * time.Millisecond
+	now = now.Add(time.Minute)
+	listed := make(chan float64)
+	go func() { listed <- c.Count() }()
+	<-s.started
+	start := time.Now()
+	if n := c.Count(); n != 2 || time.Since(start) > c.timeout/2 {
+		t.Errorf("expected the last count without waiting, got %v after %v", n, time.Since(start))
+	}
+	if n := <-listed; n != 2 || s.calls != 4 {
+		t.Errorf("expected a single listing, got %v after %d calls", n, s.calls)
+	}
+}
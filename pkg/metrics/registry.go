@@ -0,0 +1,302 @@
+// Package metrics implements a minimal registry of counters, gauges and histograms
+// exposed in the Prometheus text format
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// contentType is the media type of the Prometheus text exposition format
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefBuckets are the default histogram buckets, in seconds, suited to request latencies
+var DefBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// collector is implemented by all metric families in the registry
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+// Registry holds a set of metrics and writes them in the Prometheus text format
+type Registry struct {
+	m          sync.Mutex
+	collectors []collector
+	names      map[string]struct{}
+}
+
+// NewRegistry returns an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]struct{})}
+}
+
+func (r *Registry) register(name string, c collector) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if _, found := r.names[name]; found {
+		panic(fmt.Sprintf("metrics: %s registered twice", name))
+	}
+	r.names[name] = struct{}{}
+	r.collectors = append(r.collectors, c)
+}
+
+// NewCounter registers and returns a counter with the provided label names
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{family: newFamily(name, help, "counter", labels)}
+	r.register(name, c)
+	return c
+}
+
+// NewGauge registers and returns a gauge with the provided label names
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{family: newFamily(name, help, "gauge", labels)}
+	r.register(name, g)
+	return g
+}
+
+// NewGaugeFunc registers a gauge without labels whose value is computed by f at collection time
+func (r *Registry) NewGaugeFunc(name, help string, f func() float64) {
+	r.register(name, &gaugeFunc{family: newFamily(name, help, "gauge", nil), f: f})
+}
+
+// NewHistogram registers and returns a histogram with the provided upper bounds and label names
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	bounds := append([]float64(nil), buckets...)
+	sort.Float64s(bounds)
+	h := &Histogram{family: newFamily(name, help, "histogram", labels), buckets: bounds}
+	r.register(name, h)
+	return h
+}
+
+// Write writes all metrics to w in the Prometheus text format
+func (r *Registry) Write(w io.Writer) error {
+	r.m.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.m.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Handler returns an http.Handler serving the metrics in the registry
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		_ = r.Write(w)
+	})
+}
+
+// family holds the series of a metric, indexed by their label values
+type family struct {
+	name, help, typ string
+	labels          []string
+
+	m      sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	counts      []uint64 // histogram only, one per bucket
+	count       uint64   // histogram only
+}
+
+func newFamily(name, help, typ string, labels []string) family {
+	return family{name: name, help: help, typ: typ, labels: labels, series: make(map[string]*series)}
+}
+
+// with returns the series for the provided label values, creating it if needed.
+// It must be called with f.m held.
+func (f *family) with(labelValues []string) *series {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.name, len(f.labels), len(labelValues)))
+	}
+	id := strings.Join(labelValues, "\xff")
+	s, found := f.series[id]
+	if !found {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		f.series[id] = s
+	}
+	return s
+}
+
+// sorted returns a copy of all series ordered by label values. It must be called with f.m held.
+func (f *family) sorted() []series {
+	all := make([]series, 0, len(f.series))
+	for _, s := range f.series {
+		cp := *s
+		cp.counts = append([]uint64(nil), s.counts...)
+		all = append(all, cp)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return strings.Join(all[i].labelValues, "\xff") < strings.Join(all[j].labelValues, "\xff")
+	})
+	return all
+}
+
+func (f *family) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, escapeHelp(f.help), f.name, f.typ)
+}
+
+func (f *family) writeSample(w *bufio.Writer, suffix string, labelValues []string, extraLabel, extraValue string, v float64) {
+	w.WriteString(f.name + suffix)
+	if len(labelValues) > 0 || extraLabel != "" {
+		w.WriteByte('{')
+		for i, l := range f.labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", l, escapeLabelValue(labelValues[i]))
+		}
+		if extraLabel != "" {
+			if len(labelValues) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", extraLabel, extraValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+// Counter is a metric that can only increase
+type Counter struct {
+	family
+}
+
+// Inc increments the counter for the provided label values by 1
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increments the counter for the provided label values by v, which must not be negative
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic("metrics: counters cannot decrease")
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.with(labelValues).value += v
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.writeHeader(w)
+	for _, s := range c.sorted() {
+		c.writeSample(w, "", s.labelValues, "", "", s.value)
+	}
+}
+
+// Gauge is a metric that can be set to arbitrary values
+type Gauge struct {
+	family
+}
+
+// Set sets the gauge for the provided label values to v
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.m.Lock()
+	defer g.m.Unlock()
+	g.with(labelValues).value = v
+}
+
+// Add adds v, which can be negative, to the gauge for the provided label values
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.m.Lock()
+	defer g.m.Unlock()
+	g.with(labelValues).value += v
+}
+
+// Delete removes the series for the provided label values
+func (g *Gauge) Delete(labelValues ...string) {
+	g.m.Lock()
+	defer g.m.Unlock()
+	delete(g.series, strings.Join(labelValues, "\xff"))
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.m.Lock()
+	defer g.m.Unlock()
+	g.writeHeader(w)
+	for _, s := range g.sorted() {
+		g.writeSample(w, "", s.labelValues, "", "", s.value)
+	}
+}
+
+type gaugeFunc struct {
+	family
+	f func() float64
+}
+
+func (g *gaugeFunc) write(w *bufio.Writer) {
+	g.writeHeader(w)
+	g.writeSample(w, "", nil, "", "", g.f())
+}
+
+// Histogram counts observations in configurable buckets
+type Histogram struct {
+	family
+	buckets []float64
+}
+
+// Observe adds v to the histogram for the provided label values
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	s := h.with(labelValues)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(h.buckets))
+	}
+	for i, bound := range h.buckets {
+		if v <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.value += v
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	h.writeHeader(w)
+	for _, s := range h.sorted() {
+		for i, bound := range h.buckets {
+			h.writeSample(w, "_bucket", s.labelValues, "le", formatFloat(bound), float64(s.counts[i]))
+		}
+		h.writeSample(w, "_bucket", s.labelValues, "le", "+Inf", float64(s.count))
+		h.writeSample(w, "_sum", s.labelValues, "", "", s.value)
+		h.writeSample(w, "_count", s.labelValues, "", "", float64(s.count))
+	}
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegistry_Write(t *testing.T) {
+	reg := NewRegistry()
+	c := reg.NewCounter("requests_total", "Requests served.", "code")
+	c.Inc("200")
+	c.Add(2, "404")
+	c.Inc("200")
+
+	g := reg.NewGauge("queue_depth", "Queue depth.", "queue")
+	g.Set(3, `a"b`)
+	g.Add(-1, `a"b`)
+	g.Set(1, "c")
+	g.Delete("c")
+
+	reg.NewGaugeFunc("keys", "Stored keys.", func() float64 { return 42 })
+
+	h := reg.NewHistogram("latency_seconds", "Latency.", []float64{1, 0.1}, "route")
+	h.Observe(0.05, "/")
+	h.Observe(0.5, "/")
+	h.Observe(5, "/")
+
+	buf := bytes.Buffer{}
+	if err := reg.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{code="200"} 2
+requests_total{code="404"} 2
+# HELP queue_depth Queue depth.
+# TYPE queue_depth gauge
+queue_depth{queue="a\"b"} 2
+# HELP keys Stored keys.
+# TYPE keys gauge
+keys 42
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/",le="0.1"} 1
+latency_seconds_bucket{route="/",le="1"} 2
+latency_seconds_bucket{route="/",le="+Inf"} 3
+latency_seconds_sum{route="/"} 5.55
+latency_seconds_count{route="/"} 3
+`
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", buf.String(), expected)
+	}
+
+	w := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Header().Get("Content-Type") != contentType || w.Body.String() != expected {
+		t.Errorf("unexpected response: %v\n%s", w.Header(), w.Body.String())
+	}
+}
+
+func TestRegistry_duplicate(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected panic on duplicate registration")
+		}
+	}()
+	reg := NewRegistry()
+	reg.NewCounter("a", "")
+	reg.NewGauge("a", "")
+}
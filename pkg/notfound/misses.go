@@ -0,0 +1,137 @@
+package notfound
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultTrackerSize is the number of missed keys tracked by NewTracker when none is specified
+const DefaultTrackerSize = 1000
+
+// Miss describes a key that has been requested without existing
+type Miss struct {
+	Host     string    // Domain of the key, empty for the default domain
+	Key      string    // Missed key
+	Count    int       // Number of requests of the key
+	LastSeen time.Time // Time of the last request of the key
+}
+
+type missID struct {
+	host, key string
+}
+
+// entry is a tracked miss along with its position in the eviction heap
+type entry struct {
+	Miss
+	index int
+}
+
+// evictionHeap is a min-heap of the tracked misses, the least missed first and the least recently
+// missed first among equals, implementing heap.Interface
+type evictionHeap []*entry
+
+func (h evictionHeap) Len() int { return len(h) }
+
+func (h evictionHeap) Less(i, j int) bool {
+	if h[i].Count != h[j].Count {
+		return h[i].Count < h[j].Count
+	}
+	return h[i].LastSeen.Before(h[j].LastSeen)
+}
+
+func (h evictionHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *evictionHeap) Push(x interface{}) {
+	e := x.(*entry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *evictionHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return e
+}
+
+// Tracker counts the requests of missing keys, safe for concurrent use. When full, the least
+// missed key is forgotten to make room for a new one, so that frequently missed keys are retained.
+type Tracker struct {
+	m        sync.Mutex
+	size     int
+	misses   map[missID]*entry
+	eviction evictionHeap
+	now      func() time.Time
+}
+
+// NewTracker returns a Tracker of up to size keys, or DefaultTrackerSize if size is not positive
+func NewTracker(size int) *Tracker {
+	if size <= 0 {
+		size = DefaultTrackerSize
+	}
+	return &Tracker{size: size, misses: make(map[missID]*entry), now: time.Now}
+}
+
+// Record counts a request of the missing key of host and returns the number of requests so far.
+// When full, the least missed key is forgotten, the least recently missed one among equals.
+func (t *Tracker) Record(host, key string) int {
+	t.m.Lock()
+	defer t.m.Unlock()
+	id := missID{host: host, key: key}
+	e, found := t.misses[id]
+	if !found {
+		if len(t.misses) >= t.size {
+			victim := heap.Pop(&t.eviction).(*entry)
+			delete(t.misses, missID{host: victim.Host, key: victim.Key})
+		}
+		e = &entry{Miss: Miss{Host: host, Key: key, Count: 1, LastSeen: t.now()}}
+		t.misses[id] = e
+		heap.Push(&t.eviction, e)
+		return e.Count
+	}
+	e.Count++
+	e.LastSeen = t.now()
+	heap.Fix(&t.eviction, e.index)
+	return e.Count
+}
+
+// Forget stops tracking the key of host, e.g. because it has been created
+func (t *Tracker) Forget(host, key string) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	id := missID{host: host, key: key}
+	if e, found := t.misses[id]; found {
+		heap.Remove(&t.eviction, e.index)
+		delete(t.misses, id)
+	}
+}
+
+// Top returns up to n of the most missed keys, the most missed first
+func (t *Tracker) Top(n int) []Miss {
+	t.m.Lock()
+	list := make([]Miss, 0, len(t.misses))
+	for _, e := range t.misses {
+		list = append(list, e.Miss)
+	}
+	t.m.Unlock()
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		if list[i].Host != list[j].Host {
+			return list[i].Host < list[j].Host
+		}
+		return list[i].Key < list[j].Key
+	})
+	if n > 0 && len(list) > n {
+		list = list[:n]
+	}
+	return list
+}
@@ -0,0 +1,102 @@
+package notfound
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSuggest(t *testing.T) {
+	candidates := []string{"wiki", "Wikis", "jira", "docs", "roadmap", "roadmap-2020"}
+	tests := []struct {
+		key      string
+		n        int
+		expected []string
+	}{
+		{key: "wik", n: 3, expected: []string{"wiki"}},
+		{key: "WIKI", n: 3, expected: []string{"wiki", "Wikis"}},
+		{key: "wikki", n: 3, expected: []string{"wiki"}},
+		{key: "wikis", n: 1, expected: []string{"Wikis"}},
+		{key: "raodmap", n: 3, expected: []string{"roadmap"}},
+		{key: "jira", n: 3, expected: nil},
+		{key: "zzz", n: 3, expected: nil},
+		{key: "wiki", n: 0, expected: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got := Suggest(tt.key, candidates, tt.n)
+			if len(got) == 0 && len(tt.expected) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("got %v want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"kitten", "sitting", 3},
+		{"wiki", "wikis", 1},
+	}
+	for _, tt := range tests {
+		if d := distance(tt.a, tt.b); d != tt.expected {
+			t.Errorf("distance(%q, %q) = %d want %d", tt.a, tt.b, d, tt.expected)
+		}
+	}
+}
+
+func TestTracker(t *testing.T) {
+	tr := NewTracker(2)
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tr.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	for i := 0; i < 3; i++ {
+		tr.Record("", "a")
+	}
+	tr.Record("go.company", "a")
+	if n := tr.Record("go.company", "a"); n != 2 {
+		t.Errorf("unexpected count: %d", n)
+	}
+	// the tracker is full: the least missed key is evicted
+	tr.Record("", "b")
+
+	top := tr.Top(0)
+	if len(top) != 2 || top[0].Key != "a" || top[0].Host != "" || top[0].Count != 3 || top[1].Key != "b" {
+		t.Fatalf("unexpected top misses: %+v", top)
+	}
+	if top := tr.Top(1); len(top) != 1 || top[0].Count != 3 {
+		t.Errorf("unexpected top miss: %+v", top)
+	}
+
+	tr.Forget("", "a")
+	if top := tr.Top(0); len(top) != 1 || top[0].Key != "b" {
+		t.Errorf("unexpected misses after forget: %+v", top)
+	}
+
+	// among keys missed as often, the least recently missed is evicted
+	tr = NewTracker(3)
+	tr.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	for _, key := range []string{"x", "y", "z", "x", "y", "z", "x"} {
+		tr.Record("", key)
+	}
+	tr.Forget("", "x")
+	tr.Record("", "w")
+	tr.Record("", "w")
+	tr.Record("", "v")
+	if top := tr.Top(0); len(top) != 3 || top[0].Key != "w" || top[1].Key != "z" || top[2].Key != "v" {
+		t.Errorf("unexpected misses after evicting among equals: %+v", top)
+	}
+}
@@ -0,0 +1,91 @@
+// Package notfound helps visitors and operators dealing with short links that do not exist: it
+// suggests similar keys and keeps track of the keys missed most often
+package notfound
+
+import "sort"
+
+// Suggest returns up to n candidates similar to key, the closest first. Candidates are similar if
+// their edit distance from key, ignoring case, is at most a third of the length of key, and at
+// least one.
+func Suggest(key string, candidates []string, n int) []string {
+	if n <= 0 || key == "" {
+		return nil
+	}
+	max := len(key) / 3
+	if max < 1 {
+		max = 1
+	}
+	type match struct {
+		key      string
+		distance int
+	}
+	var matches []match
+	lower := toLower(key)
+	for _, c := range candidates {
+		if c == key {
+			continue
+		}
+		if d := distance(lower, toLower(c)); d <= max {
+			matches = append(matches, match{key: c, distance: d})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		return matches[i].key < matches[j].key
+	})
+	if len(matches) > n {
+		matches = matches[:n]
+	}
+	keys := make([]string, len(matches))
+	for i, m := range matches {
+		keys[i] = m.key
+	}
+	return keys
+}
+
+// distance returns the Levenshtein distance between a and b, counting bytes since keys are ASCII
+func distance(a, b string) int {
+	if len(a) < len(b) {
+		a, b = b, a
+	}
+	row := make([]int, len(b)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		prev := row[0]
+		row[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur := min3(row[j]+1, row[j-1]+1, prev+cost)
+			prev, row[j] = row[j], cur
+		}
+	}
+	return row[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// toLower lowercases the ASCII letters of s
+func toLower(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if 'A' <= c && c <= 'Z' {
+			b[i] = c + 'a' - 'A'
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,77 @@
+// Package password hashes and verifies the passwords protecting links with PBKDF2-HMAC-SHA256
+package password
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// DefaultIterations is the number of PBKDF2 iterations used by Hash
+const DefaultIterations = 100000
+
+// scheme identifies the encoding of the hashes returned by Hash
+const scheme = "pbkdf2-sha256"
+
+const (
+	saltLen = 16
+	keyLen  = sha256.Size
+)
+
+// Errors returned by Verify
+var (
+	ErrMismatch      = errors.New("password: mismatch")
+	ErrMalformedHash = errors.New("password: malformed hash")
+)
+
+// Hash returns the hash of password with a random salt, encoded as
+// pbkdf2-sha256$<iterations>$<salt>$<key> with the salt and key in unpadded base64
+func Hash(password string) (string, error) {
+	return hashIterations(password, DefaultIterations)
+}
+
+func hashIterations(password string, iterations int) (string, error) {
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("password: generating salt: %w", err)
+	}
+	key := pbkdf2.Key([]byte(password), salt, iterations, keyLen, sha256.New)
+	return strings.Join([]string{
+		scheme,
+		strconv.Itoa(iterations),
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	}, "$"), nil
+}
+
+// Verify returns nil if password matches the hash encoded by Hash, comparing the derived keys in
+// constant time
+func Verify(encoded, password string) error {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != scheme {
+		return ErrMalformedHash
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return ErrMalformedHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return ErrMalformedHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(key) == 0 {
+		return ErrMalformedHash
+	}
+	if subtle.ConstantTimeCompare(pbkdf2.Key([]byte(password), salt, iterations, len(key), sha256.New), key) != 1 {
+		return ErrMismatch
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestVerify_vectors(t *testing.T) {
+	// test vectors of PBKDF2-HMAC-SHA256 for password "password" and salt "salt", so that hashes
+	// stored by previous versions keep verifying
+	for _, encoded := range []string{
+		"pbkdf2-sha256$1$c2FsdA$Eg+2z/z4syxD5yJSVsT4N6hlSMkszDVICAWYfLcL4Xs",
+		"pbkdf2-sha256$2$c2FsdA$rk0Mla9rRtMtCt/5KPBt0CowP47zwlHf1uLYWpVHTEM",
+		"pbkdf2-sha256$4096$c2FsdA$xeR41ZKIyEGqUw22hFxMjZYok6ABzk4RpJY4c6qYE0o",
+	} {
+		if err := Verify(encoded, "password"); err != nil {
+			t.Errorf("%s: unexpected err: %v", encoded, err)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	encoded, err := hashIterations("s3cret", 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encoded, "pbkdf2-sha256$1000$") {
+		t.Errorf("unexpected encoding: %s", encoded)
+	}
+	if other, _ := hashIterations("s3cret", 1000); other == encoded {
+		t.Error("hashes of the same password should have different salts")
+	}
+
+	if err := Verify(encoded, "s3cret"); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+	if err := Verify(encoded, "s3cret "); !errors.Is(err, ErrMismatch) {
+		t.Errorf("expected ErrMismatch, got %v", err)
+	}
+	for _, malformed := range []string{"", "s3cret", "bcrypt$10$a$b", "pbkdf2-sha256$0$c2FsdA$a2V5", "pbkdf2-sha256$10$!$a2V5"} {
+		if err := Verify(malformed, "s3cret"); !errors.Is(err, ErrMalformedHash) {
+			t.Errorf("%q: expected ErrMalformedHash, got %v", malformed, err)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+// Package pubsub broadcasts messages between the replicas of the service
+package pubsub
+
+import (
+	"context"
+	"sync"
+)
+
+// Memory delivers the published messages to the subscribers of the same process, e.g. to
+// share invalidations between several caches or in tests
+type Memory struct {
+	m    sync.Mutex
+	subs map[string]map[*func(string)]struct{}
+}
+
+// NewMemory returns an empty Memory
+func NewMemory() *Memory {
+	return &Memory{subs: make(map[string]map[*func(string)]struct{})}
+}
+
+// Publish calls the handlers subscribed to channel with msg
+func (m *Memory) Publish(channel, msg string) error {
+	m.m.Lock()
+	handlers := make([]func(string), 0, len(m.subs[channel]))
+	for h := range m.subs[channel] {
+		handlers = append(handlers, *h)
+	}
+	m.m.Unlock()
+
+	for _, h := range handlers {
+		h(msg)
+	}
+	return nil
+}
+
+// Subscribe calls handler with the messages published on channel until ctx is done, returning its error
+func (m *Memory) Subscribe(ctx context.Context, channel string, handler func(msg string)) error {
+	h := &handler
+	m.m.Lock()
+	if m.subs[channel] == nil {
+		m.subs[channel] = make(map[*func(string)]struct{})
+	}
+	m.subs[channel][h] = struct{}{}
+	m.m.Unlock()
+
+	<-ctx.Done()
+
+	m.m.Lock()
+	delete(m.subs[channel], h)
+	m.m.Unlock()
+	return ctx.Err()
+}
@@ -0,0 +1,108 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/giannimassi/shorturl/pkg/resp/resptest"
+)
+
+// broadcaster is implemented by Memory and Redis
+type broadcaster interface {
+	Publish(channel, msg string) error
+	Subscribe(ctx context.Context, channel string, handler func(msg string)) error
+}
+
+func TestBroadcasters(t *testing.T) {
+	s := resptest.NewServer()
+	defer s.Close()
+
+	tests := []struct {
+		name string
+		b    broadcaster
+	}{
+		{name: "memory", b: NewMemory()},
+		{name: "redis", b: NewRedis(s.Addr(), time.Second)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			received := make(chan string, 10)
+			done := make(chan error)
+			go func() {
+				done <- tt.b.Subscribe(ctx, "ch", func(msg string) { received <- msg })
+			}()
+
+			// publish until the subscription is active
+			deadline := time.After(time.Second)
+		wait:
+			for {
+				if err := tt.b.Publish("ch", "hello"); err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+				select {
+				case msg := <-received:
+					if msg != "hello" {
+						t.Fatalf("unexpected message: %q", msg)
+					}
+					break wait
+				case <-deadline:
+					t.Fatal("message not received")
+				case <-time.After(10 * time.Millisecond):
+				}
+			}
+
+			_ = tt.b.Publish("other", "ignored")
+			_ = tt.b.Publish("ch", "world")
+			select {
+			case msg := <-received:
+				if msg != "world" && msg != "hello" {
+					t.Errorf("unexpected message: %q", msg)
+				}
+			case <-time.After(time.Second):
+				t.Error("message not received")
+			}
+
+			cancel()
+			select {
+			case err := <-done:
+				if err != context.Canceled {
+					t.Errorf("unexpected err: %v", err)
+				}
+			case <-time.After(time.Second):
+				t.Error("subscription not stopped")
+			}
+		})
+	}
+}
+
+func TestRedis_reconnect(t *testing.T) {
+	s := resptest.NewServer()
+	defer s.Close()
+	r := NewRedis(s.Addr(), time.Second)
+
+	done := make(chan error)
+	go func() {
+		done <- r.Subscribe(context.Background(), "ch", func(string) {})
+	}()
+	for s.Subscribers("ch") == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := r.Publish("ch", "a"); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	s.CloseConns()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("expected error when the connection is closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("subscription not stopped")
+	}
+	if err := r.Publish("ch", "b"); err != nil {
+		t.Errorf("publish should reconnect: %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/giannimassi/shorturl/pkg/resp"
+)
+
+// Redis broadcasts messages through the PUBLISH and SUBSCRIBE commands of a RESP server
+type Redis struct {
+	addr    string
+	timeout time.Duration
+
+	m    sync.Mutex
+	conn *resp.Conn // used to publish, nil until the first call to Publish
+}
+
+// NewRedis returns a Redis connecting to the RESP server at addr, with the given timeout
+// applied to the connections and to each command
+func NewRedis(addr string, timeout time.Duration) *Redis {
+	return &Redis{addr: addr, timeout: timeout}
+}
+
+// Publish sends msg to the subscribers of channel, reconnecting once if the connection is broken
+func (r *Redis) Publish(channel, msg string) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if r.conn == nil {
+			if r.conn, err = resp.Dial(r.addr, r.timeout); err != nil {
+				return fmt.Errorf("connecting to %s: %w", r.addr, err)
+			}
+		}
+		if _, err = r.conn.Do("PUBLISH", channel, msg); err == nil {
+			return nil
+		}
+		if _, isReply := err.(resp.Error); isReply {
+			return err
+		}
+		_ = r.conn.Close()
+		r.conn = nil
+	}
+	return fmt.Errorf("publishing on %s: %w", channel, err)
+}
+
+// Subscribe calls handler with the messages published on channel until ctx is done or the
+// connection fails, returning the error that stopped the subscription
+func (r *Redis) Subscribe(ctx context.Context, channel string, handler func(msg string)) error {
+	conn, err := resp.Dial(r.addr, r.timeout)
+	if err != nil {
+		return fmt.Errorf("connecting to %s: %w", r.addr, err)
+	}
+	defer conn.Close()
+	if _, err := conn.Do("SUBSCRIBE", channel); err != nil {
+		return fmt.Errorf("subscribing to %s: %w", channel, err)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-stop:
+		}
+	}()
+
+	for {
+		v, err := conn.ReceiveBlocking()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return fmt.Errorf("receiving from %s: %w", channel, err)
+		}
+		msg, err := v.Strings()
+		if err != nil || len(msg) != 3 || msg[0] != "message" {
+			continue
+		}
+		handler(msg[2])
+	}
+}
@@ -0,0 +1,210 @@
+// Package quota caps the number of links and the storage used by each owner
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/giannimassi/shorturl/pkg/storage"
+)
+
+// ErrExceeded is returned when adding a link would exceed the quota of its owner
+var ErrExceeded = errors.New("quota exceeded")
+
+// Quota limits the resources used by an owner, zero values meaning no limit
+type Quota struct {
+	MaxLinks int   // Maximum number of active links
+	MaxBytes int64 // Maximum storage used by the links, see Size
+}
+
+// Usage is the amount of resources used by an owner
+type Usage struct {
+	Links int
+	Bytes int64
+}
+
+// Size returns the storage accounted for a link: the length of its key, url, title, template and
+// of the urls of its rules, variants and coming soon redirect
+func Size(key string, u *url.URL, md storage.Metadata) int64 {
+	size := len(key) + len(u.String()) + len(md.Title) + len(md.Template) + len(md.ComingSoonURL)
+	for _, r := range md.Rules {
+		size += len(r.URL)
+	}
+	for _, v := range md.Variants {
+		size += len(v.URL)
+	}
+	return int64(size)
+}
+
+// Store is the subset of the short url storage needed to compute the current usage
+type Store interface {
+	Keys(ctx context.Context) ([]string, error)
+	ShortURLInfo(ctx context.Context, key string) (*url.URL, int, error)
+	Metadata(ctx context.Context, key string) (storage.Metadata, error)
+}
+
+// Tracker keeps track of the usage of each owner and enforces their quotas.
+// Links without owner are accounted together under the empty owner.
+//
+// The usage is only updated by Reserve and Release, so links removed by the store itself, e.g.
+// when they expire, keep being accounted for until the usage is loaded again. Run reloads it
+// periodically to reconcile the tracked usage with the store.
+type Tracker struct {
+	m         sync.Mutex
+	def       Quota
+	overrides map[string]Quota
+	usage     map[string]Usage
+	changes   map[string]Usage // reservations and releases since the start of Load, nil otherwise
+}
+
+// NewTracker returns a Tracker applying def to every owner without a specific quota
+func NewTracker(def Quota) *Tracker {
+	return &Tracker{
+		def:       def,
+		overrides: make(map[string]Quota),
+		usage:     make(map[string]Usage),
+	}
+}
+
+// SetQuota sets a specific quota for owner
+func (t *Tracker) SetQuota(owner string, q Quota) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.overrides[owner] = q
+}
+
+// Load replaces the tracked usage with the one computed from the links in store. Reservations and
+// releases made while the links are read are applied on top of it, so that they are not lost; a
+// link stored while loading may then be accounted twice until the next Load.
+func (t *Tracker) Load(ctx context.Context, store Store) error {
+	t.m.Lock()
+	t.changes = make(map[string]Usage)
+	t.m.Unlock()
+	usage, err := t.read(ctx, store)
+
+	t.m.Lock()
+	defer t.m.Unlock()
+	if err == nil {
+		for owner, c := range t.changes {
+			u := usage[owner]
+			u.Links += c.Links
+			u.Bytes += c.Bytes
+			if u.Links <= 0 {
+				delete(usage, owner)
+				continue
+			}
+			usage[owner] = u
+		}
+		t.usage = usage
+	}
+	t.changes = nil
+	return err
+}
+
+// Run loads the usage from store every interval until ctx is done. Failed loads keep the tracked
+// usage, to be reconciled by the next one.
+func (t *Tracker) Run(ctx context.Context, store Store, interval time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+			_ = t.Load(ctx, store)
+		}
+	}
+}
+
+// read computes the usage of each owner from the links in store
+func (t *Tracker) read(ctx context.Context, store Store) (map[string]Usage, error) {
+	keys, err := store.Keys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing keys: %w", err)
+	}
+	usage := make(map[string]Usage)
+	for _, key := range keys {
+		u, _, err := store.ShortURLInfo(ctx, key)
+		if errors.Is(err, storage.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("loading %q: %w", key, err)
+		}
+		md, err := store.Metadata(ctx, key)
+		if errors.Is(err, storage.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("loading metadata of %q: %w", key, err)
+		}
+		ou := usage[md.Owner]
+		ou.Links++
+		ou.Bytes += Size(key, u, md)
+		usage[md.Owner] = ou
+	}
+	return usage, nil
+}
+
+// Reserve accounts for a new link of the given size, returning ErrExceeded if it does not fit
+// in the quota of owner. The reservation must be released if the link is not stored.
+func (t *Tracker) Reserve(owner string, size int64) error {
+	t.m.Lock()
+	defer t.m.Unlock()
+	q, u := t.quota(owner), t.usage[owner]
+	if q.MaxLinks > 0 && u.Links+1 > q.MaxLinks {
+		return fmt.Errorf("%w: %d of %d links used", ErrExceeded, u.Links, q.MaxLinks)
+	}
+	if q.MaxBytes > 0 && u.Bytes+size > q.MaxBytes {
+		return fmt.Errorf("%w: %d of %d bytes used, %d more requested", ErrExceeded, u.Bytes, q.MaxBytes, size)
+	}
+	u.Links++
+	u.Bytes += size
+	t.usage[owner] = u
+	t.recordChange(owner, 1, size)
+	return nil
+}
+
+// Release accounts for the removal of a link of the given size
+func (t *Tracker) Release(owner string, size int64) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.recordChange(owner, -1, -size)
+	u := t.usage[owner]
+	u.Links--
+	u.Bytes -= size
+	if u.Links <= 0 {
+		delete(t.usage, owner)
+		return
+	}
+	t.usage[owner] = u
+}
+
+// Usage returns the current usage and the quota of owner
+func (t *Tracker) Usage(owner string) (Usage, Quota) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	return t.usage[owner], t.quota(owner)
+}
+
+// recordChange records a change of the usage of owner while loading. It must be called with t.m held.
+func (t *Tracker) recordChange(owner string, links int, bytes int64) {
+	if t.changes == nil {
+		return
+	}
+	c := t.changes[owner]
+	c.Links += links
+	c.Bytes += bytes
+	t.changes[owner] = c
+}
+
+func (t *Tracker) quota(owner string) Quota {
+	if q, found := t.overrides[owner]; found {
+		return q
+	}
+	return t.def
+}
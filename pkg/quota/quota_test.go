@@ -0,0 +1,122 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/giannimassi/shorturl/pkg/resp"
+	"github.com/giannimassi/shorturl/pkg/resp/resptest"
+	"github.com/giannimassi/shorturl/pkg/storage"
+)
+
+func TestTracker(t *testing.T) {
+	tr := NewTracker(Quota{MaxLinks: 2, MaxBytes: 100})
+	tr.SetQuota("big", Quota{})
+
+	if err := tr.Reserve("a", 60); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := tr.Reserve("a", 60); !errors.Is(err, ErrExceeded) {
+		t.Errorf("expected bytes quota to be exceeded, got %v", err)
+	}
+	if err := tr.Reserve("a", 40); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := tr.Reserve("a", 0); !errors.Is(err, ErrExceeded) {
+		t.Errorf("expected links quota to be exceeded, got %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := tr.Reserve("big", 1000); err != nil {
+			t.Fatalf("owner without limits: unexpected err: %v", err)
+		}
+	}
+
+	tr.Release("a", 60)
+	usage, q := tr.Usage("a")
+	if usage != (Usage{Links: 1, Bytes: 40}) || q.MaxLinks != 2 {
+		t.Errorf("unexpected usage %+v and quota %+v", usage, q)
+	}
+}
+
+func TestTracker_Load(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewMemoryStore()
+	u, _ := url.Parse("https://example.org/")
+	for key, owner := range map[string]string{"a": "team1", "b": "team1", "c": ""} {
+		if err := s.AddURL(ctx, key, *u, storage.Metadata{Owner: owner, Title: "t"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tr := NewTracker(Quota{})
+	if err := tr.Load(ctx, s); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	expected := Usage{Links: 2, Bytes: 2 * int64(len("a")+len("https://example.org/")+len("t"))}
+	if usage, _ := tr.Usage("team1"); usage != expected {
+		t.Errorf("unexpected usage: got %+v want %+v", usage, expected)
+	}
+	if usage, _ := tr.Usage(""); usage.Links != 1 {
+		t.Errorf("unexpected anonymous usage: %+v", usage)
+	}
+}
+
+// reservingStore reserves a link while the usage is being loaded
+type reservingStore struct {
+	Store
+	tr *Tracker
+}
+
+func (s reservingStore) Keys(ctx context.Context) ([]string, error) {
+	_ = s.tr.Reserve("team1", 10)
+	return s.Store.Keys(ctx)
+}
+
+func TestTracker_Load_concurrentReserve(t *testing.T) {
+	tr := NewTracker(Quota{})
+	if err := tr.Load(context.Background(), reservingStore{storage.NewMemoryStore(), tr}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if usage, _ := tr.Usage("team1"); usage != (Usage{Links: 1, Bytes: 10}) {
+		t.Errorf("reservations made while loading should be kept, got %+v", usage)
+	}
+}
+
+func TestTracker_Run_expiredLinks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv := resptest.NewServer()
+	defer srv.Close()
+	pool := resp.NewPool(srv.Addr(), time.Second, 2)
+	defer pool.Close()
+	s := storage.NewRedisStore(pool, "test:", time.Hour)
+
+	tr := NewTracker(Quota{MaxLinks: 1})
+	u, _ := url.Parse("https://example.org/")
+	md := storage.Metadata{Owner: "team1"}
+	if err := tr.Reserve(md.Owner, Size("a", u, md)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddURL(ctx, "a", *u, md); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.FastForward(time.Hour)
+	if err := tr.Reserve(md.Owner, 0); !errors.Is(err, ErrExceeded) {
+		t.Fatalf("expired links are accounted for until the usage is reloaded, got %v", err)
+	}
+	go tr.Run(ctx, s, time.Millisecond)
+	deadline := time.Now().Add(time.Second)
+	for {
+		if usage, _ := tr.Usage(md.Owner); usage.Links == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expired link should have been released by Run")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,117 @@
+// Package ratelimit implements token bucket rate limiting keyed by client
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit describes a token bucket: Rate tokens are added every second, up to Burst tokens
+type Limit struct {
+	Rate  float64 // Tokens added per second, rate limiting is disabled if zero
+	Burst int     // Maximum number of tokens, i.e. of requests allowed at once
+}
+
+// Enabled returns true if l limits the rate of requests
+func (l Limit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// sweepEvery is the number of calls to Allow after which idle buckets are removed
+const sweepEvery = 1024
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter keeps a token bucket per key. Buckets that have been refilled completely are
+// removed periodically, so that memory usage is bounded by the number of active clients.
+type Limiter struct {
+	limit Limit
+	now   func() time.Time
+
+	m       sync.Mutex
+	buckets map[string]*bucket
+	calls   int
+}
+
+// New returns a Limiter applying limit to every key
+func New(limit Limit) *Limiter {
+	return &Limiter{
+		limit:   limit,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token from the bucket of key, returning true if one was available.
+// Otherwise it returns false and the time after which a token will be available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if !l.limit.Enabled() {
+		return true, 0
+	}
+	now := l.now()
+
+	l.m.Lock()
+	defer l.m.Unlock()
+	l.calls++
+	if l.calls%sweepEvery == 0 {
+		l.sweep(now)
+	}
+
+	b, found := l.buckets[key]
+	if !found {
+		b = &bucket{tokens: float64(l.limit.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = l.refill(b, now)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration(math.Ceil((1 - b.tokens) / l.limit.Rate * float64(time.Second)))
+	return false, wait
+}
+
+// Refund returns a token taken by Allow to the bucket of key, so that a Limiter can be used to
+// limit only some of the requests, e.g. those that fail. Taking the token first and refunding it
+// keeps concurrent requests from exceeding the limit while their outcome is not known.
+func (l *Limiter) Refund(key string) {
+	if !l.limit.Enabled() {
+		return
+	}
+	now := l.now()
+
+	l.m.Lock()
+	defer l.m.Unlock()
+	b, found := l.buckets[key]
+	if !found {
+		return // swept, so already full
+	}
+	b.tokens = math.Min(l.refill(b, now)+1, float64(l.limit.Burst))
+	b.last = now
+}
+
+// Len returns the number of keys currently tracked
+func (l *Limiter) Len() int {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return len(l.buckets)
+}
+
+func (l *Limiter) refill(b *bucket, now time.Time) float64 {
+	tokens := b.tokens + now.Sub(b.last).Seconds()*l.limit.Rate
+	return math.Min(tokens, float64(l.limit.Burst))
+}
+
+// sweep removes full buckets, which are equivalent to missing ones. It must be called with l.m held.
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if l.refill(b, now) >= float64(l.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
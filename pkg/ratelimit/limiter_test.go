@@ -0,0 +1,89 @@
+package ratelimit
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	now := time.Date(2020, 7, 30, 10, 0, 0, 0, time.UTC)
+	l := New(Limit{Rate: 2, Burst: 3})
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("request %d should be allowed within burst", i)
+		}
+	}
+	ok, wait := l.Allow("a")
+	if ok || wait != 500*time.Millisecond {
+		t.Errorf("unexpected result after burst: %v, %v", ok, wait)
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Errorf("keys should have separate buckets")
+	}
+
+	now = now.Add(250 * time.Millisecond)
+	if ok, wait := l.Allow("a"); ok || wait != 250*time.Millisecond {
+		t.Errorf("unexpected result after partial refill: %v, %v", ok, wait)
+	}
+	now = now.Add(250 * time.Millisecond)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Errorf("request should be allowed after refill")
+	}
+	if l.Len() != 2 {
+		t.Errorf("unexpected tracked keys: %d", l.Len())
+	}
+}
+
+func TestLimiter_Refund(t *testing.T) {
+	now := time.Date(2020, 7, 30, 10, 0, 0, 0, time.UTC)
+	l := New(Limit{Rate: 1, Burst: 2})
+	l.now = func() time.Time { return now }
+
+	l.Refund("unknown")
+	l.Allow("a")
+	l.Allow("a")
+	if ok, wait := l.Allow("a"); ok || wait != time.Second {
+		t.Errorf("unexpected result after burst: %v, %v", ok, wait)
+	}
+	l.Refund("a")
+	if ok, _ := l.Allow("a"); !ok {
+		t.Error("refunded token should be available")
+	}
+	for i := 0; i < 5; i++ {
+		l.Refund("a")
+	}
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Errorf("request %d should be allowed within burst", i)
+		}
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Error("refunds should not exceed the burst")
+	}
+}
+
+func TestLimiter_sweep(t *testing.T) {
+	now := time.Date(2020, 7, 30, 10, 0, 0, 0, time.UTC)
+	l := New(Limit{Rate: 1, Burst: 1})
+	l.now = func() time.Time { return now }
+	for i := 0; i < sweepEvery-1; i++ {
+		l.Allow(strconv.Itoa(i))
+	}
+	now = now.Add(time.Second)
+	l.Allow("last")
+	if l.Len() != 1 {
+		t.Errorf("idle buckets should have been removed, %d left", l.Len())
+	}
+}
+
+func TestLimiter_disabled(t *testing.T) {
+	l := New(Limit{})
+	for i := 0; i < 10; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatal("disabled limiter should allow all requests")
+		}
+	}
+}
@@ -0,0 +1,441 @@
+// Package resp implements a minimal client of the Redis serialization protocol (RESP2)
+// Reference: https://redis.io/topics/protocol
+package resp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// ErrNil is returned by the Value accessors when the reply is a null bulk string or array
+var ErrNil = errors.New("resp: nil reply")
+
+// Error is an error reply sent by the server
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// Kind identifies the type of a Value
+type Kind byte
+
+// Kinds of values, identified by the first byte of their encoding
+const (
+	SimpleString Kind = '+'
+	ErrorReply   Kind = '-'
+	Integer      Kind = ':'
+	BulkString   Kind = '$'
+	Array        Kind = '*'
+)
+
+// Value is a reply sent by the server
+type Value struct {
+	Kind  Kind
+	Str   string  // Content of simple strings, bulk strings and errors
+	Int   int64   // Content of integers
+	Elems []Value // Content of arrays
+	Null  bool    // Whether the bulk string or array is null
+}
+
+// String returns the content of a simple or bulk string
+func (v Value) String() (string, error) {
+	switch {
+	case v.Kind == ErrorReply:
+		return "", Error(v.Str)
+	case v.Null:
+		return "", ErrNil
+	case v.Kind == SimpleString || v.Kind == BulkString:
+		return v.Str, nil
+	case v.Kind == Integer:
+		return strconv.FormatInt(v.Int, 10), nil
+	}
+	return "", fmt.Errorf("resp: unexpected %c reply, want a string", v.Kind)
+}
+
+// Integer returns the content of an integer, or of a string representing one
+func (v Value) Integer() (int64, error) {
+	if v.Kind == Integer {
+		return v.Int, nil
+	}
+	s, err := v.String()
+	if err != nil {
+		return 0, err
+	}
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("resp: parsing integer reply: %w", err)
+	}
+	return i, nil
+}
+
+// Strings returns the content of an array of strings
+func (v Value) Strings() ([]string, error) {
+	switch {
+	case v.Kind == ErrorReply:
+		return nil, Error(v.Str)
+	case v.Null:
+		return nil, ErrNil
+	case v.Kind != Array:
+		return nil, fmt.Errorf("resp: unexpected %c reply, want an array", v.Kind)
+	}
+	strs := make([]string, len(v.Elems))
+	for i, e := range v.Elems {
+		s, err := e.String()
+		if err != nil && !errors.Is(err, ErrNil) {
+			return nil, err
+		}
+		strs[i] = s
+	}
+	return strs, nil
+}
+
+// Err returns the error carried by an error reply, nil otherwise
+func (v Value) Err() error {
+	if v.Kind == ErrorReply {
+		return Error(v.Str)
+	}
+	return nil
+}
+
+// Conn is a connection to a RESP server. It is not safe for concurrent use.
+type Conn struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	w       *bufio.Writer
+	timeout time.Duration
+	limit   time.Time // deadline of the context bound to the connection, if any
+}
+
+// Dial connects to the RESP server at addr. The timeout applies to the connection and to each
+// command, no timeout being applied if zero.
+func Dial(addr string, timeout time.Duration) (*Conn, error) {
+	return DialContext(context.Background(), addr, timeout)
+}
+
+// DialContext is like Dial but gives up connecting when ctx is done
+func DialContext(ctx context.Context, addr string, timeout time.Duration) (*Conn, error) {
+	d := net.Dialer{Timeout: timeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewConn(conn, timeout), nil
+}
+
+// NewConn returns a Conn using conn
+func NewConn(conn net.Conn, timeout time.Duration) *Conn {
+	return &Conn{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn), timeout: timeout}
+}
+
+// Close closes the connection
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// Do sends a command and returns its reply. Error replies are returned as Error.
+func (c *Conn) Do(args ...string) (Value, error) {
+	if err := c.Send(args...); err != nil {
+		return Value{}, err
+	}
+	if err := c.Flush(); err != nil {
+		return Value{}, err
+	}
+	v, err := c.Receive()
+	if err != nil {
+		return Value{}, err
+	}
+	return v, v.Err()
+}
+
+// Send buffers a command, which is sent by Flush
+func (c *Conn) Send(args ...string) error {
+	if _, err := fmt.Fprintf(c.w, "*%d\r\n", len(args)); err != nil {
+		return err
+	}
+	for _, arg := range args {
+		if _, err := fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush sends the buffered commands
+func (c *Conn) Flush() error {
+	_ = c.conn.SetWriteDeadline(c.deadline())
+	return c.w.Flush()
+}
+
+// Receive reads a reply, waiting for at most the timeout of the connection
+func (c *Conn) Receive() (Value, error) {
+	_ = c.conn.SetReadDeadline(c.deadline())
+	return ReadValue(c.r)
+}
+
+// deadline returns the deadline of the next operation, the zero time meaning no deadline
+func (c *Conn) deadline() time.Time {
+	var d time.Time
+	if c.timeout > 0 {
+		d = time.Now().Add(c.timeout)
+	}
+	if !c.limit.IsZero() && (d.IsZero() || c.limit.Before(d)) {
+		d = c.limit
+	}
+	return d
+}
+
+// bind limits the operations on c to the lifetime of ctx until the returned function is called:
+// c is closed as soon as ctx is done. The returned function reports whether c is still usable.
+func (c *Conn) bind(ctx context.Context) (unbind func() bool) {
+	c.limit, _ = ctx.Deadline()
+	if ctx.Done() == nil {
+		return func() bool {
+			c.limit = time.Time{}
+			return true
+		}
+	}
+	stop := make(chan struct{})
+	interrupted := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = c.conn.Close()
+			interrupted <- true
+		case <-stop:
+			interrupted <- false
+		}
+	}()
+	return func() bool {
+		close(stop)
+		c.limit = time.Time{}
+		return !<-interrupted
+	}
+}
+
+// ReceiveBlocking reads a reply without timeout, e.g. a message on a subscribed channel
+func (c *Conn) ReceiveBlocking() (Value, error) {
+	_ = c.conn.SetReadDeadline(time.Time{})
+	return ReadValue(c.r)
+}
+
+// ReadValue reads a RESP value from r
+func ReadValue(r *bufio.Reader) (Value, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return Value{}, err
+	}
+	if len(line) == 0 {
+		return Value{}, errors.New("resp: empty line")
+	}
+
+	v := Value{Kind: Kind(line[0])}
+	switch v.Kind {
+	case SimpleString, ErrorReply:
+		v.Str = line[1:]
+	case Integer:
+		if v.Int, err = strconv.ParseInt(line[1:], 10, 64); err != nil {
+			return Value{}, fmt.Errorf("resp: malformed integer: %w", err)
+		}
+	case BulkString:
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return Value{}, fmt.Errorf("resp: malformed bulk string length: %w", err)
+		}
+		if n < 0 {
+			v.Null = true
+			break
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return Value{}, err
+		}
+		v.Str = string(buf[:n])
+	case Array:
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return Value{}, fmt.Errorf("resp: malformed array length: %w", err)
+		}
+		if n < 0 {
+			v.Null = true
+			break
+		}
+		v.Elems = make([]Value, n)
+		for i := range v.Elems {
+			if v.Elems[i], err = ReadValue(r); err != nil {
+				return Value{}, err
+			}
+		}
+	default:
+		return Value{}, fmt.Errorf("resp: unexpected type %q", line[0])
+	}
+	return v, nil
+}
+
+// WriteValue writes v to w in the RESP format
+func WriteValue(w io.Writer, v Value) error {
+	var err error
+	switch {
+	case v.Null && v.Kind == Array:
+		_, err = io.WriteString(w, "*-1\r\n")
+	case v.Null:
+		_, err = io.WriteString(w, "$-1\r\n")
+	case v.Kind == SimpleString || v.Kind == ErrorReply:
+		_, err = fmt.Fprintf(w, "%c%s\r\n", v.Kind, v.Str)
+	case v.Kind == Integer:
+		_, err = fmt.Fprintf(w, ":%d\r\n", v.Int)
+	case v.Kind == BulkString:
+		_, err = fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v.Str), v.Str)
+	case v.Kind == Array:
+		if _, err = fmt.Fprintf(w, "*%d\r\n", len(v.Elems)); err != nil {
+			return err
+		}
+		for _, e := range v.Elems {
+			if err = WriteValue(w, e); err != nil {
+				return err
+			}
+		}
+	default:
+		err = fmt.Errorf("resp: unexpected type %q", v.Kind)
+	}
+	return err
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", errors.New("resp: line not terminated by CRLF")
+	}
+	return line[:len(line)-2], nil
+}
+
+// Pool is a pool of connections to a RESP server, safe for concurrent use
+type Pool struct {
+	addr    string
+	timeout time.Duration
+	idle    chan *Conn
+}
+
+// NewPool returns a Pool of connections to addr keeping up to maxIdle idle connections.
+// The timeout applies to the connections and to each command.
+func NewPool(addr string, timeout time.Duration, maxIdle int) *Pool {
+	return &Pool{addr: addr, timeout: timeout, idle: make(chan *Conn, maxIdle)}
+}
+
+// Do sends a command on a pooled connection and returns its reply
+func (p *Pool) Do(ctx context.Context, args ...string) (Value, error) {
+	vs, err := p.Pipeline(ctx, args)
+	if err != nil {
+		return Value{}, err
+	}
+	return vs[0], vs[0].Err()
+}
+
+// Pipeline sends several commands at once on a pooled connection and returns their replies.
+// Error replies are returned as values, the returned error only reports connection failures and
+// the error of ctx if it is done before the replies are received.
+func (p *Pool) Pipeline(ctx context.Context, cmds ...[]string) ([]Value, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c, err := p.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	unbind := c.bind(ctx)
+	vs, err := c.Pipeline(cmds...)
+	if usable := unbind(); !usable || err != nil {
+		_ = c.Close()
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+	p.put(c)
+	return vs, nil
+}
+
+// WithConn calls f with a pooled connection, for sequences of commands that must be sent on the
+// same connection such as transactions watching keys. The connection is bound to ctx while f runs
+// and is closed instead of being reused if f returns an error other than an error reply, so f must
+// leave it in its initial state, e.g. without watched keys, when it succeeds or returns an Error.
+func (p *Pool) WithConn(ctx context.Context, f func(c *Conn) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c, err := p.get(ctx)
+	if err != nil {
+		return err
+	}
+	unbind := c.bind(ctx)
+	err = f(c)
+	var reply Error
+	if usable := unbind(); !usable || (err != nil && !errors.As(err, &reply)) {
+		_ = c.Close()
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return err
+	}
+	p.put(c)
+	return err
+}
+
+// Pipeline sends several commands at once and returns their replies. Error replies are returned
+// as values, the returned error only reports connection failures.
+func (c *Conn) Pipeline(cmds ...[]string) ([]Value, error) {
+	for _, cmd := range cmds {
+		if err := c.Send(cmd...); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.Flush(); err != nil {
+		return nil, err
+	}
+	vs := make([]Value, len(cmds))
+	for i := range vs {
+		var err error
+		if vs[i], err = c.Receive(); err != nil {
+			return nil, err
+		}
+	}
+	return vs, nil
+}
+
+// Close closes the idle connections
+func (p *Pool) Close() error {
+	for {
+		select {
+		case c := <-p.idle:
+			_ = c.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (p *Pool) get(ctx context.Context) (*Conn, error) {
+	select {
+	case c := <-p.idle:
+		return c, nil
+	default:
+		return DialContext(ctx, p.addr, p.timeout)
+	}
+}
+
+func (p *Pool) put(c *Conn) {
+	select {
+	case p.idle <- c:
+	default:
+		_ = c.Close()
+	}
+}
@@ -0,0 +1,142 @@
+package resp_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/giannimassi/shorturl/pkg/resp"
+	"github.com/giannimassi/shorturl/pkg/resp/resptest"
+)
+
+func TestReadWriteValue(t *testing.T) {
+	values := []resp.Value{
+		{Kind: resp.SimpleString, Str: "OK"},
+		{Kind: resp.ErrorReply, Str: "ERR boom"},
+		{Kind: resp.Integer, Int: -42},
+		{Kind: resp.BulkString, Str: "multi\r\nline"},
+		{Kind: resp.BulkString, Null: true},
+		{Kind: resp.Array, Null: true},
+		{Kind: resp.Array, Elems: []resp.Value{
+			{Kind: resp.BulkString, Str: "a"},
+			{Kind: resp.Array, Elems: []resp.Value{{Kind: resp.Integer, Int: 1}}},
+		}},
+	}
+	for _, v := range values {
+		var buf bytes.Buffer
+		if err := resp.WriteValue(&buf, v); err != nil {
+			t.Fatalf("unexpected err writing %+v: %v", v, err)
+		}
+		got, err := resp.ReadValue(bufio.NewReader(&buf))
+		if err != nil {
+			t.Fatalf("unexpected err reading %+v: %v", v, err)
+		}
+		if !reflect.DeepEqual(got, v) {
+			t.Errorf("roundtrip mismatch: got %+v want %+v", got, v)
+		}
+	}
+
+	if _, err := resp.ReadValue(bufio.NewReader(bytes.NewBufferString("+OK\n"))); err == nil {
+		t.Errorf("expected error for line without CRLF")
+	}
+}
+
+func TestConn_Do(t *testing.T) {
+	s := resptest.NewServer()
+	defer s.Close()
+	c, err := resp.Dial(s.Addr(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	v, err := c.Do("PING")
+	if str, _ := v.String(); err != nil || str != "PONG" {
+		t.Errorf("unexpected reply to PING: %+v, %v", v, err)
+	}
+	var replyErr resp.Error
+	if _, err := c.Do("NOPE"); !errors.As(err, &replyErr) {
+		t.Errorf("expected error reply, got %v", err)
+	}
+	if v, err := c.Do("PUBLISH", "ch", "msg"); err != nil || v.Int != 0 {
+		t.Errorf("unexpected reply to PUBLISH: %+v, %v", v, err)
+	}
+}
+
+func TestPool(t *testing.T) {
+	s := resptest.NewServer()
+	defer s.Close()
+	p := resp.NewPool(s.Addr(), time.Second, 1)
+	defer p.Close()
+
+	ctx := context.Background()
+	vs, err := p.Pipeline(ctx, []string{"PING"}, []string{"NOPE"})
+	if err != nil || len(vs) != 2 || vs[0].Str != "PONG" || vs[1].Err() == nil {
+		t.Errorf("unexpected replies: %+v, %v", vs, err)
+	}
+	if v, err := p.Do(ctx, "PING"); err != nil || v.Str != "PONG" {
+		t.Errorf("idle connection should be reused: %+v, %v", v, err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := p.Do(canceled, "PING"); !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected err: %v", err)
+	}
+}
+
+func TestPool_WithConn(t *testing.T) {
+	s := resptest.NewServer()
+	defer s.Close()
+	p := resp.NewPool(s.Addr(), time.Second, 1)
+	defer p.Close()
+	ctx := context.Background()
+
+	transaction := func(c *resp.Conn, modify bool) (resp.Value, error) {
+		if _, err := c.Do("WATCH", "k"); err != nil {
+			return resp.Value{}, err
+		}
+		if modify {
+			if _, err := p.Do(ctx, "SET", "k", "other"); err != nil {
+				return resp.Value{}, err
+			}
+		}
+		vs, err := c.Pipeline([]string{"MULTI"}, []string{"SET", "k", "v"}, []string{"INCR", "n"}, []string{"EXEC"})
+		if err != nil {
+			return resp.Value{}, err
+		}
+		return vs[3], nil
+	}
+
+	var exec resp.Value
+	if err := p.WithConn(ctx, func(c *resp.Conn) (err error) {
+		exec, err = transaction(c, true)
+		return err
+	}); err != nil || !exec.Null {
+		t.Errorf("transaction should fail when a watched key is modified: %+v, %v", exec, err)
+	}
+	if v, _ := p.Do(ctx, "GET", "k"); v.Str != "other" {
+		t.Errorf("failed transaction should not write: %+v", v)
+	}
+	if err := p.WithConn(ctx, func(c *resp.Conn) (err error) {
+		exec, err = transaction(c, false)
+		return err
+	}); err != nil || len(exec.Elems) != 2 || exec.Elems[1].Int != 1 {
+		t.Errorf("unexpected transaction result: %+v, %v", exec, err)
+	}
+	if v, _ := p.Do(ctx, "GET", "k"); v.Str != "v" {
+		t.Errorf("transaction should have written: %+v", v)
+	}
+
+	vs, err := p.Pipeline(ctx, []string{"MULTI"}, []string{"NOPE"}, []string{"SET", "k", "aborted"}, []string{"EXEC"})
+	if err != nil || vs[1].Err() == nil || vs[3].Err() == nil {
+		t.Errorf("transactions with invalid commands should be aborted: %+v, %v", vs, err)
+	}
+	if v, _ := p.Do(ctx, "GET", "k"); v.Str != "v" {
+		t.Errorf("aborted transaction should not write: %+v", v)
+	}
+}
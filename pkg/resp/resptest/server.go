@@ -0,0 +1,569 @@
+// Package resptest provides an in-process RESP server implementing the subset of Redis commands
+// used by shorturl, for use in tests
+package resptest
+
+import (
+	"bufio"
+	"net"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/giannimassi/shorturl/pkg/resp"
+)
+
+// Server is an in-process RESP server listening on a local port
+type Server struct {
+	l net.Listener
+
+	m           sync.Mutex
+	conns       map[net.Conn]struct{}
+	subscribers map[string]map[*client]struct{}
+	commands    int
+	data        map[string]*item
+	now         time.Time
+}
+
+// item is a stored string or hash
+type item struct {
+	str     string
+	hash    map[string]string // nil for strings
+	expires time.Time         // zero if the item does not expire
+}
+
+type client struct {
+	m sync.Mutex
+	w *bufio.Writer
+
+	// state of transactions, accessed with Server.m held
+	multi   bool
+	aborted bool             // a command could not be queued, so EXEC fails
+	queued  [][]string       // commands queued since MULTI, the first element being the name
+	watched map[string]*item // copies of the watched items, nil for missing ones
+}
+
+func (c *client) write(v resp.Value) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	_ = resp.WriteValue(c.w, v)
+	_ = c.w.Flush()
+}
+
+// NewServer starts a Server on a random local port. It panics if no port is available.
+func NewServer() *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("resptest: listening: " + err.Error())
+	}
+	s := &Server{
+		l:           l,
+		conns:       make(map[net.Conn]struct{}),
+		subscribers: make(map[string]map[*client]struct{}),
+		data:        make(map[string]*item),
+		now:         time.Now(),
+	}
+	go s.serve()
+	return s
+}
+
+// Addr returns the address the server listens on
+func (s *Server) Addr() string {
+	return s.l.Addr().String()
+}
+
+// Close stops the server and closes all connections
+func (s *Server) Close() {
+	_ = s.l.Close()
+	s.CloseConns()
+}
+
+// CloseConns closes all the connections opened so far, simulating a network failure
+func (s *Server) CloseConns() {
+	s.m.Lock()
+	defer s.m.Unlock()
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+}
+
+// Commands returns the number of commands received so far
+func (s *Server) Commands() int {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.commands
+}
+
+// FastForward advances the clock of the server by d, expiring the items whose TTL elapsed
+func (s *Server) FastForward(d time.Duration) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.now = s.now.Add(d)
+}
+
+// Subscribers returns the number of clients subscribed to channel
+func (s *Server) Subscribers(channel string) int {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return len(s.subscribers[channel])
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		s.m.Lock()
+		s.conns[conn] = struct{}{}
+		s.m.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	c := &client{w: bufio.NewWriter(conn)}
+	defer func() {
+		s.m.Lock()
+		delete(s.conns, conn)
+		for _, subs := range s.subscribers {
+			delete(subs, c)
+		}
+		s.m.Unlock()
+		_ = conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	for {
+		v, err := resp.ReadValue(r)
+		if err != nil {
+			return
+		}
+		args, err := v.Strings()
+		if err != nil || len(args) == 0 {
+			c.write(errorf("ERR malformed command"))
+			continue
+		}
+		for _, reply := range s.exec(c, strings.ToUpper(args[0]), args[1:]) {
+			c.write(reply)
+		}
+	}
+}
+
+// exec executes a command, returning its replies
+func (s *Server) exec(c *client, cmd string, args []string) []resp.Value {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.commands++
+
+	if c.multi {
+		switch cmd {
+		case "MULTI", "EXEC", "DISCARD", "WATCH":
+		default:
+			return []resp.Value{s.queue(c, cmd, args)}
+		}
+	}
+
+	switch cmd {
+	case "MULTI":
+		if c.multi {
+			return []resp.Value{errorf("ERR MULTI calls can not be nested")}
+		}
+		c.multi = true
+		return []resp.Value{simple("OK")}
+	case "EXEC":
+		if !c.multi {
+			return []resp.Value{errorf("ERR EXEC without MULTI")}
+		}
+		return []resp.Value{s.execQueued(c)}
+	case "DISCARD":
+		if !c.multi {
+			return []resp.Value{errorf("ERR DISCARD without MULTI")}
+		}
+		c.reset()
+		return []resp.Value{simple("OK")}
+	case "WATCH":
+		if c.multi {
+			return []resp.Value{errorf("ERR WATCH inside MULTI is not allowed")}
+		}
+		if len(args) == 0 {
+			return []resp.Value{wrongArgs(cmd)}
+		}
+		if c.watched == nil {
+			c.watched = make(map[string]*item)
+		}
+		for _, key := range args {
+			c.watched[key] = copyItem(s.lookup(key))
+		}
+		return []resp.Value{simple("OK")}
+	case "UNWATCH":
+		c.watched = nil
+		return []resp.Value{simple("OK")}
+	case "PING":
+		return []resp.Value{simple("PONG")}
+	case "PUBLISH":
+		if len(args) != 2 {
+			return []resp.Value{wrongArgs(cmd)}
+		}
+		subs := s.subscribers[args[0]]
+		msg := array(bulk("message"), bulk(args[0]), bulk(args[1]))
+		for sub := range subs {
+			sub.write(msg)
+		}
+		return []resp.Value{integer(int64(len(subs)))}
+	case "SUBSCRIBE":
+		if len(args) == 0 {
+			return []resp.Value{wrongArgs(cmd)}
+		}
+		replies := make([]resp.Value, len(args))
+		for i, channel := range args {
+			if s.subscribers[channel] == nil {
+				s.subscribers[channel] = make(map[*client]struct{})
+			}
+			s.subscribers[channel][c] = struct{}{}
+			replies[i] = array(bulk("subscribe"), bulk(channel), integer(int64(i+1)))
+		}
+		return replies
+	}
+	if h, found := dataCommands[cmd]; found {
+		if len(args) < h.minArgs {
+			return []resp.Value{wrongArgs(cmd)}
+		}
+		return []resp.Value{h.exec(s, args)}
+	}
+	return []resp.Value{errorf("ERR unknown command '" + cmd + "'")}
+}
+
+// queue queues a command of the transaction of c, returning the reply to send
+func (s *Server) queue(c *client, cmd string, args []string) resp.Value {
+	h, found := dataCommands[cmd]
+	switch {
+	case !found:
+		c.aborted = true
+		return errorf("ERR unknown command '" + cmd + "'")
+	case len(args) < h.minArgs:
+		c.aborted = true
+		return wrongArgs(cmd)
+	}
+	c.queued = append(c.queued, append([]string{cmd}, args...))
+	return simple("QUEUED")
+}
+
+// execQueued executes the transaction of c, unless a watched key has been modified, in which case
+// it returns a null array. Watched items are compared by value, so unlike Redis a key modified and
+// then restored is not considered modified.
+func (s *Server) execQueued(c *client) resp.Value {
+	defer c.reset()
+	if c.aborted {
+		return errorf("EXECABORT Transaction discarded because of previous errors.")
+	}
+	for key, it := range c.watched {
+		if !reflect.DeepEqual(copyItem(s.lookup(key)), it) {
+			return resp.Value{Kind: resp.Array, Null: true}
+		}
+	}
+	replies := make([]resp.Value, len(c.queued))
+	for i, cmd := range c.queued {
+		replies[i] = dataCommands[cmd[0]].exec(s, cmd[1:])
+	}
+	return array(replies...)
+}
+
+func (c *client) reset() {
+	c.multi, c.aborted, c.queued, c.watched = false, false, nil, nil
+}
+
+// copyItem returns a deep copy of it, nil if it is nil
+func copyItem(it *item) *item {
+	if it == nil {
+		return nil
+	}
+	cp := *it
+	if it.hash != nil {
+		cp.hash = make(map[string]string, len(it.hash))
+		for k, v := range it.hash {
+			cp.hash[k] = v
+		}
+	}
+	return &cp
+}
+
+// dataCommand executes a command on the stored data, with s.m held
+type dataCommand struct {
+	minArgs int
+	exec    func(s *Server, args []string) resp.Value
+}
+
+var dataCommands = map[string]dataCommand{
+	"GET": {1, func(s *Server, args []string) resp.Value {
+		it, errReply := s.get(args[0], false)
+		if it == nil {
+			return errReply
+		}
+		return bulk(it.str)
+	}},
+	"SET": {2, func(s *Server, args []string) resp.Value {
+		s.data[args[0]] = &item{str: args[1]}
+		return simple("OK")
+	}},
+	"INCR": {1, func(s *Server, args []string) resp.Value {
+		return s.incrBy(args[0], "1")
+	}},
+	"INCRBY": {2, func(s *Server, args []string) resp.Value {
+		return s.incrBy(args[0], args[1])
+	}},
+	"DEL": {1, func(s *Server, args []string) resp.Value {
+		var n int64
+		for _, key := range args {
+			if s.lookup(key) != nil {
+				delete(s.data, key)
+				n++
+			}
+		}
+		return integer(n)
+	}},
+	"EXISTS": {1, func(s *Server, args []string) resp.Value {
+		var n int64
+		for _, key := range args {
+			if s.lookup(key) != nil {
+				n++
+			}
+		}
+		return integer(n)
+	}},
+	"EXPIRE": {2, func(s *Server, args []string) resp.Value {
+		secs, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return errorf("ERR value is not an integer or out of range")
+		}
+		it := s.lookup(args[0])
+		if it == nil {
+			return integer(0)
+		}
+		it.expires = s.now.Add(time.Duration(secs) * time.Second)
+		return integer(1)
+	}},
+	"TTL": {1, func(s *Server, args []string) resp.Value {
+		it := s.lookup(args[0])
+		switch {
+		case it == nil:
+			return integer(-2)
+		case it.expires.IsZero():
+			return integer(-1)
+		}
+		return integer(int64(it.expires.Sub(s.now).Seconds()))
+	}},
+	"HGET": {2, func(s *Server, args []string) resp.Value {
+		h := s.getHash(args[0])
+		if h == nil {
+			return resp.Value{Kind: resp.BulkString, Null: true}
+		}
+		v, found := h[args[1]]
+		if !found {
+			return resp.Value{Kind: resp.BulkString, Null: true}
+		}
+		return bulk(v)
+	}},
+	"HMGET": {2, func(s *Server, args []string) resp.Value {
+		h := s.getHash(args[0])
+		elems := make([]resp.Value, len(args)-1)
+		for i, field := range args[1:] {
+			if v, found := h[field]; found {
+				elems[i] = bulk(v)
+			} else {
+				elems[i] = resp.Value{Kind: resp.BulkString, Null: true}
+			}
+		}
+		return array(elems...)
+	}},
+	"HSET": {3, func(s *Server, args []string) resp.Value {
+		if len(args)%2 != 1 {
+			return wrongArgs("HSET")
+		}
+		h := s.getHash(args[0])
+		if h == nil {
+			h = make(map[string]string)
+			s.data[args[0]] = &item{hash: h}
+		}
+		var n int64
+		for i := 1; i < len(args); i += 2 {
+			if _, found := h[args[i]]; !found {
+				n++
+			}
+			h[args[i]] = args[i+1]
+		}
+		return integer(n)
+	}},
+	"HSETNX": {3, func(s *Server, args []string) resp.Value {
+		h := s.getHash(args[0])
+		if h == nil {
+			h = make(map[string]string)
+			s.data[args[0]] = &item{hash: h}
+		}
+		if _, found := h[args[1]]; found {
+			return integer(0)
+		}
+		h[args[1]] = args[2]
+		return integer(1)
+	}},
+	"HINCRBY": {3, func(s *Server, args []string) resp.Value {
+		n, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			return errorf("ERR value is not an integer or out of range")
+		}
+		h := s.getHash(args[0])
+		if h == nil {
+			h = make(map[string]string)
+			s.data[args[0]] = &item{hash: h}
+		}
+		var cur int64
+		if v, found := h[args[1]]; found {
+			if cur, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return errorf("ERR hash value is not an integer")
+			}
+		}
+		h[args[1]] = strconv.FormatInt(cur+n, 10)
+		return integer(cur + n)
+	}},
+	"HGETALL": {1, func(s *Server, args []string) resp.Value {
+		h := s.getHash(args[0])
+		fields := make([]string, 0, len(h))
+		for field := range h {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		elems := make([]resp.Value, 0, 2*len(fields))
+		for _, field := range fields {
+			elems = append(elems, bulk(field), bulk(h[field]))
+		}
+		return array(elems...)
+	}},
+	"HEXISTS": {2, func(s *Server, args []string) resp.Value {
+		if _, found := s.getHash(args[0])[args[1]]; found {
+			return integer(1)
+		}
+		return integer(0)
+	}},
+	"HDEL": {2, func(s *Server, args []string) resp.Value {
+		h := s.getHash(args[0])
+		var n int64
+		for _, field := range args[1:] {
+			if _, found := h[field]; found {
+				delete(h, field)
+				n++
+			}
+		}
+		if h != nil && len(h) == 0 {
+			delete(s.data, args[0])
+		}
+		return integer(n)
+	}},
+	"SCAN": {1, func(s *Server, args []string) resp.Value {
+		// all keys are returned at once, with cursor 0
+		pattern := "*"
+		for i := 1; i+1 < len(args); i += 2 {
+			if strings.EqualFold(args[i], "MATCH") {
+				pattern = args[i+1]
+			}
+		}
+		var keys []string
+		for key := range s.data {
+			if ok, _ := path.Match(pattern, key); ok && s.lookup(key) != nil {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		elems := make([]resp.Value, len(keys))
+		for i, key := range keys {
+			elems[i] = bulk(key)
+		}
+		return array(bulk("0"), array(elems...))
+	}},
+}
+
+// lookup returns the unexpired item stored for key, or nil
+func (s *Server) lookup(key string) *item {
+	it, found := s.data[key]
+	if !found {
+		return nil
+	}
+	if !it.expires.IsZero() && !s.now.Before(it.expires) {
+		delete(s.data, key)
+		return nil
+	}
+	return it
+}
+
+// get returns the string stored for key, or nil and the reply to send if there is none.
+// If create is true a missing string is created.
+func (s *Server) get(key string, create bool) (*item, resp.Value) {
+	it := s.lookup(key)
+	switch {
+	case it == nil && create:
+		it = &item{}
+		s.data[key] = it
+	case it == nil:
+		return nil, resp.Value{Kind: resp.BulkString, Null: true}
+	case it.hash != nil:
+		return nil, wrongType()
+	}
+	return it, resp.Value{}
+}
+
+// getHash returns the hash stored for key, or nil
+func (s *Server) getHash(key string) map[string]string {
+	if it := s.lookup(key); it != nil {
+		return it.hash
+	}
+	return nil
+}
+
+func (s *Server) incrBy(key, by string) resp.Value {
+	n, err := strconv.ParseInt(by, 10, 64)
+	if err != nil {
+		return errorf("ERR value is not an integer or out of range")
+	}
+	it, errReply := s.get(key, true)
+	if it == nil {
+		return errReply
+	}
+	var cur int64
+	if it.str != "" {
+		if cur, err = strconv.ParseInt(it.str, 10, 64); err != nil {
+			return errorf("ERR value is not an integer or out of range")
+		}
+	}
+	it.str = strconv.FormatInt(cur+n, 10)
+	return integer(cur + n)
+}
+
+func simple(s string) resp.Value {
+	return resp.Value{Kind: resp.SimpleString, Str: s}
+}
+
+func bulk(s string) resp.Value {
+	return resp.Value{Kind: resp.BulkString, Str: s}
+}
+
+func integer(i int64) resp.Value {
+	return resp.Value{Kind: resp.Integer, Int: i}
+}
+
+func array(elems ...resp.Value) resp.Value {
+	return resp.Value{Kind: resp.Array, Elems: elems}
+}
+
+func errorf(msg string) resp.Value {
+	return resp.Value{Kind: resp.ErrorReply, Str: msg}
+}
+
+func wrongType() resp.Value {
+	return errorf("WRONGTYPE Operation against a key holding the wrong kind of value")
+}
+
+func wrongArgs(cmd string) resp.Value {
+	return errorf("ERR wrong number of arguments for '" + strings.ToLower(cmd) + "' command")
+}
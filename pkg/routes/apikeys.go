@@ -0,0 +1,39 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+)
+
+// apiKeyHeader is the header identifying the client of management requests
+const apiKeyHeader = "X-API-Key"
+
+// Errors reported to clients sending API keys that are not configured or managing links they do
+// not own
+var (
+	errUnknownAPIKey = errors.New("unknown API key")
+	errNotOwner      = errors.New("link owned by another API key")
+)
+
+// apiKey returns the API key sent with r if it is one of the configured keys, an empty string
+// otherwise
+func apiKey(r *http.Request, c *config) string {
+	key := r.Header.Get(apiKeyHeader)
+	if _, found := c.apiKeys[key]; !found {
+		return ""
+	}
+	return key
+}
+
+// requestOwner returns the owner of the links managed by r: its API key, or an empty string for
+// anonymous requests. It returns errUnknownAPIKey if r carries a key that is not configured, so
+// that quotas and links cannot be claimed with made up keys.
+func requestOwner(r *http.Request, c *config) (string, error) {
+	if r.Header.Get(apiKeyHeader) == "" {
+		return "", nil
+	}
+	if key := apiKey(r, c); key != "" {
+		return key, nil
+	}
+	return "", errUnknownAPIKey
+}
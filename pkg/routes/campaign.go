@@ -0,0 +1,183 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"github.com/giannimassi/shorturl/pkg/domains"
+	"github.com/giannimassi/shorturl/pkg/storage"
+	"github.com/giannimassi/shorturl/pkg/validation"
+)
+
+// campaignField is the name of the payload field holding the campaign parameters
+const campaignField = "Campaign"
+
+// campaignPayload godoc
+type campaignPayload struct {
+	Source  string // Referrer of the visitors, added as utm_source, required if any other parameter is set
+	Medium  string // Marketing medium, added as utm_medium
+	Name    string // Campaign name, added as utm_campaign
+	Term    string // Paid keywords, added as utm_term
+	Content string // Content differentiating links to the same URL, added as utm_content
+}
+
+func (p campaignPayload) campaign() storage.Campaign {
+	return storage.Campaign(p)
+}
+
+func newCampaignPayload(c storage.Campaign) campaignPayload {
+	return campaignPayload(c)
+}
+
+// validateCampaign checks the campaign parameters of a new link, reported as *validation.Error
+func validateCampaign(c storage.Campaign, template bool) error {
+	switch {
+	case c.IsZero():
+		return nil
+	case template:
+		return &validation.Error{Field: campaignField, Code: validation.CodeMalformed, Message: "campaign parameters cannot be added to template links"}
+	case c.Source == "":
+		return &validation.Error{Field: campaignField + ".Source", Code: validation.CodeEmpty, Message: "campaign source is required"}
+	}
+	return nil
+}
+
+// applyCampaign sets the UTM parameters of c in the query of u, replacing the ones already present
+func applyCampaign(u *url.URL, c storage.Campaign) {
+	if c.IsZero() {
+		return
+	}
+	query := u.Query()
+	for name, value := range map[string]string{
+		"utm_source":   c.Source,
+		"utm_medium":   c.Medium,
+		"utm_campaign": c.Name,
+		"utm_term":     c.Term,
+		"utm_content":  c.Content,
+	} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	u.RawQuery = query.Encode()
+}
+
+// campaignStatsPayload godoc
+type campaignStatsPayload struct {
+	Campaign campaignPayload // Campaign parameters, all empty for links without campaign
+	Links    int             // Number of links of the campaign
+	Hits     int             // Number of times the links of the campaign have been requested
+}
+
+// splitStatsPayload godoc
+type splitStatsPayload struct {
+	Key      string                `json:"Key"`              // Key of the split link
+	Domain   string                `json:"Domain,omitempty"` // Short domain of the key, omitted for the default domain
+	Variants []variantStatsPayload `json:"Variants"`         // Variants of the link with their hits
+}
+
+// statsResponsePayload godoc
+type statsResponsePayload struct {
+	Links     int                    // Number of links
+	Hits      int                    // Number of times the links have been requested
+	Campaigns []campaignStatsPayload // Links and hits grouped by campaign, the most requested first
+	Splits    []splitStatsPayload    // Hits of each variant of the split links, by key
+}
+
+// statsHandler returns an http.Handler reporting the hits of the stored links grouped by campaign.
+// Every link is read from the storage, so the report is meant for occasional use.
+// @Summary Return link statistics
+// @Description Returns the number of links and hits, in total and grouped by campaign, and the hits of each variant of split links, optionally restricted to a short domain
+// @Produce json
+// @Produce application/problem+json
+// @Param domain query string false "Short domain of the links, all domains if empty"
+// @Success 200 {object} statsResponsePayload
+// @Failure 422 {object} problemPayload "The domain is not registered"
+// @Failure 429 {object} problemPayload "Too many requests from the client, retry after the Retry-After header seconds"
+// @Failure 500 {object} problemPayload "The server has encountered an unknown error"
+// @Failure 503 {object} problemPayload "The storage did not respond in time"
+// @Router /api/stats [get]
+func statsHandler(s ShortURLProvider, c *config) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, span := startSpan(r, "statsHandler")
+		defer span.End()
+		domain := r.URL.Query().Get("domain")
+		host, err := payloadDomain(c, domain)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		keys, err := s.Keys(r.Context())
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		stats := statsResponsePayload{Splits: []splitStatsPayload{}}
+		byCampaign := make(map[storage.Campaign]*campaignStatsPayload)
+		for _, key := range keys {
+			h, k := domains.SplitKey(key)
+			if domain != "" && h != host {
+				continue
+			}
+			hits, md, err := linkStats(r.Context(), s, key)
+			if errors.Is(err, storage.ErrKeyNotFound) {
+				continue // deleted in the meantime
+			}
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			cs, found := byCampaign[md.Campaign]
+			if !found {
+				cs = &campaignStatsPayload{Campaign: newCampaignPayload(md.Campaign)}
+				byCampaign[md.Campaign] = cs
+			}
+			cs.Links++
+			cs.Hits += hits
+			stats.Links++
+			stats.Hits += hits
+
+			if len(md.Variants) > 0 {
+				vHits, err := variantHits(r.Context(), s, key)
+				if err != nil && !errors.Is(err, storage.ErrKeyNotFound) {
+					writeError(w, r, err)
+					return
+				}
+				stats.Splits = append(stats.Splits, splitStatsPayload{Key: k, Domain: h, Variants: newVariantStats(md.Variants, vHits)})
+			}
+		}
+
+		stats.Campaigns = make([]campaignStatsPayload, 0, len(byCampaign))
+		for _, cs := range byCampaign {
+			stats.Campaigns = append(stats.Campaigns, *cs)
+		}
+		sort.Slice(stats.Campaigns, func(i, j int) bool {
+			a, b := stats.Campaigns[i], stats.Campaigns[j]
+			if a.Hits != b.Hits {
+				return a.Hits > b.Hits
+			}
+			if a.Campaign.Name != b.Campaign.Name {
+				return a.Campaign.Name < b.Campaign.Name
+			}
+			return a.Campaign.Source < b.Campaign.Source
+		})
+		addLogFields(r, "outcome", "found")
+		w.Header().Add("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(&stats)
+	})
+}
+
+// linkStats returns the number of hits and the metadata of the link for key
+func linkStats(ctx context.Context, s ShortURLProvider, key string) (int, storage.Metadata, error) {
+	_, hits, err := s.ShortURLInfo(ctx, key)
+	if err != nil {
+		return 0, storage.Metadata{}, err
+	}
+	md, err := s.Metadata(ctx, key)
+	return hits, md, err
+}
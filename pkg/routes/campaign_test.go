@@ -0,0 +1,85 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/giannimassi/shorturl/pkg/domains"
+	"github.com/giannimassi/shorturl/pkg/logging"
+	"github.com/giannimassi/shorturl/pkg/storage"
+	"github.com/giannimassi/shorturl/pkg/validation"
+	"github.com/gin-gonic/gin"
+)
+
+func Test_applyCampaign(t *testing.T) {
+	u, _ := validation.DefaultURLPolicy().NormalizeURL("https://example.org/sale?utm_source=old&id=1")
+	applyCampaign(u, storage.Campaign{Source: "newsletter", Medium: "email", Name: "spring sale"})
+	expected := "https://example.org/sale?id=1&utm_campaign=spring+sale&utm_medium=email&utm_source=newsletter"
+	if u.String() != expected {
+		t.Errorf("got %v want %v", u, expected)
+	}
+}
+
+func Test_stats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	reg := domains.NewRegistry()
+	if _, err := reg.Register(domains.Domain{Host: "links.brand"}); err != nil {
+		t.Fatal(err)
+	}
+	r := newRouter(storage.NewMemoryStore(), newConfig(WithLogger(logging.Discard(), 0), WithDomains(reg)))
+
+	serve := func(method, host, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, "http://"+host+path, strings.NewReader(body)))
+		return w
+	}
+	add := func(key, domain, campaign string) *httptest.ResponseRecorder {
+		return serve("PUT", "short.example", "/api", fmt.Sprintf(`{"Key":%q,"Domain":%q,"URL":"https://example.org/%s","Campaign":%s}`, key, domain, key, campaign))
+	}
+
+	for _, link := range []struct{ key, domain, campaign string }{
+		{"mail1", "", `{"Source":"newsletter","Medium":"email","Name":"spring"}`},
+		{"mail2", "", `{"Source":"newsletter","Medium":"email","Name":"spring"}`},
+		{"social", "links.brand", `{"Source":"twitter","Name":"spring"}`},
+		{"plain", "", `{}`},
+	} {
+		if w := add(link.key, link.domain, link.campaign); w.Code != http.StatusOK {
+			t.Fatalf("wrong status code adding %s: %v %s", link.key, w.Code, w.Body)
+		}
+	}
+	assertProblem(t, add("nosource", "", `{"Name":"spring"}`), http.StatusUnprocessableEntity, validation.CodeEmpty)
+	assertProblem(t, serve("PUT", "short.example", "/api", `{"Key":"tmpl","URL":"https://example.org/{1}","Template":true,"Campaign":{"Source":"a"}}`),
+		http.StatusUnprocessableEntity, validation.CodeMalformed)
+
+	w := serve("GET", "short.example", "/mail1", "")
+	if location := w.Header().Get("Location"); location != "https://example.org/mail1?utm_campaign=spring&utm_medium=email&utm_source=newsletter" {
+		t.Errorf("unexpected location: %v", location)
+	}
+	serve("GET", "short.example", "/mail2", "")
+	serve("GET", "short.example", "/mail2", "")
+	serve("GET", "links.brand", "/social", "")
+
+	var stats statsResponsePayload
+	if err := json.NewDecoder(serve("GET", "short.example", "/api/stats", "").Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Links != 4 || stats.Hits != 4 || len(stats.Campaigns) != 3 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if c := stats.Campaigns[0]; c.Campaign.Source != "newsletter" || c.Links != 2 || c.Hits != 3 {
+		t.Errorf("unexpected campaign stats: %+v", c)
+	}
+
+	stats = statsResponsePayload{}
+	if err := json.NewDecoder(serve("GET", "short.example", "/api/stats?domain=links.brand", "").Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Links != 1 || stats.Hits != 1 || len(stats.Campaigns) != 1 || stats.Campaigns[0].Campaign.Source != "twitter" {
+		t.Errorf("unexpected domain stats: %+v", stats)
+	}
+	assertProblem(t, serve("GET", "short.example", "/api/stats?domain=other.example", ""), http.StatusUnprocessableEntity, domains.CodeUnknownDomain)
+}
@@ -0,0 +1,199 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/giannimassi/shorturl/pkg/domains"
+	"github.com/giannimassi/shorturl/pkg/validation"
+)
+
+// domainField is the name of the payload field selecting the domain of a link
+const domainField = "Domain"
+
+// requestDomain returns the registered domain the request is addressed to, or the default domain
+// whose host is empty
+func requestDomain(r *http.Request, c *config) domains.Domain {
+	if c.domains != nil {
+		if d, found := c.domains.Lookup(r.Host); found {
+			return d
+		}
+	}
+	return c.defaultDomain
+}
+
+// payloadKey returns the storage key of key in the keyspace of the domain named in a payload,
+// the default domain if empty
+func payloadKey(c *config, domain, key string) (string, error) {
+	host, err := payloadDomain(c, domain)
+	if err != nil {
+		return "", err
+	}
+	return domains.ScopedKey(host, key), nil
+}
+
+// payloadDomain returns the normalized host of the domain named in a request, empty for the
+// default domain, or an error if it is not registered
+func payloadDomain(c *config, domain string) (string, error) {
+	if domain == "" {
+		return "", nil
+	}
+	var d domains.Domain
+	found := false
+	if c.domains != nil {
+		d, found = c.domains.Lookup(domain)
+	}
+	if !found {
+		return "", &validation.Error{Field: domainField, Code: domains.CodeUnknownDomain, Message: "domain " + domain + " is not registered"}
+	}
+	return d.Host, nil
+}
+
+// isSelfReference returns true if host is one of the registered domains
+func isSelfReference(c *config, host string) bool {
+	if c.domains == nil {
+		return false
+	}
+	_, found := c.domains.Lookup(host)
+	return found
+}
+
+// domainPayload godoc
+type domainPayload struct {
+	Host        string // Host name of the short domain
+	NotFound    string // Response to unknown keys: plain, redirect or page, redirect if empty and a fallback URL is set, plain otherwise
+	FallbackURL string // Optional URL to redirect to when a key is not found, linked from the not found page
+	Brand       string // Optional name shown on the not found page, the host if empty
+}
+
+// listDomainsHandler returns an http.Handler listing the registered domains
+// @Summary List short domains
+// @Description Returns the short domains served in addition to the default one
+// @Produce json
+// @Produce application/problem+json
+// @Success 200 {array} domainPayload
+// @Failure 429 {object} problemPayload "Too many requests from the client, retry after the Retry-After header seconds"
+// @Router /api/domains [get]
+func listDomainsHandler(c *config) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		list := c.domains.List()
+		payload := make([]domainPayload, len(list))
+		for i, d := range list {
+			payload[i] = newDomainPayload(d)
+		}
+		w.Header().Add("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(payload)
+	})
+}
+
+// registerDomainHandler returns an http.Handler registering a short domain
+// @Summary Register short domain
+// @Description Registers a short domain with its own keyspace, replacing its settings if already registered by the same API key. The domain is persisted in the storage when it supports it.
+// @Accept json
+// @Produce json
+// @Produce application/problem+json
+// @Param X-API-Key header string false "API key owning the domain"
+// @Param payload body domainPayload true "Domain to register"
+// @Success 200 {object} domainPayload
+// @Failure 400 {object} problemPayload "Payload cannot be decoded"
+// @Failure 401 {object} problemPayload "API key not valid"
+// @Failure 403 {object} problemPayload "Domain registered by another API key or configured at startup"
+// @Failure 422 {object} problemPayload "Host or fallback URL in the payload is malformed or not allowed"
+// @Failure 429 {object} problemPayload "Too many requests from the client, retry after the Retry-After header seconds"
+// @Failure 500 {object} problemPayload "The server has encountered an unknown error"
+// @Failure 503 {object} problemPayload "The storage did not respond in time"
+// @Router /api/domains [put]
+func registerDomainHandler(c *config) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload domainPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writePayloadError(w, r, err)
+			return
+		}
+		owner, err := requestOwner(r, c)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		d := domains.Domain{Host: payload.Host, NotFound: domains.NotFoundMode(payload.NotFound), Brand: payload.Brand, Owner: owner}
+		if payload.FallbackURL != "" {
+			u, err := c.urlPolicy.NormalizeURL(payload.FallbackURL)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			if isSelfReference(c, u.Hostname()) {
+				writeError(w, r, &validation.Error{Field: validation.URLField, Code: validation.CodeSelfReference, Message: "fallback url points to a short domain"})
+				return
+			}
+			d.FallbackURL = u.String()
+		}
+		ctx, cancel := storageContext(r, c)
+		defer cancel()
+		d, err = c.domains.Save(ctx, d)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		addLogFields(r, "domain", d.Host, "outcome", "registered")
+		w.Header().Add("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(newDomainPayload(d))
+	})
+}
+
+func newDomainPayload(d domains.Domain) domainPayload {
+	return domainPayload{Host: d.Host, NotFound: string(d.NotFound), FallbackURL: d.FallbackURL, Brand: d.Brand}
+}
+
+// deleteDomainRequestPayload godoc
+type deleteDomainRequestPayload struct {
+	Host string // Host name of the short domain to remove
+}
+
+// deleteDomainHandler returns an http.Handler removing a short domain
+// @Summary Remove short domain
+// @Description Stops serving a short domain. Its links are kept and served again if the domain is registered anew. Only the API key that registered the domain can remove it.
+// @Accept json
+// @Produce application/problem+json
+// @Param X-API-Key header string false "API key owning the domain"
+// @Param payload body deleteDomainRequestPayload true "Domain to remove"
+// @Success 200 "Domain removed"
+// @Failure 400 {object} problemPayload "Payload cannot be decoded"
+// @Failure 401 {object} problemPayload "API key not valid"
+// @Failure 403 {object} problemPayload "Domain registered by another API key or configured at startup"
+// @Failure 404 {object} problemPayload "Domain not registered"
+// @Failure 429 {object} problemPayload "Too many requests from the client, retry after the Retry-After header seconds"
+// @Failure 500 {object} problemPayload "The server has encountered an unknown error"
+// @Failure 503 {object} problemPayload "The storage did not respond in time"
+// @Router /api/domains [delete]
+func deleteDomainHandler(c *config) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload deleteDomainRequestPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writePayloadError(w, r, err)
+			return
+		}
+		owner, err := requestOwner(r, c)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		ctx, cancel := storageContext(r, c)
+		defer cancel()
+		if err := c.domains.Remove(ctx, payload.Host, owner); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		addLogFields(r, "domain", payload.Host, "outcome", "removed")
+	})
+}
+
+// storageContext returns the context of r bounded by the storage timeout, for the storage
+// operations that are not performed through the Provider, which is bounded already
+func storageContext(r *http.Request, c *config) (context.Context, context.CancelFunc) {
+	if c.storageTimeout <= 0 {
+		return context.WithCancel(r.Context())
+	}
+	return context.WithTimeout(r.Context(), c.storageTimeout)
+}
@@ -0,0 +1,152 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/giannimassi/shorturl/pkg/domains"
+	"github.com/giannimassi/shorturl/pkg/logging"
+	"github.com/giannimassi/shorturl/pkg/storage"
+	"github.com/giannimassi/shorturl/pkg/validation"
+	"github.com/gin-gonic/gin"
+)
+
+func Test_domains(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c := newConfig(WithLogger(logging.Discard(), 0), WithDomains(domains.NewRegistry()))
+	r := newRouter(storage.NewMemoryStore(), c)
+
+	serve := func(method, host, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "http://"+host+path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	add := func(domain, key, url string) *httptest.ResponseRecorder {
+		return serve("PUT", "short.example", "/api", fmt.Sprintf(`{"Key":%q,"Domain":%q,"URL":%q}`, key, domain, url))
+	}
+	assertRedirect := func(w *httptest.ResponseRecorder, status int, location string) {
+		t.Helper()
+		if w.Code != status || w.Header().Get("Location") != location {
+			t.Errorf("unexpected response: got %v %q want %v %q", w.Code, w.Header().Get("Location"), status, location)
+		}
+	}
+
+	assertProblem(t, add("go.company", "wiki", "https://wiki.company"), http.StatusUnprocessableEntity, domains.CodeUnknownDomain)
+
+	if w := serve("PUT", "short.example", "/api/domains", `{"Host":"Go.Company"}`); w.Code != http.StatusOK {
+		t.Fatalf("wrong status code registering domain: %v", w.Code)
+	}
+	if w := serve("PUT", "short.example", "/api/domains", `{"Host":"links.brand","FallbackURL":"https://brand.example"}`); w.Code != http.StatusOK {
+		t.Fatalf("wrong status code registering domain: %v", w.Code)
+	}
+	assertProblem(t, serve("PUT", "short.example", "/api/domains", `{"Host":"x.brand","FallbackURL":"https://go.company/home"}`),
+		http.StatusUnprocessableEntity, validation.CodeSelfReference)
+
+	for _, tt := range []struct{ domain, url string }{
+		{"", "https://example.org/default"},
+		{"go.company", "https://wiki.company"},
+		{"links.brand", "https://brand.example/wiki"},
+	} {
+		if w := add(tt.domain, "wiki", tt.url); w.Code != http.StatusOK {
+			t.Fatalf("wrong status code adding wiki to %q: %v %s", tt.domain, w.Code, w.Body)
+		}
+	}
+	assertProblem(t, add("go.company", "loop", "https://links.brand/wiki"), http.StatusUnprocessableEntity, validation.CodeSelfReference)
+
+	assertRedirect(serve("GET", "short.example", "/wiki", ""), http.StatusMovedPermanently, "https://example.org/default")
+	assertRedirect(serve("GET", "go.company", "/wiki", ""), http.StatusMovedPermanently, "https://wiki.company")
+	assertRedirect(serve("GET", "links.brand:8080", "/wiki", ""), http.StatusMovedPermanently, "https://brand.example/wiki")
+
+	assertRedirect(serve("GET", "links.brand", "/unknown", ""), http.StatusFound, "https://brand.example")
+	assertRedirect(serve("GET", "links.brand", "/", ""), http.StatusFound, "https://brand.example")
+	if w := serve("GET", "go.company", "/unknown", ""); w.Code != http.StatusNotFound {
+		t.Errorf("wrong status code for unknown key without fallback: %v", w.Code)
+	}
+
+	w := serve("GET", "short.example", "/api", `{"Key":"wiki","Domain":"go.company"}`)
+	var info infoResponsePayload
+	if err := json.NewDecoder(w.Body).Decode(&info); err != nil || info.Domain != "go.company" || info.URL != "https://wiki.company" || info.Hits != 1 {
+		t.Errorf("unexpected info: %+v %v", info, err)
+	}
+
+	if w := serve("DELETE", "short.example", "/api", `{"Key":"wiki","Domain":"go.company"}`); w.Code != http.StatusOK {
+		t.Fatalf("wrong status code deleting: %v", w.Code)
+	}
+	if w := serve("GET", "go.company", "/wiki", ""); w.Code != http.StatusNotFound {
+		t.Errorf("wrong status code for deleted key: %v", w.Code)
+	}
+	assertRedirect(serve("GET", "short.example", "/wiki", ""), http.StatusMovedPermanently, "https://example.org/default")
+
+	if w := serve("DELETE", "short.example", "/api/domains", `{"Host":"links.brand"}`); w.Code != http.StatusOK {
+		t.Fatalf("wrong status code removing domain: %v", w.Code)
+	}
+	assertProblem(t, serve("DELETE", "short.example", "/api/domains", `{"Host":"links.brand"}`), http.StatusNotFound, codeDomainNotFound)
+	assertRedirect(serve("GET", "links.brand", "/wiki", ""), http.StatusMovedPermanently, "https://example.org/default")
+
+	var list []domainPayload
+	if err := json.NewDecoder(serve("GET", "short.example", "/api/domains", "").Body).Decode(&list); err != nil || len(list) != 1 || list[0].Host != "go.company" {
+		t.Errorf("unexpected domains: %+v %v", list, err)
+	}
+}
+
+func Test_domains_owner(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	registry := domains.NewRegistry()
+	if _, err := registry.Register(domains.Domain{Host: "go.company"}); err != nil {
+		t.Fatal(err)
+	}
+	r := newRouter(storage.NewMemoryStore(), newConfig(WithLogger(logging.Discard(), 0), WithDomains(registry), WithAPIKeys("team1", "team2")))
+
+	serve := func(method, apiKey, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/domains", strings.NewReader(body))
+		if apiKey != "" {
+			req.Header.Set(apiKeyHeader, apiKey)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assertProblem(t, serve("PUT", "made-up", `{"Host":"team.brand"}`), http.StatusUnauthorized, codeUnknownAPIKey)
+	if w := serve("PUT", "team1", `{"Host":"team.brand"}`); w.Code != http.StatusOK {
+		t.Fatalf("wrong status code registering domain: %v", w.Code)
+	}
+	assertProblem(t, serve("PUT", "team2", `{"Host":"team.brand","FallbackURL":"https://evil.example"}`), http.StatusForbidden, codeNotOwner)
+	assertProblem(t, serve("PUT", "", `{"Host":"team.brand"}`), http.StatusForbidden, codeNotOwner)
+	assertProblem(t, serve("PUT", "team1", `{"Host":"go.company"}`), http.StatusForbidden, codeNotOwner)
+
+	assertProblem(t, serve("DELETE", "made-up", `{"Host":"team.brand"}`), http.StatusUnauthorized, codeUnknownAPIKey)
+	assertProblem(t, serve("DELETE", "team2", `{"Host":"team.brand"}`), http.StatusForbidden, codeNotOwner)
+	assertProblem(t, serve("DELETE", "", `{"Host":"go.company"}`), http.StatusForbidden, codeNotOwner)
+	if d, found := registry.Lookup("team.brand"); !found || d.FallbackURL != "" {
+		t.Errorf("domain changed by another API key: %+v %v", d, found)
+	}
+	if w := serve("DELETE", "team1", `{"Host":"team.brand"}`); w.Code != http.StatusOK {
+		t.Fatalf("wrong status code removing domain: %v", w.Code)
+	}
+	if _, found := registry.Lookup("go.company"); !found {
+		t.Error("configured domain removed")
+	}
+}
+
+func Test_selfHosts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	policy := validation.DefaultURLPolicy()
+	policy.SelfHosts = []string{"sho.rt"}
+	r := newRouter(storage.NewMemoryStore(), newConfig(WithLogger(logging.Discard(), 0), WithURLPolicy(policy)))
+
+	for _, body := range []string{
+		`{"Key":"a","URL":"https://sho.rt/b"}`,
+		`{"Key":"a","URL":"https://example.org","Rules":[{"Platforms":["ios"],"URL":"https://www.sho.rt/b"}]}`,
+		`{"Key":"a","URL":"https://example.org","NotBefore":"2100-01-01T00:00:00Z","ComingSoonURL":"https://sho.rt/soon"}`,
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("PUT", "/api", strings.NewReader(body)))
+		assertProblem(t, w, http.StatusUnprocessableEntity, validation.CodeSelfReference)
+	}
+}
@@ -1,13 +1,24 @@
 package routes
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
-	"net/url"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/giannimassi/shorturl/pkg/domains"
+	"github.com/giannimassi/shorturl/pkg/quota"
+	"github.com/giannimassi/shorturl/pkg/ratelimit"
+	"github.com/giannimassi/shorturl/pkg/screening"
 	"github.com/giannimassi/shorturl/pkg/storage"
+	"github.com/giannimassi/shorturl/pkg/tracing"
+	"github.com/giannimassi/shorturl/pkg/validation"
 	"github.com/gin-gonic/gin"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"github.com/swaggo/gin-swagger/swaggerFiles"
@@ -17,14 +28,7 @@ import (
 
 // ShortURLProvider is the repository from which short url are fetched.
 type ShortURLProvider interface {
-	// ShortURL returns true if a short url is found for the provided key, false otherwise
-	ShortURL(key string) (*url.URL, error)
-	// AddURL allows to store a key-url association
-	AddURL(key string, u url.URL) error
-	// DeleteURLByKey allows to Delete a key-url association for the specified key
-	DeleteURL(key string) error
-	// ShortURLInfo returns true and the number of hits if a short url is found for the provided key, false otherwise
-	ShortURLInfo(key string) (*url.URL, int, error)
+	storage.Provider
 }
 
 // @title Shorturl API
@@ -42,50 +46,259 @@ type ShortURLProvider interface {
 // @host localhost:8080
 // @BasePath /api
 
-// Start runs the server, setting up all required routes
-func Start(s ShortURLProvider) error {
+// Start runs the server, setting up all required routes. On SIGINT or SIGTERM the server reports
+// not to be ready, waits for the configured shutdown delay and then shuts down gracefully.
+func Start(s ShortURLProvider, opts ...Option) error {
+	c := newConfig(opts...)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if c.quotas != nil {
+		if err := c.quotas.Load(ctx, s); err != nil {
+			return fmt.Errorf("loading quota usage: %w", err)
+		}
+	}
+	srv := &http.Server{Addr: ":8080", Handler: newRouter(s, c)}
+
+	if c.quotas != nil && c.quotaReload > 0 {
+		go c.quotas.Run(ctx, s, c.quotaReload)
+	}
+	if c.screener != nil && c.recheckInterval > 0 {
+		go screening.NewRechecker(s, c.screener).Run(ctx, c.recheckInterval)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+	c.logger.Info("server started", "addr", srv.Addr)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	select {
+	case err := <-errc:
+		return err
+	case received := <-sig:
+		c.logger.Info("shutting down", "signal", received, "delay", c.shutdownDelay)
+	}
+
+	c.health.setShuttingDown()
+	time.Sleep(c.shutdownDelay)
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+	return srv.Shutdown(shutdownCtx)
+}
+
+// newRouter returns a router serving all routes
+func newRouter(s ShortURLProvider, c *config) *gin.Engine {
+	s = storage.WithTimeout(s, c.storageTimeout)
+	if c.tracer != nil {
+		s = tracing.InstrumentProvider(s)
+	}
+	s = withStorageTiming(s)
+	c.keyIndex = newKeyIndex(s)
+	c.passwordAttempts = ratelimit.New(c.passwordLimit)
+	c.passwordLinkAttempts = ratelimit.New(c.passwordLinkLimit)
+
 	r := gin.New()
-	r.Use(gin.Logger())
-	r.Use(gin.Recovery())
+	r.Use(requestIDMiddleware())
+	if c.tracer != nil {
+		r.Use(tracingMiddleware(c.tracer))
+	}
+	r.Use(loggingMiddleware(c))
+	r.Use(recoveryMiddleware())
+	if c.metrics != nil {
+		r.Use(metricsMiddleware(c.metrics))
+		r.GET("/metrics", gin.WrapH(c.metrics.Handler()))
+	}
 
-	r.NoRoute(gin.WrapF(redirectHandler(s)))
+	lm := newLimiterMetrics(c.metrics)
+	r.NoRoute(rateLimitMiddleware(redirectLimiterName, c.redirectLimit, false, c, lm), gin.WrapF(redirectHandler(s, c)))
 
-	api := r.Group("/api")
-	api.GET("", gin.WrapF(infoHandler(s)))
-	api.PUT("", gin.WrapF(addURLHandler(s)))
-	api.DELETE("", gin.WrapF(deleteURLHandler(s)))
+	api := r.Group("/api", rateLimitMiddleware(apiLimiterName, c.apiLimit, true, c, lm))
+	api.GET("", gin.WrapF(infoHandler(s, c)))
+	api.PUT("", gin.WrapF(addURLHandler(s, c)))
+	api.DELETE("", gin.WrapF(deleteURLHandler(s, c)))
+	api.GET("/stats", gin.WrapF(statsHandler(s, c)))
+	api.GET("/links", gin.WrapF(listLinksHandler(s, c)))
+	if c.quotas != nil {
+		api.GET("/usage", gin.WrapF(usageHandler(c)))
+	}
+	if c.misses != nil {
+		api.GET("/misses", gin.WrapF(missesHandler(c)))
+	}
+	if c.domains != nil {
+		api.GET("/domains", gin.WrapF(listDomainsHandler(c)))
+		api.PUT("/domains", gin.WrapF(registerDomainHandler(c)))
+		api.DELETE("/domains", gin.WrapF(deleteDomainHandler(c)))
+	}
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
-	return r.Run(":8080")
+	r.GET("/healthz", gin.WrapF(livenessHandler()))
+	r.GET("/readyz", gin.WrapF(readinessHandler(s, c)))
+
+	c.keyPolicy.Reserved = append(c.keyPolicy.Reserved, reservedKeys(r.Routes())...)
+	return r
 }
 
-// redirectHandler implements a handler that redirects to the url associated with the provided code
+// reservedKeys returns the first path segment of each route, which would be shadowed by a key
+// with the same name
+func reservedKeys(routes gin.RoutesInfo) []string {
+	var keys []string
+	for _, route := range routes {
+		segment := strings.SplitN(strings.TrimPrefix(route.Path, "/"), "/", 2)[0]
+		if segment != "" {
+			keys = append(keys, segment)
+		}
+	}
+	return keys
+}
+
+// redirectHandler implements a handler that redirects to the url associated with the provided code.
+// A warning page is shown instead if the link has been flagged as unsafe, and a preview page
+// if requested or if the link always requires one. Keys are looked up in the keyspace of the
+// registered domain matching the Host header, if any, whose fallback url is used for unknown keys.
+// The key is the first segment of the path: the following segments are the arguments of template
+// links, the rest of the path and the query are forwarded to the url of passthrough links, and any
+// other link is not found if followed by more segments.
 // NOTE: only GET requests are supported and tested.
 // Reference: https://tools.ietf.org/html/rfc7231#section-6.4.2
-func redirectHandler(s ShortURLProvider) http.HandlerFunc {
+func redirectHandler(s ShortURLProvider, c *config) http.HandlerFunc {
+	preview := previewHandler(s, c)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		key := keyFromRequestURLPath(r.URL.Path)
-		shortURL, err := s.ShortURL(key)
-		if errors.Is(err, storage.ErrKeyNotFound) {
-			w.WriteHeader(http.StatusNotFound)
+		if isPreviewRequest(r) {
+			preview(w, r)
 			return
-		} else if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+		}
+		r, span := startSpan(r, "redirectHandler")
+		defer span.End()
+		d := requestDomain(r, c)
+		if d.Host != "" {
+			addLogFields(r, "domain", d.Host)
+		}
+		rawKey, rest := splitRequestPath(r.URL.EscapedPath())
+		key, err := c.keyPolicy.ParseKey(rawKey)
+		if err != nil {
+			writeNotFound(w, r, c, d, "")
+			return
+		}
+		addLogFields(r, "key", key)
+		storageKey := domains.ScopedKey(d.Host, key)
+
+		// the metadata is checked before counting a hit, which is not counted for paths the link does
+		// not accept, outside of its activation window nor for requests of the password form
+		md, err := s.Metadata(r.Context(), storageKey)
+		if err != nil {
+			writeRedirectError(w, r, c, d, key, err)
+			return
+		}
+		if rest != "" && !acceptsPath(md, rest) {
+			writeNotFound(w, r, c, d, "")
+			return
+		}
+		if !checkSchedule(w, r, key, md) {
 			return
 		}
-		http.Redirect(w, r, shortURL.String(), http.StatusMovedPermanently)
+		if !checkAccess(w, r, c, storageKey, key, md) {
+			return
+		}
+		shortURL, err := s.ShortURL(r.Context(), storageKey)
+		if err != nil {
+			writeRedirectError(w, r, c, d, key, err)
+			return
+		}
+		// the target of links with rules or variants depends on the client, and links with an end
+		// stop redirecting, so their redirects must not be cached as permanent. Redirects of protected
+		// links are not cached at all, so that the password is asked again once the access expires.
+		status := http.StatusMovedPermanently
+		if !md.NotAfter.IsZero() {
+			status = http.StatusFound
+		}
+		if md.PasswordHash != "" {
+			status = http.StatusFound
+			w.Header().Set("Cache-Control", "no-store, private")
+		}
+		matched := false
+		if len(md.Rules) > 0 {
+			status = http.StatusFound
+			w.Header().Add("Vary", "User-Agent, Accept-Language")
+			if u, found := ruleTarget(r, c, md.Rules); found {
+				shortURL, matched = u, true
+			}
+		}
+		if len(md.Variants) > 0 && !matched {
+			status = http.StatusFound
+			if shortURL, err = variantTarget(w, r, s, storageKey, key, md); err != nil {
+				writeRedirectError(w, r, c, d, key, err)
+				return
+			}
+		}
+		if shortURL, err = linkTarget(shortURL, rest, r.URL.Query(), md); err != nil {
+			writeRedirectError(w, r, c, d, key, err)
+			return
+		}
+
+		switch {
+		case md.Flag == storage.FlagDisabled:
+			addLogFields(r, "outcome", "disabled")
+			renderPage(w, http.StatusForbidden, warningPage, warningPageData{Key: key, Reason: md.FlagReason, Disabled: true})
+		case md.Flag == storage.FlagWarn:
+			addLogFields(r, "outcome", "warning")
+			renderPage(w, http.StatusOK, warningPage, warningPageData{Key: key, URL: shortURL.String(), Reason: md.FlagReason})
+		case md.Interstitial:
+			addLogFields(r, "outcome", "interstitial")
+			_, hits, _ := s.ShortURLInfo(r.Context(), storageKey)
+			renderPage(w, http.StatusOK, previewPage, newPreviewPageData(key, shortURL.String(), hits, md))
+		default:
+			addLogFields(r, "outcome", "redirect")
+			http.Redirect(w, r, shortURL.String(), status)
+		}
 	})
 }
 
+// writeRedirectError responds to a redirect request of key on d for which the storage returned err
+func writeRedirectError(w http.ResponseWriter, r *http.Request, c *config, d domains.Domain, key string, err error) {
+	switch {
+	case errors.Is(err, storage.ErrKeyNotFound):
+		writeNotFound(w, r, c, d, key)
+	case errors.Is(err, context.DeadlineExceeded):
+		addLogFields(r, "outcome", codeStorageTimeout, "error", err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	case errors.Is(err, context.Canceled):
+		addLogFields(r, "outcome", outcomeCanceled)
+		w.WriteHeader(statusClientClosedRequest)
+	default:
+		addLogFields(r, "outcome", "error", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
 // infoRequestPayload godoc
 type infoRequestPayload struct {
-	Key string // Key for which information is requested
+	Key    string // Key for which information is requested
+	Domain string // Optional short domain of the key, the default domain if empty
 }
 
 // infoResponsePayload godoc
 type infoResponsePayload struct {
-	Key  string // Key for which information was requested
-	URL  string // URL to redirect to
-	Hits int    // Number of times the url has been requested
+	Key    string `json:"Key"`              // Key for which information was requested
+	Domain string `json:"Domain,omitempty"` // Short domain of the key, omitted for the default domain
+	URL    string `json:"URL"`              // URL to redirect to
+	Hits   int    `json:"Hits"`             // Number of times the url has been requested
+	// Routing rules replacing the URL for the clients matching them, omitted if there are none
+	Rules []rulePayload `json:"Rules,omitempty"`
+	// Variants of a split link with their hits, omitted for other links
+	Variants []variantStatsPayload `json:"Variants,omitempty"`
+	Sticky   bool                  `json:"Sticky,omitempty"` // If true clients keep being redirected to the same variant
+	// True if a password is asked before redirecting
+	Protected bool `json:"Protected,omitempty"`
+	// Whether the link redirects now: scheduled, active or ended
+	State storage.State `json:"State"`
+	// When the link starts redirecting, omitted if it was active since its creation
+	NotBefore *time.Time `json:"NotBefore,omitempty"`
+	// When the link stops redirecting, omitted if it never does
+	NotAfter *time.Time `json:"NotAfter,omitempty"`
+	// URL clients are redirected to before NotBefore, omitted if a coming soon page is shown
+	ComingSoonURL string `json:"ComingSoonURL,omitempty"`
 }
 
 // infoHandler implements a handler that returns information about the key-url association
@@ -93,35 +306,71 @@ type infoResponsePayload struct {
 // @Description Returns information about the short url association stored for the provided key
 // @Accept  json
 // @Produce  json
+// @Produce  application/problem+json
 // @Param payload body infoRequestPayload true "Key for which the request is made"
 // @Success 200 {object} infoResponsePayload
-// @Failure 400 "Payload cannot be decoded"
-// @Failure 404 "Key not found"
-// @Failure 500 "The server has encountered an unknown error"
+// @Failure 400 {object} problemPayload "Payload cannot be decoded"
+// @Failure 404 {object} problemPayload "Key not found"
+// @Failure 429 {object} problemPayload "Too many requests from the client, retry after the Retry-After header seconds"
+// @Failure 500 {object} problemPayload "The server has encountered an unknown error"
+// @Failure 503 {object} problemPayload "The storage did not respond in time"
 // @Router /api [get]
-func infoHandler(s ShortURLProvider) http.HandlerFunc {
+func infoHandler(s ShortURLProvider, c *config) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, span := startSpan(r, "infoHandler")
+		defer span.End()
 		dec := json.NewDecoder(r.Body)
 		var inputPayload infoRequestPayload
 		if err := dec.Decode(&inputPayload); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
+			writePayloadError(w, r, err)
 			return
 		}
-		w.Header().Add("Content-Type", "application/json")
 
-		shortURL, hits, err := s.ShortURLInfo(inputPayload.Key)
-		if errors.Is(err, storage.ErrKeyNotFound) {
-			w.WriteHeader(http.StatusNotFound)
+		key, err := c.keyPolicy.ParseKey(inputPayload.Key)
+		if err != nil {
+			writeError(w, r, storage.ErrKeyNotFound)
 			return
-		} else if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+		}
+		addLogFields(r, "key", key)
+		storageKey, err := payloadKey(c, inputPayload.Domain, key)
+		if err != nil {
+			writeError(w, r, err)
 			return
 		}
+		shortURL, hits, err := s.ShortURLInfo(r.Context(), storageKey)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		md, err := s.Metadata(r.Context(), storageKey)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		addLogFields(r, "outcome", "found")
 		outputPayload := infoResponsePayload{
-			Key:  inputPayload.Key,
+			Key:  key,
 			URL:  shortURL.String(),
 			Hits: hits,
 		}
+		outputPayload.Protected = md.PasswordHash != ""
+		outputPayload.State = md.State(time.Now())
+		outputPayload.NotBefore, outputPayload.NotAfter = timePointer(md.NotBefore), timePointer(md.NotAfter)
+		outputPayload.ComingSoonURL = md.ComingSoonURL
+		if len(md.Rules) > 0 {
+			outputPayload.Rules = newRulePayloads(md.Rules)
+		}
+		if len(md.Variants) > 0 {
+			vHits, err := variantHits(r.Context(), s, storageKey)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			outputPayload.Variants = newVariantStats(md.Variants, vHits)
+			outputPayload.Sticky = md.Sticky
+		}
+		outputPayload.Domain, _ = domains.SplitKey(storageKey)
+		w.Header().Add("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(&outputPayload); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -129,83 +378,263 @@ func infoHandler(s ShortURLProvider) http.HandlerFunc {
 	})
 }
 
-func keyFromRequestURLPath(path string) string {
-	return strings.TrimPrefix(path, "/")
-}
-
 // addURLRequestPayload godoc
 type addURLRequestPayload struct {
-	Key string // Key for which the association should be added
-	URL string // URL to add for the key
+	Key          string // Key for which the association should be added
+	Domain       string // Optional short domain of the key, the default domain if empty
+	URL          string // URL to add for the key
+	Title        string // Optional title shown in the preview page
+	Interstitial bool   // If true the preview page is always shown before redirecting
+	Passthrough  bool   // If true the path after the key and the query of requests are forwarded to the URL
+	Template     bool   // If true the URL is a template whose placeholders {1} to {9} are replaced by the path segments after the key
+	// Optional campaign parameters added to the query of the URL, replacing the ones already present
+	Campaign campaignPayload
+	// Optional rules evaluated in order on each redirect, the first one matched by the client replacing the URL
+	Rules []rulePayload
+	// Optional urls requests are distributed across by weight, in which case URL must be empty and
+	// the first variant is reported as the URL of the link
+	Variants []variantPayload
+	// If true clients are assigned a variant with a cookie and keep being redirected to it
+	Sticky bool
+	// Optional password asked before redirecting, stored hashed
+	Password string
+	// Optional start of the activation window of the link, in RFC 3339 format
+	NotBefore time.Time
+	// Optional end of the activation window of the link, in RFC 3339 format
+	NotAfter time.Time
+	// Optional url clients are redirected to before NotBefore, instead of showing a coming soon page
+	ComingSoonURL string
+	// Values kept for query parameters in both the request and the URL of a passthrough link:
+	// request (default), target or both
+	QueryPrecedence string
 }
 
 // addURLHandler returns an http.Handler that allows to add a key-url association
 // @Summary Add short url
 // @Description Adds a new key-url association
 // @Accept json
+// @Produce application/problem+json
 // @Param payload body addURLRequestPayload true "Key-url association to add"
+// @Param X-API-Key header string false "API key identifying the owner of the link"
 // @Success 200 "Key-url association added"
-// @Failure 400 "Payload cannot be decoded"
-// @Failure 422 "URL in the payload is malformed"
-// @Failure 409 "A key-url association already exists for the provided key"
-// @Failure 500 "The server has encountered an unknown error"
+// @Failure 400 {object} problemPayload "Payload cannot be decoded"
+// @Failure 401 {object} problemPayload "The API key is not valid"
+// @Failure 422 {object} problemPayload "Key or URL in the payload is malformed or not allowed, the URL is blocklisted or the activation window is empty"
+// @Failure 403 {object} problemPayload "The quota of the API key would be exceeded"
+// @Failure 409 {object} problemPayload "A key-url association already exists for the provided key"
+// @Failure 429 {object} problemPayload "Too many requests from the client, retry after the Retry-After header seconds"
+// @Failure 500 {object} problemPayload "The server has encountered an unknown error"
+// @Failure 503 {object} problemPayload "The storage did not respond in time"
 // @Router /api [put]
-func addURLHandler(s ShortURLProvider) http.HandlerFunc {
+func addURLHandler(s ShortURLProvider, c *config) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, span := startSpan(r, "addURLHandler")
+		defer span.End()
 		dec := json.NewDecoder(r.Body)
 		var payload addURLRequestPayload
 		if err := dec.Decode(&payload); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
+			writePayloadError(w, r, err)
+			return
+		}
+		owner, err := requestOwner(r, c)
+		if err != nil {
+			writeError(w, r, err)
 			return
 		}
 
-		u, err := url.Parse(payload.URL)
+		key, err := c.keyPolicy.ValidateKey(payload.Key)
 		if err != nil {
-			w.WriteHeader(http.StatusUnprocessableEntity)
+			writeError(w, r, err)
 			return
 		}
+		addLogFields(r, "key", key)
 
-		if err := s.AddURL(payload.Key, *u); errors.Is(err, storage.ErrKeyAlreadyExists) {
-			w.WriteHeader(http.StatusConflict)
-			// TODO: return descriptive payload
+		storageKey, err := payloadKey(c, payload.Domain, key)
+		if err != nil {
+			writeError(w, r, err)
 			return
-		} else if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		var tmpl string
+		rawURL := payload.URL
+		if payload.Template {
+			if rawURL, err = validateTemplate(payload.URL, payload.Passthrough); err != nil {
+				writeError(w, r, err)
+				return
+			}
+			tmpl = strings.TrimSpace(payload.URL)
+		}
+
+		campaign := payload.Campaign.campaign()
+		if err := validateCampaign(campaign, payload.Template); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		vs, err := validateVariants(c, payload.Variants, campaign, payload.Template)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if len(vs) > 0 {
+			if payload.URL != "" {
+				writeError(w, r, &validation.Error{Field: validation.URLField, Code: validation.CodeMalformed, Message: "split links take their url from the first variant"})
+				return
+			}
+			rawURL = vs[0].URL
+		}
+
+		u, err := c.urlPolicy.NormalizeURL(rawURL)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		applyCampaign(u, campaign)
+		if isSelfReference(c, u.Hostname()) {
+			writeError(w, r, &validation.Error{Field: validation.URLField, Code: validation.CodeSelfReference, Message: "url points to a short domain"})
+			return
+		}
+		rs, err := validateRules(c, payload.Rules, campaign, payload.Template)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		passwordHash, err := validatePassword(payload.Password)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		comingSoonURL, err := validateSchedule(c, payload.NotBefore, payload.NotAfter, payload.ComingSoonURL)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		precedence := storage.QueryPrecedence(payload.QueryPrecedence)
+		if !validQueryPrecedence(precedence) {
+			writeError(w, r, &validation.Error{Field: queryPrecedenceField, Code: validation.CodeMalformed, Message: "unknown query precedence " + payload.QueryPrecedence})
+			return
+		}
+
+		md := storage.Metadata{
+			CreatedAt:       time.Now().UTC(),
+			Title:           payload.Title,
+			Interstitial:    payload.Interstitial,
+			Owner:           owner,
+			Passthrough:     payload.Passthrough,
+			QueryPrecedence: precedence,
+			Template:        tmpl,
+			Campaign:        campaign,
+			Rules:           rs,
+			Variants:        vs,
+			Sticky:          payload.Sticky && len(vs) > 0,
+			PasswordHash:    passwordHash,
+			NotBefore:       payload.NotBefore.UTC(),
+			NotAfter:        payload.NotAfter.UTC(),
+			ComingSoonURL:   comingSoonURL,
+		}
+		if c.screener != nil {
+			res, field, err := screening.ScreenLink(r.Context(), c.screener, u, md)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			if res.Flag == storage.FlagDisabled {
+				writeError(w, r, &validation.Error{Field: field, Code: validation.CodeBlocked, Message: res.Reason})
+				return
+			}
+			md.Flag, md.FlagReason = res.Flag, res.Reason
+		}
+
+		size := quota.Size(storageKey, u, md)
+		if c.quotas != nil {
+			if err := c.quotas.Reserve(md.Owner, size); err != nil {
+				writeError(w, r, err)
+				return
+			}
+		}
+		if err := s.AddURL(r.Context(), storageKey, *u, md); err != nil {
+			if c.quotas != nil {
+				c.quotas.Release(md.Owner, size)
+			}
+			writeError(w, r, err)
 			return
 		}
+		if c.misses != nil {
+			host, _ := domains.SplitKey(storageKey)
+			c.misses.Forget(host, key)
+		}
+		addLogFields(r, "outcome", "created")
 	})
 }
 
 // deleteURLRequestPayload godoc
 type deleteURLRequestPayload struct {
-	Key string // Key for which the association should be deleted
+	Key    string // Key for which the association should be deleted
+	Domain string // Optional short domain of the key, the default domain if empty
 }
 
 // deleteURLByKeyHandler returns an http.Handler that allows to delete a key-url association
 // @Summary Delete short url
-// @Description Deletes a key-url association
+// @Description Deletes a key-url association, which is only allowed with the API key that added it, or without API key for links added anonymously
 // @Accept json
+// @Produce application/problem+json
 // @Param payload body deleteURLRequestPayload true "Key-url association to delete"
+// @Param X-API-Key header string false "API key owning the link"
 // @Success 200 "Key-url association deleted"
-// @Failure 400 "Payload cannot be decoded"
-// @Failure 404 "Key-url association not found for key"
-// @Failure 500 "The server has encountered an unknown error"
+// @Failure 400 {object} problemPayload "Payload cannot be decoded"
+// @Failure 401 {object} problemPayload "The API key is not valid"
+// @Failure 403 {object} problemPayload "The link is owned by another API key"
+// @Failure 404 {object} problemPayload "Key-url association not found for key"
+// @Failure 429 {object} problemPayload "Too many requests from the client, retry after the Retry-After header seconds"
+// @Failure 500 {object} problemPayload "The server has encountered an unknown error"
+// @Failure 503 {object} problemPayload "The storage did not respond in time"
 // @Router /api [delete]
-func deleteURLHandler(s ShortURLProvider) http.HandlerFunc {
+func deleteURLHandler(s ShortURLProvider, c *config) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, span := startSpan(r, "deleteURLHandler")
+		defer span.End()
 		dec := json.NewDecoder(r.Body)
 		var payload deleteURLRequestPayload
 		if err := dec.Decode(&payload); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
+			writePayloadError(w, r, err)
 			return
 		}
 
-		if err := s.DeleteURL(payload.Key); errors.Is(err, storage.ErrKeyNotFound) {
-			w.WriteHeader(http.StatusNotFound)
+		key, err := c.keyPolicy.ParseKey(payload.Key)
+		if err != nil {
+			writeError(w, r, storage.ErrKeyNotFound)
 			return
-		} else if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+		}
+		addLogFields(r, "key", key)
+		storageKey, err := payloadKey(c, payload.Domain, key)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		owner, err := requestOwner(r, c)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		md, err := s.Metadata(r.Context(), storageKey)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if md.Owner != owner {
+			writeError(w, r, errNotOwner)
+			return
+		}
+		if c.quotas != nil {
+			if err := deleteAndRelease(r.Context(), s, c.quotas, storageKey, md); err != nil {
+				writeError(w, r, err)
+				return
+			}
+		} else if err := s.DeleteURL(r.Context(), storageKey); err != nil {
+			writeError(w, r, err)
 			return
 		}
+		addLogFields(r, "outcome", "deleted")
 	})
 }
@@ -2,15 +2,20 @@ package routes
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 
+	"github.com/giannimassi/shorturl/pkg/screening"
 	"github.com/giannimassi/shorturl/pkg/storage"
+	"github.com/giannimassi/shorturl/pkg/validation"
+	"github.com/gin-gonic/gin"
 )
 
 const redirectTo = "https://example.com/"
@@ -19,6 +24,7 @@ const redirectTo = "https://example.com/"
 type mockProvider struct {
 	url  url.URL
 	hits int
+	md   storage.Metadata
 	err  error
 }
 
@@ -30,32 +36,54 @@ func newMockProvider(url string, hits int, err error) *mockProvider {
 	}
 }
 
-func (s *mockProvider) ShortURL(key string) (*url.URL, error) {
+func (s *mockProvider) ShortURL(ctx context.Context, key string) (*url.URL, error) {
 	if s.err != nil {
 		return nil, s.err
 	}
 	return &s.url, nil
 }
 
-func (s *mockProvider) AddURL(key string, u url.URL) error {
-	return s.err
+func (s *mockProvider) AddURL(ctx context.Context, key string, u url.URL, md storage.Metadata) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.url, s.md = u, md
+	return nil
 }
 
-func (s *mockProvider) DeleteURL(key string) error {
+func (s *mockProvider) DeleteURL(ctx context.Context, key string) error {
 	return s.err
 }
 
-func (s *mockProvider) ShortURLInfo(key string) (*url.URL, int, error) {
+func (s *mockProvider) ShortURLInfo(ctx context.Context, key string) (*url.URL, int, error) {
 	if s.err != nil {
 		return nil, 0, s.err
 	}
 	return &s.url, s.hits, nil
 }
 
+func (s *mockProvider) Metadata(ctx context.Context, key string) (storage.Metadata, error) {
+	return s.md, s.err
+}
+
+func (s *mockProvider) SetMetadata(ctx context.Context, key string, md storage.Metadata) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.md = md
+	return nil
+}
+
+func (s *mockProvider) Keys(ctx context.Context) ([]string, error) {
+	return nil, s.err
+}
+
 func Test_redirectHandler(t *testing.T) {
 	tests := []struct {
 		name               string
+		path               string
 		redirectURL        string
+		flag               storage.Flag
 		storageErr         error
 		expectedStatusCode int
 	}{
@@ -65,6 +93,34 @@ func Test_redirectHandler(t *testing.T) {
 
 			expectedStatusCode: 301,
 		},
+		{
+			name:        "ok/flagged",
+			redirectURL: "https://example.org/a",
+			flag:        storage.FlagWarn,
+
+			expectedStatusCode: 200,
+		},
+		{
+			name:        "ko/disabled",
+			redirectURL: "https://example.org/a",
+			flag:        storage.FlagDisabled,
+
+			expectedStatusCode: 403,
+		},
+		{
+			name:        "ko/nested-path",
+			path:        "/api/abcdef",
+			redirectURL: "https://example.org/a",
+
+			expectedStatusCode: 404,
+		},
+		{
+			name:        "ko/unicode-key",
+			path:        "/%C3%A8",
+			redirectURL: "https://example.org/a",
+
+			expectedStatusCode: 404,
+		},
 		{
 			name:       "ko/key-not-found",
 			storageErr: storage.ErrKeyNotFound,
@@ -72,6 +128,18 @@ func Test_redirectHandler(t *testing.T) {
 			expectedStatusCode: 404,
 		},
 
+		{
+			name:       "ko/storage-timeout",
+			storageErr: context.DeadlineExceeded,
+
+			expectedStatusCode: 503,
+		},
+		{
+			name:       "ko/client-gone",
+			storageErr: context.Canceled,
+
+			expectedStatusCode: 499,
+		},
 		{
 			name:       "ko/unexpected-error",
 			storageErr: errors.New("unexpected error"),
@@ -81,22 +149,35 @@ func Test_redirectHandler(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			req, err := http.NewRequest("GET", "https://shorturl.com/abcdef", nil)
+			path := "/abcdef"
+			if tt.path != "" {
+				path = tt.path
+			}
+			req, err := http.NewRequest("GET", "https://shorturl.com"+path, nil)
 			if err != nil {
 				t.Fatal(err)
 			}
 
 			w := httptest.NewRecorder()
 			provider := newMockProvider(tt.redirectURL, 0, tt.storageErr)
-			redirectHandler(provider).ServeHTTP(w, req)
+			provider.md.Flag = tt.flag
+			redirectHandler(provider, newConfig()).ServeHTTP(w, req)
 
 			if status := w.Code; status != tt.expectedStatusCode {
 				t.Fatalf("wrong status code: got %v want %v", status, tt.expectedStatusCode)
 			}
 
+			if tt.flag != storage.FlagNone {
+				body := w.Body.String()
+				if containsURL := strings.Contains(body, tt.redirectURL); containsURL != (tt.flag == storage.FlagWarn) {
+					t.Errorf("unexpected warning page body: %s", body)
+				}
+				return
+			}
+
 			// We don't check for error since we only want to test if the location header is set
 			// and we're not interested in testing the implementation of http.Response.
-			if location, _ := w.Result().Location(); tt.redirectURL != "" {
+			if location, _ := w.Result().Location(); tt.redirectURL != "" && tt.expectedStatusCode == 301 {
 				// check that location header is set correctly
 				if location.String() != tt.redirectURL {
 
@@ -126,6 +207,7 @@ func Test_infoHandler(t *testing.T) {
 		malformedPayload bool
 
 		expectedStatusCode int
+		expectedErrCode    string
 	}{
 		{
 			name:               "ok/a",
@@ -137,18 +219,21 @@ func Test_infoHandler(t *testing.T) {
 			malformedPayload: true,
 
 			expectedStatusCode: 400,
+			expectedErrCode:    codePayloadMalformed,
 		},
 		{
 			name:       "ko/key-not-found",
 			storageErr: storage.ErrKeyNotFound,
 
 			expectedStatusCode: 404,
+			expectedErrCode:    codeKeyNotFound,
 		},
 		{
 			name:       "ko/unexpected-errors",
 			storageErr: errors.New(""),
 
 			expectedStatusCode: 500,
+			expectedErrCode:    codeInternal,
 		},
 	}
 	for _, tt := range tests {
@@ -170,12 +255,13 @@ func Test_infoHandler(t *testing.T) {
 
 			w := httptest.NewRecorder()
 			provider := newMockProvider(tt.redirectURL, tt.hits, tt.storageErr)
-			infoHandler(provider).ServeHTTP(w, req)
+			infoHandler(provider, newConfig()).ServeHTTP(w, req)
 
 			if status := w.Code; status != tt.expectedStatusCode {
 				t.Fatalf("wrong status code: got %v want %v", status, tt.expectedStatusCode)
 			}
 			if tt.expectedStatusCode != 200 {
+				assertProblem(t, w, tt.expectedStatusCode, tt.expectedErrCode)
 				return
 			}
 
@@ -204,6 +290,7 @@ func Test_deleteURLHandler(t *testing.T) {
 		malformedPayload bool
 
 		expectedStatusCode int
+		expectedErrCode    string
 	}{
 		{
 			name:               "ok/a",
@@ -215,6 +302,7 @@ func Test_deleteURLHandler(t *testing.T) {
 			malformedPayload: true,
 
 			expectedStatusCode: 400,
+			expectedErrCode:    codePayloadMalformed,
 		},
 		{
 			name:       "ko/key-not -found",
@@ -222,6 +310,7 @@ func Test_deleteURLHandler(t *testing.T) {
 			storageErr: storage.ErrKeyNotFound,
 
 			expectedStatusCode: 404,
+			expectedErrCode:    codeKeyNotFound,
 		},
 	}
 	for _, tt := range tests {
@@ -243,11 +332,14 @@ func Test_deleteURLHandler(t *testing.T) {
 
 			w := httptest.NewRecorder()
 			provider := newMockProvider("", 0, tt.storageErr)
-			deleteURLHandler(provider).ServeHTTP(w, req)
+			deleteURLHandler(provider, newConfig()).ServeHTTP(w, req)
 
 			if status := w.Code; status != tt.expectedStatusCode {
 				t.Fatalf("wrong status code: got %v want %v", status, tt.expectedStatusCode)
 			}
+			if tt.expectedStatusCode != 200 {
+				assertProblem(t, w, tt.expectedStatusCode, tt.expectedErrCode)
+			}
 		})
 	}
 }
@@ -255,11 +347,16 @@ func Test_deleteURLHandler(t *testing.T) {
 func Test_addURL(t *testing.T) {
 	tests := []struct {
 		name             string
+		key              string
 		storageErr       error
 		malformedURL     bool
+		url              string
+		screenResult     screening.Result
 		malformedPayload bool
+		queryPrecedence  string
 
 		expectedStatusCode int
+		expectedErrCode    string
 	}{
 		{
 			name: "ok/a",
@@ -267,11 +364,97 @@ func Test_addURL(t *testing.T) {
 			expectedStatusCode: 200,
 		},
 
+		{
+			name: "ok/idn",
+			url:  "https://bücher.example/",
+
+			expectedStatusCode: 200,
+		},
+
 		{
 			name:         "ko/malformed-url",
 			malformedURL: true,
 
 			expectedStatusCode: 422,
+			expectedErrCode:    validation.CodeMalformed,
+		},
+
+		{
+			name: "ko/empty-url",
+			url:  " ",
+
+			expectedStatusCode: 422,
+			expectedErrCode:    validation.CodeEmpty,
+		},
+
+		{
+			name: "ko/relative-url",
+			url:  "/a/b",
+
+			expectedStatusCode: 422,
+			expectedErrCode:    validation.CodeNotAbsolute,
+		},
+
+		{
+			name: "ko/javascript-scheme",
+			url:  "javascript:alert(1)",
+
+			expectedStatusCode: 422,
+			expectedErrCode:    validation.CodeNotAbsolute,
+		},
+
+		{
+			name: "ko/file-scheme",
+			url:  "file://host/etc/passwd",
+
+			expectedStatusCode: 422,
+			expectedErrCode:    validation.CodeSchemeNotAllowed,
+		},
+
+		{
+			name:         "ok/screening-warn",
+			screenResult: screening.Result{Flag: storage.FlagWarn, Reason: "suspicious"},
+
+			expectedStatusCode: 200,
+		},
+
+		{
+			name:         "ko/screening-disabled",
+			screenResult: screening.Result{Flag: storage.FlagDisabled, Reason: "phishing"},
+
+			expectedStatusCode: 422,
+			expectedErrCode:    validation.CodeBlocked,
+		},
+
+		{
+			name: "ko/reserved-key",
+			key:  "API",
+
+			expectedStatusCode: 422,
+			expectedErrCode:    validation.CodeReserved,
+		},
+
+		{
+			name: "ko/key-with-slash",
+			key:  "swagger/index.html",
+
+			expectedStatusCode: 422,
+			expectedErrCode:    validation.CodeInvalidChars,
+		},
+
+		{
+			name:            "ok/passthrough",
+			queryPrecedence: string(storage.PrecedenceTarget),
+
+			expectedStatusCode: 200,
+		},
+
+		{
+			name:            "ko/unknown-query-precedence",
+			queryPrecedence: "random",
+
+			expectedStatusCode: 422,
+			expectedErrCode:    validation.CodeMalformed,
 		},
 
 		{
@@ -279,18 +462,21 @@ func Test_addURL(t *testing.T) {
 			malformedPayload: true,
 
 			expectedStatusCode: 400,
+			expectedErrCode:    codePayloadMalformed,
 		},
 		{
 			name:       "ko/key-already-exists",
 			storageErr: storage.ErrKeyAlreadyExists,
 
 			expectedStatusCode: 409,
+			expectedErrCode:    codeKeyAlreadyExists,
 		},
 		{
 			name:       "ko/unknown-err",
 			storageErr: errors.New(""),
 
 			expectedStatusCode: 500,
+			expectedErrCode:    codeInternal,
 		},
 	}
 	for _, tt := range tests {
@@ -298,10 +484,18 @@ func Test_addURL(t *testing.T) {
 			buf := bytes.Buffer{}
 			dec := json.NewEncoder(&buf)
 			url := "https://example.org"
+			if tt.url != "" {
+				url = tt.url
+			}
 			if tt.malformedURL {
 				url = string([]byte{0x7f})
 			}
-			if err := dec.Encode(&addURLRequestPayload{Key: "example", URL: url}); err != nil {
+			key := "example"
+			if tt.key != "" {
+				key = tt.key
+			}
+			payload := addURLRequestPayload{Key: key, URL: url, Passthrough: tt.queryPrecedence != "", QueryPrecedence: tt.queryPrecedence}
+			if err := dec.Encode(&payload); err != nil {
 				t.Fatal(err)
 			}
 
@@ -317,16 +511,48 @@ func Test_addURL(t *testing.T) {
 
 			w := httptest.NewRecorder()
 			provider := newMockProvider("", 0, tt.storageErr)
-			addURLHandler(provider).ServeHTTP(w, req)
+			c := newConfig()
+			c.keyPolicy.Reserved = reservedKeys(gin.RoutesInfo{{Path: "/api"}, {Path: "/swagger/*any"}})
+			c.screener = mockScreener(tt.screenResult)
+			addURLHandler(provider, c).ServeHTTP(w, req)
 
 			if status := w.Code; status != tt.expectedStatusCode {
 				t.Errorf("wrong status code: got %v want %v", status, tt.expectedStatusCode)
 			}
+			if provider.md.Flag != tt.screenResult.Flag && tt.expectedStatusCode == 200 {
+				t.Errorf("unexpected flag stored: got %v want %v", provider.md.Flag, tt.screenResult.Flag)
+			}
+			if tt.expectedStatusCode == 200 && (provider.md.Passthrough != payload.Passthrough || string(provider.md.QueryPrecedence) != tt.queryPrecedence) {
+				t.Errorf("unexpected passthrough settings stored: %+v", provider.md)
+			}
+			if tt.expectedStatusCode != 200 {
+				assertProblem(t, w, tt.expectedStatusCode, tt.expectedErrCode)
+			}
 		})
 	}
 
 }
 
+func assertProblem(t *testing.T, w *httptest.ResponseRecorder, expectedStatus int, expectedCode string) {
+	t.Helper()
+	if contentType := w.Header().Get("Content-Type"); contentType != problemContentType {
+		t.Errorf("unexpected content type: got %v want %v", contentType, problemContentType)
+	}
+	var payload problemPayload
+	if err := json.NewDecoder(w.Body).Decode(&payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Status != expectedStatus || payload.Code != expectedCode || payload.Title == "" {
+		t.Errorf("unexpected problem payload: got %+v want status %v and code %v", payload, expectedStatus, expectedCode)
+	}
+}
+
+func mockScreener(res screening.Result) screening.Screener {
+	return screening.ScreenerFunc(func(context.Context, *url.URL) (screening.Result, error) {
+		return res, nil
+	})
+}
+
 func mustMkURL(str string) url.URL {
 	u, err := url.Parse(str)
 	if err != nil {
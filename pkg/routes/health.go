@@ -0,0 +1,122 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/giannimassi/shorturl/pkg/storage"
+)
+
+// Health statuses reported by healthResponsePayload
+const (
+	healthOK           = "ok"
+	healthDegraded     = "degraded"
+	healthUnavailable  = "unavailable"
+	healthShuttingDown = "shutting_down"
+)
+
+// Default thresholds of the storage readiness check
+const (
+	defaultPingTimeout     = 2 * time.Second
+	defaultDegradedLatency = 500 * time.Millisecond
+)
+
+// healthState tracks whether the server is shutting down
+type healthState struct {
+	shuttingDown int32
+}
+
+func (h *healthState) setShuttingDown() {
+	atomic.StoreInt32(&h.shuttingDown, 1)
+}
+
+func (h *healthState) isShuttingDown() bool {
+	return atomic.LoadInt32(&h.shuttingDown) == 1
+}
+
+// healthCheckPayload godoc
+type healthCheckPayload struct {
+	Status  string  // Status of the check
+	Latency float64 // Time taken by the check, in seconds
+	Error   string  `json:",omitempty"` // Why the check failed, if it did
+}
+
+// healthResponsePayload godoc
+type healthResponsePayload struct {
+	Status string                        // Overall status
+	Checks map[string]healthCheckPayload `json:",omitempty"` // Status of each dependency
+}
+
+// livenessHandler implements a handler reporting that the process is alive and serving requests
+func livenessHandler() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, http.StatusOK, healthResponsePayload{Status: healthOK})
+	})
+}
+
+// readinessHandler implements a handler reporting whether the server can serve traffic.
+// The storage is pinged if it implements storage.Pinger: a slow ping reports a degraded but
+// ready server, a failed one a server that is not ready. The server is also not ready while
+// shutting down.
+func readinessHandler(s ShortURLProvider, c *config) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c.health.isShuttingDown() {
+			writeHealth(w, http.StatusServiceUnavailable, healthResponsePayload{Status: healthShuttingDown})
+			return
+		}
+
+		check := checkStorage(r.Context(), s, c.pingTimeout, c.degradedLatency)
+		status := http.StatusOK
+		if check.Status == healthUnavailable {
+			status = http.StatusServiceUnavailable
+		}
+		writeHealth(w, status, healthResponsePayload{
+			Status: check.Status,
+			Checks: map[string]healthCheckPayload{"storage": check},
+		})
+	})
+}
+
+// checkStorage pings s if it implements storage.Pinger, waiting at most timeout even if the
+// ping does not honor the context
+func checkStorage(ctx context.Context, s ShortURLProvider, timeout, degradedLatency time.Duration) healthCheckPayload {
+	pinger, ok := s.(storage.Pinger)
+	if !ok {
+		return healthCheckPayload{Status: healthOK}
+	}
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- pinger.Ping(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		return healthCheckPayload{Status: healthUnavailable, Latency: timeout.Seconds(), Error: "ping timed out"}
+	}
+
+	latency := time.Since(start)
+	check := healthCheckPayload{Status: healthOK, Latency: latency.Seconds()}
+	switch {
+	case err != nil:
+		check.Status, check.Error = healthUnavailable, err.Error()
+	case latency > degradedLatency:
+		check.Status = healthDegraded
+	}
+	return check
+}
+
+func writeHealth(w http.ResponseWriter, status int, payload healthResponsePayload) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(&payload)
+}
@@ -0,0 +1,107 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// pingerProvider is a mockProvider implementing storage.Pinger
+type pingerProvider struct {
+	*mockProvider
+	pingErr   error
+	pingDelay time.Duration
+}
+
+func (p *pingerProvider) Ping(ctx context.Context) error {
+	time.Sleep(p.pingDelay)
+	return p.pingErr
+}
+
+func Test_readinessHandler(t *testing.T) {
+	tests := []struct {
+		name         string
+		provider     ShortURLProvider
+		shuttingDown bool
+
+		expectedStatusCode int
+		expectedStatus     string
+	}{
+		{
+			name:     "ok/no-pinger",
+			provider: newMockProvider(redirectTo, 0, nil),
+
+			expectedStatusCode: 200,
+			expectedStatus:     healthOK,
+		},
+		{
+			name:     "ok/ping",
+			provider: &pingerProvider{mockProvider: newMockProvider(redirectTo, 0, nil)},
+
+			expectedStatusCode: 200,
+			expectedStatus:     healthOK,
+		},
+		{
+			name:     "ok/degraded",
+			provider: &pingerProvider{mockProvider: newMockProvider(redirectTo, 0, nil), pingDelay: 20 * time.Millisecond},
+
+			expectedStatusCode: 200,
+			expectedStatus:     healthDegraded,
+		},
+		{
+			name:     "ko/ping-failed",
+			provider: &pingerProvider{mockProvider: newMockProvider(redirectTo, 0, nil), pingErr: errors.New("connection refused")},
+
+			expectedStatusCode: 503,
+			expectedStatus:     healthUnavailable,
+		},
+		{
+			name:     "ko/ping-timeout",
+			provider: &pingerProvider{mockProvider: newMockProvider(redirectTo, 0, nil), pingDelay: 200 * time.Millisecond},
+
+			expectedStatusCode: 503,
+			expectedStatus:     healthUnavailable,
+		},
+		{
+			name:         "ko/shutting-down",
+			provider:     newMockProvider(redirectTo, 0, nil),
+			shuttingDown: true,
+
+			expectedStatusCode: 503,
+			expectedStatus:     healthShuttingDown,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newConfig(WithReadinessCheck(100*time.Millisecond, 10*time.Millisecond))
+			if tt.shuttingDown {
+				c.health.setShuttingDown()
+			}
+			w := httptest.NewRecorder()
+			readinessHandler(tt.provider, c).ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+
+			if w.Code != tt.expectedStatusCode {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tt.expectedStatusCode)
+			}
+			var payload healthResponsePayload
+			if err := json.NewDecoder(w.Body).Decode(&payload); err != nil {
+				t.Fatal(err)
+			}
+			if payload.Status != tt.expectedStatus {
+				t.Errorf("unexpected status: got %v want %v", payload.Status, tt.expectedStatus)
+			}
+		})
+	}
+}
+
+func Test_livenessHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	livenessHandler().ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("wrong status code: got %v want %v", w.Code, http.StatusOK)
+	}
+}
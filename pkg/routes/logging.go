@@ -0,0 +1,229 @@
+package routes
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/giannimassi/shorturl/pkg/logging"
+	"github.com/giannimassi/shorturl/pkg/storage"
+	"github.com/giannimassi/shorturl/pkg/tracing"
+	"github.com/gin-gonic/gin"
+)
+
+// requestIDHeader is the header carrying the request ID, honoured if set by the client or a proxy
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength is the maximum length of an incoming request ID
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// requestIDMiddleware assigns an ID to every request, reusing the incoming X-Request-ID if valid,
+// and returns it in the response headers
+func requestIDMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.GetHeader(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		ctx.Header(requestIDHeader, id)
+		ctx.Request = ctx.Request.WithContext(context.WithValue(ctx.Request.Context(), requestIDKey{}, id))
+		ctx.Next()
+	}
+}
+
+// requestID returns the ID assigned to the request by requestIDMiddleware
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if r < '!' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// requestLog collects the fields logged once a request has been served
+type requestLog struct {
+	m              sync.Mutex
+	fields         []interface{}
+	storageLatency time.Duration
+}
+
+type requestLogKey struct{}
+
+// addLogFields adds fields to the record logged once the request has been served
+func addLogFields(r *http.Request, kv ...interface{}) {
+	if l, ok := r.Context().Value(requestLogKey{}).(*requestLog); ok {
+		l.m.Lock()
+		defer l.m.Unlock()
+		l.fields = append(l.fields, kv...)
+	}
+}
+
+// outcome returns the value of the last outcome field, it must be called with l.m held
+func (l *requestLog) outcome() string {
+	var outcome string
+	for i := 0; i+1 < len(l.fields); i += 2 {
+		if l.fields[i] == "outcome" {
+			outcome, _ = l.fields[i+1].(string)
+		}
+	}
+	return outcome
+}
+
+// loggingMiddleware logs a record for every request once served. Records of followed redirects,
+// i.e. of requests with outcome "redirect", are sampled according to the configuration, while not
+// found keys, password prompts, scheduled links and every other outcome are always logged.
+func loggingMiddleware(c *config) gin.HandlerFunc {
+	logger, redirectLogger := c.logger, c.logger
+	if c.redirectLogSampling > 1 {
+		redirectLogger = c.logger.Sample(c.redirectLogSampling)
+	}
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		reqLog := &requestLog{}
+		l := logger.With(requestLogFields(ctx.Request)...)
+		rctx := context.WithValue(ctx.Request.Context(), requestLogKey{}, reqLog)
+		ctx.Request = ctx.Request.WithContext(logging.NewContext(rctx, l))
+		ctx.Next()
+
+		route := ctx.FullPath()
+		if route == "" {
+			route = redirectRoute
+		}
+		status := ctx.Writer.Status()
+		level := logging.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = logging.LevelError
+		}
+
+		reqLog.m.Lock()
+		defer reqLog.m.Unlock()
+		if route == redirectRoute && level < logging.LevelWarn && reqLog.outcome() == "redirect" {
+			l = redirectLogger.With(requestLogFields(ctx.Request)...)
+		}
+		kv := []interface{}{
+			"method", ctx.Request.Method,
+			"route", route,
+			"path", ctx.Request.URL.Path,
+			"status", status,
+			"latency_seconds", time.Since(start),
+			"client_ip", clientIP(ctx.Request, c),
+		}
+		if reqLog.storageLatency > 0 {
+			kv = append(kv, "storage_latency_seconds", reqLog.storageLatency)
+		}
+		l.Log(level, "request served", append(kv, reqLog.fields...)...)
+	}
+}
+
+// requestLogFields returns the fields identifying r in log records
+func requestLogFields(r *http.Request) []interface{} {
+	kv := []interface{}{"request_id", requestID(r.Context())}
+	if sc := tracing.SpanFromContext(r.Context()).SpanContext(); sc.IsValid() {
+		kv = append(kv, "trace_id", sc.TraceID.String())
+	}
+	return kv
+}
+
+// recoveryMiddleware logs panics raised while serving a request and responds with a 500
+func recoveryMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				logging.FromContext(ctx.Request.Context()).Error("panic while serving request",
+					"error", fmt.Sprint(rec), "stack", string(debug.Stack()))
+				ctx.AbortWithStatus(http.StatusInternalServerError)
+			}
+		}()
+		ctx.Next()
+	}
+}
+
+// timedProvider decorates a provider adding the time spent in storage to the log of the request
+// carrying the context of each operation
+type timedProvider struct {
+	storage.Forwarder
+	next ShortURLProvider
+}
+
+// withStorageTiming returns a provider recording the time spent in s in the request logs
+func withStorageTiming(s ShortURLProvider) ShortURLProvider {
+	p := &timedProvider{next: s}
+	p.Forwarder = storage.Forwarder{Next: s, Wrap: p.wrap}
+	return p
+}
+
+func observeStorage(ctx context.Context, start time.Time) {
+	l, ok := ctx.Value(requestLogKey{}).(*requestLog)
+	if !ok {
+		return
+	}
+	l.m.Lock()
+	defer l.m.Unlock()
+	l.storageLatency += time.Since(start)
+}
+
+func (p *timedProvider) ShortURL(ctx context.Context, key string) (*url.URL, error) {
+	defer observeStorage(ctx, time.Now())
+	return p.next.ShortURL(ctx, key)
+}
+
+func (p *timedProvider) AddURL(ctx context.Context, key string, u url.URL, md storage.Metadata) error {
+	defer observeStorage(ctx, time.Now())
+	return p.next.AddURL(ctx, key, u, md)
+}
+
+func (p *timedProvider) DeleteURL(ctx context.Context, key string) error {
+	defer observeStorage(ctx, time.Now())
+	return p.next.DeleteURL(ctx, key)
+}
+
+func (p *timedProvider) ShortURLInfo(ctx context.Context, key string) (*url.URL, int, error) {
+	defer observeStorage(ctx, time.Now())
+	return p.next.ShortURLInfo(ctx, key)
+}
+
+func (p *timedProvider) Metadata(ctx context.Context, key string) (storage.Metadata, error) {
+	defer observeStorage(ctx, time.Now())
+	return p.next.Metadata(ctx, key)
+}
+
+func (p *timedProvider) SetMetadata(ctx context.Context, key string, md storage.Metadata) error {
+	defer observeStorage(ctx, time.Now())
+	return p.next.SetMetadata(ctx, key, md)
+}
+
+func (p *timedProvider) Keys(ctx context.Context) ([]string, error) {
+	defer observeStorage(ctx, time.Now())
+	return p.next.Keys(ctx)
+}
+
+// wrap records the time spent in the optional operations forwarded by storage.Forwarder
+func (p *timedProvider) wrap(ctx context.Context, _, _ string, call func(ctx context.Context) error) error {
+	defer observeStorage(ctx, time.Now())
+	return call(ctx)
+}
@@ -0,0 +1,100 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/giannimassi/shorturl/pkg/logging"
+	"github.com/giannimassi/shorturl/pkg/storage"
+	"github.com/gin-gonic/gin"
+)
+
+func Test_loggingMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	buf := bytes.Buffer{}
+	c := newConfig(WithLogger(logging.New(&buf, logging.LevelInfo), 2))
+	r := newRouter(newMockProvider(redirectTo, 0, nil), c)
+
+	req := httptest.NewRequest("GET", "/abc", nil)
+	req.Header.Set(requestIDHeader, "incoming-id")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if id := w.Header().Get(requestIDHeader); id != "incoming-id" {
+		t.Errorf("incoming request id not honoured: got %q", id)
+	}
+
+	// sampled out
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/abc", nil))
+
+	req = httptest.NewRequest("GET", "/api", strings.NewReader(`{"Key":"a/b"}`))
+	req.Header.Set(requestIDHeader, "invalid id\n")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	generatedID := w.Header().Get(requestIDHeader)
+	if generatedID == "" || generatedID == "invalid id\n" {
+		t.Errorf("unexpected generated request id: %q", generatedID)
+	}
+
+	var recs []map[string]interface{}
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		rec := make(map[string]interface{})
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, rec)
+	}
+	if len(recs) != 2 {
+		t.Fatalf("unexpected number of records: got %d, want 2\n%s", len(recs), buf.String())
+	}
+
+	expected := []map[string]interface{}{
+		{"request_id": "incoming-id", "route": redirectRoute, "status": 301.0, "key": "abc", "outcome": "redirect"},
+		{"request_id": generatedID, "route": "/api", "status": 404.0, "outcome": codeKeyNotFound},
+	}
+	for i, fields := range expected {
+		for k, v := range fields {
+			if recs[i][k] != v {
+				t.Errorf("unexpected %s in record %d: got %v, want %v", k, i, recs[i][k], v)
+			}
+		}
+	}
+	if _, found := recs[0]["storage_latency_seconds"]; !found {
+		t.Errorf("storage latency missing from record: %v", recs[0])
+	}
+}
+
+func Test_loggingMiddleware_sampling(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	buf := bytes.Buffer{}
+	c := newConfig(WithLogger(logging.New(&buf, logging.LevelInfo), 4))
+	s := storage.NewMemoryStore()
+	if err := s.AddURL(context.Background(), "a", mustMkURL("https://example.org/a"), storage.Metadata{}); err != nil {
+		t.Fatal(err)
+	}
+	r := newRouter(s, c)
+
+	// only followed redirects are sampled, unknown keys are always logged
+	for i := 0; i < 4; i++ {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/a", nil))
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+	}
+
+	counts := make(map[float64]int)
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var rec struct{ Status float64 }
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatal(err)
+		}
+		counts[rec.Status]++
+	}
+	if counts[http.StatusMovedPermanently] != 1 || counts[http.StatusNotFound] != 4 {
+		t.Errorf("unexpected number of records by status: %v\n%s", counts, buf.String())
+	}
+}
@@ -0,0 +1,33 @@
+package routes
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/giannimassi/shorturl/pkg/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// redirectRoute is the route label used for requests served by redirectHandler
+const redirectRoute = "redirect"
+
+// metricsMiddleware returns a middleware counting requests and recording their latency
+// by route and status code
+func metricsMiddleware(reg *metrics.Registry) gin.HandlerFunc {
+	requests := reg.NewCounter("shorturl_http_requests_total",
+		"Number of HTTP requests served.", "route", "method", "status")
+	latency := reg.NewHistogram("shorturl_http_request_duration_seconds",
+		"Latency of HTTP requests.", metrics.DefBuckets, "route", "status")
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+
+		route := ctx.FullPath()
+		if route == "" {
+			route = redirectRoute
+		}
+		status := strconv.Itoa(ctx.Writer.Status())
+		requests.Inc(route, ctx.Request.Method, status)
+		latency.Observe(time.Since(start).Seconds(), route, status)
+	}
+}
@@ -0,0 +1,44 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/giannimassi/shorturl/pkg/logging"
+	"github.com/giannimassi/shorturl/pkg/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+func Test_metricsMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	reg := metrics.NewRegistry()
+	c := newConfig(WithMetrics(reg), WithLogger(logging.Discard(), 0))
+	r := newRouter(newMockProvider(redirectTo, 0, nil), c)
+
+	for _, path := range []string{"/a", "/b", "/a/b"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api", strings.NewReader("[]")))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("wrong status code: got %v want %v", w.Code, http.StatusOK)
+	}
+	for _, expected := range []string{
+		`shorturl_http_requests_total{route="redirect",method="GET",status="301"} 2`,
+		`shorturl_http_requests_total{route="redirect",method="GET",status="404"} 1`,
+		`shorturl_http_requests_total{route="/api",method="GET",status="400"} 1`,
+		`shorturl_http_request_duration_seconds_count{route="redirect",status="301"} 2`,
+	} {
+		if !strings.Contains(w.Body.String(), expected) {
+			t.Errorf("expected %q in metrics:\n%s", expected, w.Body.String())
+		}
+	}
+
+	if _, err := c.keyPolicy.ValidateKey("metrics"); err == nil {
+		t.Errorf("metrics should be a reserved key")
+	}
+}
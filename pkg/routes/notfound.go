@@ -0,0 +1,245 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/giannimassi/shorturl/pkg/domains"
+	"github.com/giannimassi/shorturl/pkg/notfound"
+	"github.com/giannimassi/shorturl/pkg/storage"
+)
+
+// maxSuggestions is the maximum number of similar keys suggested on the not found page
+const maxSuggestions = 5
+
+// maxSuggestionCandidates is the maximum number of similar keys whose links are checked for each
+// not found page, the closest first, until maxSuggestions of them can be suggested
+const maxSuggestionCandidates = 4 * maxSuggestions
+
+// keyIndexTTL is the time during which the keys used for suggestions are reused before being
+// listed again from the storage
+const keyIndexTTL = 30 * time.Second
+
+// missLogThreshold is the number of requests of a missing key after which it is logged, and
+// logged again each time the count grows tenfold
+const missLogThreshold = 10
+
+// defaultMissesLimit is the number of missed keys returned by the misses endpoint by default
+const defaultMissesLimit = 100
+
+// notFoundPage is shown for unknown keys on domains configured with domains.NotFoundPage
+var notFoundPage = template.Must(template.New("notfound").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>{{.Brand}}: link not found</title></head>
+<body>
+<h1>{{.Brand}}</h1>
+<p>{{if .Key}}The short link <strong>{{.Key}}</strong> does not exist.{{else}}This short link does not exist.{{end}}</p>
+{{if .Suggestions}}<p>Did you mean:</p>
+<ul>
+{{range .Suggestions}}<li><a href="/{{.}}">{{.}}</a></li>
+{{end}}</ul>
+{{end}}{{if .HomeURL}}<p><a href="{{.HomeURL}}">Go to {{.Brand}}</a></p>
+{{end}}</body>
+</html>
+`))
+
+type notFoundPageData struct {
+	Brand       string
+	Key         string
+	Suggestions []string
+	HomeURL     string
+}
+
+// writeNotFound responds to a request of key, which does not exist on d, according to the not
+// found mode of d. The key is empty if the request path is not a valid key.
+func writeNotFound(w http.ResponseWriter, r *http.Request, c *config, d domains.Domain, key string) {
+	outcome := "invalid_key"
+	if key != "" {
+		outcome = "not_found"
+		recordMiss(c, d, key)
+	}
+	switch d.OnNotFound() {
+	case domains.NotFoundRedirect:
+		addLogFields(r, "outcome", "fallback")
+		http.Redirect(w, r, d.FallbackURL, http.StatusFound)
+	case domains.NotFoundPage:
+		addLogFields(r, "outcome", outcome)
+		data := notFoundPageData{Brand: d.Brand, Key: key, HomeURL: d.FallbackURL}
+		if data.Brand == "" {
+			data.Brand = d.Host
+		}
+		if data.Brand == "" {
+			data.Brand = r.Host
+		}
+		if key != "" && c.keyIndex != nil {
+			data.Suggestions = c.keyIndex.suggest(r.Context(), d.Host, key, maxSuggestions)
+		}
+		renderPage(w, http.StatusNotFound, notFoundPage, data)
+	default:
+		addLogFields(r, "outcome", outcome)
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// recordMiss counts a request of a missing key, logging the keys missed most often
+func recordMiss(c *config, d domains.Domain, key string) {
+	if c.misses == nil {
+		return
+	}
+	n := c.misses.Record(d.Host, key)
+	for threshold := missLogThreshold; threshold <= n; threshold *= 10 {
+		if n == threshold {
+			c.logger.Info("frequently missed key", "domain", d.Host, "key", key, "misses", n)
+			return
+		}
+	}
+}
+
+// keyIndex caches the stored keys grouped by domain, so that suggestions do not list the whole
+// storage on every request, along with whether the links of the keys checked so far can be
+// suggested
+type keyIndex struct {
+	s   ShortURLProvider
+	now func() time.Time
+
+	m           sync.Mutex
+	byDomain    map[string][]string
+	suggestable map[string]bool // By storage key, reset when the keys are listed again
+	loaded      time.Time
+	loading     chan struct{} // Closed when the refresh in progress, if any, is done
+}
+
+func newKeyIndex(s ShortURLProvider) *keyIndex {
+	return &keyIndex{s: s, now: time.Now}
+}
+
+// keys returns the keys of host, listing them from the storage if the cached ones are older than
+// keyIndexTTL. A single refresh runs at a time, without holding the lock: the other callers get the
+// previously cached keys, or wait for the refresh if there are none. Failures are ignored, returning
+// the previously cached keys if any.
+func (i *keyIndex) keys(ctx context.Context, host string) []string {
+	i.m.Lock()
+	if i.byDomain != nil && i.now().Sub(i.loaded) <= keyIndexTTL {
+		defer i.m.Unlock()
+		return i.byDomain[host]
+	}
+	if loading := i.loading; loading != nil {
+		if i.byDomain != nil {
+			defer i.m.Unlock()
+			return i.byDomain[host]
+		}
+		i.m.Unlock()
+		select {
+		case <-loading:
+		case <-ctx.Done():
+		}
+		i.m.Lock()
+		defer i.m.Unlock()
+		return i.byDomain[host]
+	}
+	loading := make(chan struct{})
+	i.loading = loading
+	i.m.Unlock()
+
+	byDomain, err := i.load(ctx)
+
+	i.m.Lock()
+	defer i.m.Unlock()
+	if err == nil {
+		i.byDomain, i.suggestable, i.loaded = byDomain, make(map[string]bool), i.now()
+	}
+	i.loading = nil
+	close(loading)
+	return i.byDomain[host]
+}
+
+// load lists the stored keys grouped by domain
+func (i *keyIndex) load(ctx context.Context) (map[string][]string, error) {
+	stored, err := i.s.Keys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byDomain := make(map[string][]string)
+	for _, sk := range stored {
+		h, k := domains.SplitKey(sk)
+		byDomain[h] = append(byDomain[h], k)
+	}
+	return byDomain, nil
+}
+
+// suggest returns up to n keys of host similar to key, the closest first. Only the metadata of the
+// closest maxSuggestionCandidates keys is read, so that a page does not read every stored link.
+func (i *keyIndex) suggest(ctx context.Context, host, key string, n int) []string {
+	var suggestions []string
+	for _, candidate := range notfound.Suggest(key, i.keys(ctx, host), maxSuggestionCandidates) {
+		if len(suggestions) == n {
+			break
+		}
+		if i.isSuggestable(ctx, domains.ScopedKey(host, candidate)) {
+			suggestions = append(suggestions, candidate)
+		}
+	}
+	return suggestions
+}
+
+// isSuggestable returns true if the link of the storage key sk would redirect the visitor: it is
+// not password protected, it is within its activation window and it is not flagged by screening.
+// The result is cached until the keys are listed again, failures are not.
+func (i *keyIndex) isSuggestable(ctx context.Context, sk string) bool {
+	i.m.Lock()
+	ok, found := i.suggestable[sk]
+	i.m.Unlock()
+	if found {
+		return ok
+	}
+	md, err := i.s.Metadata(ctx, sk)
+	if err != nil && !errors.Is(err, storage.ErrKeyNotFound) {
+		return false
+	}
+	ok = err == nil && md.PasswordHash == "" && md.State(i.now()) == storage.StateActive && md.Flag == storage.FlagNone
+	i.m.Lock()
+	defer i.m.Unlock()
+	if i.suggestable != nil {
+		i.suggestable[sk] = ok
+	}
+	return ok
+}
+
+// missPayload godoc
+type missPayload struct {
+	Domain   string    `json:"Domain,omitempty"` // Short domain of the key, omitted for the default domain
+	Key      string    `json:"Key"`              // Missed key
+	Count    int       `json:"Count"`            // Number of requests of the key
+	LastSeen time.Time `json:"LastSeen"`         // Time of the last request of the key
+}
+
+// missesHandler returns an http.Handler listing the keys missed most often
+// @Summary List missed keys
+// @Description Returns the keys requested most often without existing, the most missed first
+// @Produce json
+// @Produce application/problem+json
+// @Param limit query int false "Maximum number of keys to return, 100 by default"
+// @Success 200 {array} missPayload
+// @Failure 429 {object} problemPayload "Too many requests from the client, retry after the Retry-After header seconds"
+// @Router /api/misses [get]
+func missesHandler(c *config) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := defaultMissesLimit
+		if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+			limit = l
+		}
+		top := c.misses.Top(limit)
+		payload := make([]missPayload, len(top))
+		for i, m := range top {
+			payload[i] = missPayload{Domain: m.Host, Key: m.Key, Count: m.Count, LastSeen: m.LastSeen}
+		}
+		w.Header().Add("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(payload)
+	})
+}
@@ -0,0 +1,221 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/giannimassi/shorturl/pkg/domains"
+	"github.com/giannimassi/shorturl/pkg/logging"
+	"github.com/giannimassi/shorturl/pkg/notfound"
+	"github.com/giannimassi/shorturl/pkg/storage"
+	"github.com/gin-gonic/gin"
+)
+
+func Test_notFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logs := bytes.Buffer{}
+	reg := domains.NewRegistry()
+	if _, err := reg.Register(domains.Domain{Host: "links.brand", NotFound: domains.NotFoundPage, Brand: "Brand Links", FallbackURL: "https://brand.example"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reg.Register(domains.Domain{Host: "go.company", FallbackURL: "https://intranet.company"}); err != nil {
+		t.Fatal(err)
+	}
+	store := storage.NewMemoryStore()
+	u, _ := url.Parse("https://example.org")
+	for _, key := range []string{"roadmap", domains.ScopedKey("links.brand", "summer-sale"), domains.ScopedKey("links.brand", "summer-sales")} {
+		if err := store.AddURL(context.Background(), key, *u, storage.Metadata{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// links that would not redirect are never suggested
+	hidden := map[string]storage.Metadata{
+		"summer-salt":   {PasswordHash: "hash"},
+		"summer-soon":   {NotBefore: time.Now().Add(time.Hour)},
+		"summer-ended":  {NotAfter: time.Now().Add(-time.Hour)},
+		"summer-sailor": {Flag: storage.FlagDisabled},
+	}
+	for key, md := range hidden {
+		if err := store.AddURL(context.Background(), domains.ScopedKey("links.brand", key), *u, md); err != nil {
+			t.Fatal(err)
+		}
+	}
+	misses := notfound.NewTracker(0)
+	c := newConfig(
+		WithLogger(logging.New(&logs, logging.LevelInfo), 0),
+		WithDomains(reg),
+		WithMissedKeys(misses),
+		WithNotFound(domains.Domain{NotFound: domains.NotFoundPlain}),
+	)
+	r := newRouter(store, c)
+
+	serve := func(method, host, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, "http://"+host+path, strings.NewReader(body)))
+		return w
+	}
+
+	// plain 404 on the default domain
+	if w := serve("GET", "short.example", "/roadmp", ""); w.Code != http.StatusNotFound || strings.Contains(w.Body.String(), "roadmap") {
+		t.Errorf("unexpected response: %v %q", w.Code, w.Body)
+	}
+
+	// branded page with suggestions from the keyspace of the domain only
+	w := serve("GET", "links.brand", "/summer-sal", "")
+	body := w.Body.String()
+	if w.Code != http.StatusNotFound || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("unexpected response: %v %v", w.Code, w.Header())
+	}
+	for _, expected := range []string{"Brand Links", `href="/summer-sale"`, `href="/summer-sales"`, `href="https://brand.example"`} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("not found page should contain %q: %s", expected, body)
+		}
+	}
+	for key := range hidden {
+		if strings.Contains(body, `href="/`+key+`"`) {
+			t.Errorf("%s should not be suggested: %s", key, body)
+		}
+	}
+	if w := serve("GET", "links.brand", "/roadmp", ""); strings.Contains(w.Body.String(), "roadmap") {
+		t.Errorf("keys of other domains should not be suggested: %s", w.Body)
+	}
+	if w := serve("GET", "links.brand", "/summer-sal+", ""); w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "Did you mean") {
+		t.Errorf("preview of unknown key should render the not found page: %v %s", w.Code, w.Body)
+	}
+
+	// redirect to the fallback url
+	if w := serve("GET", "go.company", "/wiki", ""); w.Code != http.StatusFound || w.Header().Get("Location") != "https://intranet.company" {
+		t.Errorf("unexpected response: %v %v", w.Code, w.Header())
+	}
+
+	for i := 0; i < missLogThreshold-1; i++ {
+		serve("GET", "go.company", "/wiki", "")
+	}
+	if !strings.Contains(logs.String(), `"msg":"frequently missed key"`) {
+		t.Errorf("frequently missed key should be logged: %s", logs.String())
+	}
+
+	var top []missPayload
+	if err := json.NewDecoder(serve("GET", "short.example", "/api/misses?limit=1", "").Body).Decode(&top); err != nil {
+		t.Fatal(err)
+	}
+	if len(top) != 1 || top[0].Domain != "go.company" || top[0].Key != "wiki" || top[0].Count != missLogThreshold {
+		t.Errorf("unexpected misses: %+v", top)
+	}
+
+	// creating the key stops tracking it
+	if w := serve("PUT", "short.example", "/api", fmt.Sprintf(`{"Key":"wiki","Domain":"go.company","URL":%q}`, u)); w.Code != http.StatusOK {
+		t.Fatalf("wrong status code adding key: %v %s", w.Code, w.Body)
+	}
+	for _, m := range misses.Top(0) {
+		if m.Key == "wiki" {
+			t.Errorf("created key should not be tracked anymore: %+v", m)
+		}
+	}
+}
+
+// blockingStore blocks the listings of keys until release is closed
+type blockingStore struct {
+	*storage.MemoryStore
+	release chan struct{}
+	started chan struct{}
+	calls   int32
+}
+
+func (s *blockingStore) Keys(ctx context.Context) ([]string, error) {
+	if atomic.AddInt32(&s.calls, 1) > 1 {
+		s.started <- struct{}{}
+		<-s.release
+	}
+	return s.MemoryStore.Keys(ctx)
+}
+
+func Test_keyIndex_refresh(t *testing.T) {
+	ctx := context.Background()
+	store := &blockingStore{MemoryStore: storage.NewMemoryStore(), release: make(chan struct{}), started: make(chan struct{})}
+	u, _ := url.Parse("https://example.org")
+	if err := store.AddURL(ctx, "a", *u, storage.Metadata{}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	var m sync.Mutex
+	i := newKeyIndex(store)
+	i.now = func() time.Time {
+		m.Lock()
+		defer m.Unlock()
+		return now
+	}
+	if keys := i.keys(ctx, ""); len(keys) != 1 {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+
+	if err := store.AddURL(ctx, "b", *u, storage.Metadata{}); err != nil {
+		t.Fatal(err)
+	}
+	m.Lock()
+	now = now.Add(2 * keyIndexTTL)
+	m.Unlock()
+	refreshed := make(chan []string)
+	go func() { refreshed <- i.keys(ctx, "") }()
+	<-store.started
+
+	// the lock is not held while the keys are listed, other callers get the cached keys
+	if keys := i.keys(ctx, ""); len(keys) != 1 {
+		t.Errorf("expected the cached keys during the refresh, got %v", keys)
+	}
+	close(store.release)
+	if keys := <-refreshed; len(keys) != 2 {
+		t.Errorf("unexpected refreshed keys: %v", keys)
+	}
+	if calls := atomic.LoadInt32(&store.calls); calls != 2 {
+		t.Errorf("expected a single refresh, got %d listings", calls)
+	}
+}
+
+// metadataStore counts the reads of metadata
+type metadataStore struct {
+	*storage.MemoryStore
+	reads int32
+}
+
+func (s *metadataStore) Metadata(ctx context.Context, key string) (storage.Metadata, error) {
+	atomic.AddInt32(&s.reads, 1)
+	return s.MemoryStore.Metadata(ctx, key)
+}
+
+func Test_keyIndex_suggest(t *testing.T) {
+	ctx := context.Background()
+	store := &metadataStore{MemoryStore: storage.NewMemoryStore()}
+	u, _ := url.Parse("https://example.org")
+	for i := 0; i < 100; i++ {
+		if err := store.AddURL(ctx, fmt.Sprintf("unrelated-%d", i), *u, storage.Metadata{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for key, md := range map[string]storage.Metadata{"report": {}, "reports": {}, "repord": {PasswordHash: "hash"}} {
+		if err := store.AddURL(ctx, key, *u, md); err != nil {
+			t.Fatal(err)
+		}
+	}
+	i := newKeyIndex(store)
+
+	// only the links of similar keys are read, once until the keys are listed again
+	for n := 0; n < 2; n++ {
+		if got := i.suggest(ctx, "", "reportz", maxSuggestions); len(got) != 2 || got[0] != "report" || got[1] != "reports" {
+			t.Errorf("unexpected suggestions: %v", got)
+		}
+	}
+	if reads := atomic.LoadInt32(&store.reads); reads != 3 {
+		t.Errorf("expected the metadata of the 3 similar keys to be read once, got %d reads", reads)
+	}
+}
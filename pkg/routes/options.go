@@ -0,0 +1,273 @@
+package routes
+
+import (
+	"crypto/rand"
+	"net"
+	"os"
+	"time"
+
+	"github.com/giannimassi/shorturl/pkg/domains"
+	"github.com/giannimassi/shorturl/pkg/geo"
+	"github.com/giannimassi/shorturl/pkg/logging"
+	"github.com/giannimassi/shorturl/pkg/metrics"
+	"github.com/giannimassi/shorturl/pkg/notfound"
+	"github.com/giannimassi/shorturl/pkg/quota"
+	"github.com/giannimassi/shorturl/pkg/ratelimit"
+	"github.com/giannimassi/shorturl/pkg/screening"
+	"github.com/giannimassi/shorturl/pkg/tracing"
+	"github.com/giannimassi/shorturl/pkg/validation"
+)
+
+// Option allows to customize the behaviour of the server started with Start
+type Option func(*config)
+
+// config holds the settings shared by the handlers
+type config struct {
+	urlPolicy validation.URLPolicy
+	keyPolicy validation.KeyPolicy
+
+	screener        screening.Screener
+	recheckInterval time.Duration
+
+	metrics *metrics.Registry
+
+	logger              *logging.Logger
+	redirectLogSampling int
+
+	tracer *tracing.Tracer
+
+	health          *healthState
+	pingTimeout     time.Duration
+	degradedLatency time.Duration
+	shutdownDelay   time.Duration
+
+	apiKeys         map[string]struct{}
+	apiLimit        ratelimit.Limit
+	redirectLimit   ratelimit.Limit
+	trustedProxies  []*net.IPNet
+	clientIPHeaders []string
+
+	quotas      *quota.Tracker
+	quotaReload time.Duration
+
+	storageTimeout time.Duration
+
+	domains       *domains.Registry
+	defaultDomain domains.Domain
+	misses        *notfound.Tracker
+	keyIndex      *keyIndex
+
+	geo geo.Resolver
+
+	accessSecret         []byte
+	accessTTL            time.Duration
+	passwordLimit        ratelimit.Limit
+	passwordLinkLimit    ratelimit.Limit
+	passwordAttempts     *ratelimit.Limiter // Keyed by client IP and link
+	passwordLinkAttempts *ratelimit.Limiter // Keyed by link
+}
+
+// defaultStorageTimeout is the maximum duration of each storage operation performed while serving a request
+const defaultStorageTimeout = 2 * time.Second
+
+// shutdownTimeout is the maximum time given to in-flight requests to complete on shutdown
+const shutdownTimeout = 15 * time.Second
+
+func newConfig(opts ...Option) *config {
+	c := &config{
+		urlPolicy: validation.DefaultURLPolicy(),
+		keyPolicy: validation.DefaultKeyPolicy(),
+		logger:    logging.New(os.Stderr, logging.LevelInfo),
+
+		health:          &healthState{},
+		pingTimeout:     defaultPingTimeout,
+		degradedLatency: defaultDegradedLatency,
+		storageTimeout:  defaultStorageTimeout,
+
+		accessSecret:      randomSecret(),
+		accessTTL:         defaultAccessTTL,
+		passwordLimit:     defaultPasswordAttempts,
+		passwordLinkLimit: defaultPasswordLinkAttempts,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithURLPolicy sets the policy used to validate and normalize destination urls
+func WithURLPolicy(p validation.URLPolicy) Option {
+	return func(c *config) {
+		c.urlPolicy = p
+	}
+}
+
+// WithKeyPolicy sets the policy used to validate and normalize keys.
+// The first segment of every route registered by Start is always added to the reserved keys.
+func WithKeyPolicy(p validation.KeyPolicy) Option {
+	return func(c *config) {
+		c.keyPolicy = p
+	}
+}
+
+// WithScreener sets the screener used to check destination urls when links are added.
+// If recheckInterval is positive, all stored links are also screened again periodically.
+func WithScreener(s screening.Screener, recheckInterval time.Duration) Option {
+	return func(c *config) {
+		c.screener = s
+		c.recheckInterval = recheckInterval
+	}
+}
+
+// WithMetrics enables the collection of request metrics in reg, which is served on /metrics
+func WithMetrics(reg *metrics.Registry) Option {
+	return func(c *config) {
+		c.metrics = reg
+	}
+}
+
+// WithLogger sets the logger used to log served requests. Records of followed redirects are
+// sampled, logging only one out of every redirectSampling, if redirectSampling is greater than 1.
+func WithLogger(l *logging.Logger, redirectSampling int) Option {
+	return func(c *config) {
+		c.logger = l
+		c.redirectLogSampling = redirectSampling
+	}
+}
+
+// WithTracer enables tracing of requests and storage operations with t
+func WithTracer(t *tracing.Tracer) Option {
+	return func(c *config) {
+		c.tracer = t
+	}
+}
+
+// WithReadinessCheck sets the maximum time to wait for the storage to answer a ping, and the ping
+// latency above which the server is reported as degraded
+func WithReadinessCheck(pingTimeout, degradedLatency time.Duration) Option {
+	return func(c *config) {
+		c.pingTimeout = pingTimeout
+		c.degradedLatency = degradedLatency
+	}
+}
+
+// WithShutdownDelay sets the time during which the server reports not to be ready before shutting
+// down, allowing load balancers to stop sending traffic to it
+func WithShutdownDelay(d time.Duration) Option {
+	return func(c *config) {
+		c.shutdownDelay = d
+	}
+}
+
+// WithRateLimits sets the rate limits applied to each client on management requests and on redirects
+func WithRateLimits(api, redirect ratelimit.Limit) Option {
+	return func(c *config) {
+		c.apiLimit = api
+		c.redirectLimit = redirect
+	}
+}
+
+// WithTrustedProxies sets the proxies whose headers are trusted to carry the client IP address,
+// and the headers to look at in order, e.g. X-Forwarded-For or X-Real-IP
+func WithTrustedProxies(proxies []*net.IPNet, headers ...string) Option {
+	return func(c *config) {
+		c.trustedProxies = proxies
+		c.clientIPHeaders = headers
+	}
+}
+
+// WithAPIKeys sets the API keys accepted in the X-API-Key header of management requests.
+// Requests are only identified by their API key if it is one of keys.
+func WithAPIKeys(keys ...string) Option {
+	return func(c *config) {
+		c.apiKeys = make(map[string]struct{}, len(keys))
+		for _, key := range keys {
+			if key != "" {
+				c.apiKeys[key] = struct{}{}
+			}
+		}
+	}
+}
+
+// WithQuotas enforces the quotas of t on the links added by each API key. The usage is loaded
+// from the store when the server starts and, if reloadInterval is positive, reloaded periodically
+// to release the quota of the links removed by the store, e.g. when they expire.
+func WithQuotas(t *quota.Tracker, reloadInterval time.Duration) Option {
+	return func(c *config) {
+		c.quotas = t
+		c.quotaReload = reloadInterval
+	}
+}
+
+// WithStorageTimeout sets the maximum duration of each storage operation performed while serving a
+// request, in addition to the cancellation of the request itself. Zero disables the timeout.
+func WithStorageTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.storageTimeout = d
+	}
+}
+
+// WithDomains serves the short domains registered in reg, each with its own keyspace, in addition
+// to the default one. Domains can be managed through the /api/domains endpoints.
+func WithDomains(reg *domains.Registry) Option {
+	return func(c *config) {
+		c.domains = reg
+	}
+}
+
+// WithNotFound sets the response to unknown keys on the default domain, whose host is ignored.
+// Registered domains have their own settings.
+func WithNotFound(d domains.Domain) Option {
+	return func(c *config) {
+		d.Host = ""
+		c.defaultDomain = d
+	}
+}
+
+// WithMissedKeys counts the requests of missing keys in t, logging the keys missed most often and
+// listing them on /api/misses
+func WithMissedKeys(t *notfound.Tracker) Option {
+	return func(c *config) {
+		c.misses = t
+	}
+}
+
+// WithGeoResolver sets the resolver of the country of client addresses, needed by the routing
+// rules of links with country conditions. Without it those conditions never match.
+func WithGeoResolver(r geo.Resolver) Option {
+	return func(c *config) {
+		c.geo = r
+	}
+}
+
+// WithAccessCookies sets the secret signing the cookies that grant access to password protected
+// links, and how long they are valid. Replicas serving the same links must share the secret; if
+// it is empty a random one is used, invalidating the cookies when the server restarts.
+func WithAccessCookies(secret []byte, ttl time.Duration) Option {
+	return func(c *config) {
+		if len(secret) > 0 {
+			c.accessSecret = secret
+		}
+		c.accessTTL = ttl
+	}
+}
+
+// WithPasswordAttempts limits the wrong passwords submitted for each protected link by each client
+// IP, and by all clients together with perLink, which should be looser so that a client guessing
+// cannot lock the others out for long. By default each client is allowed 5 attempts, then one per
+// minute, and all clients 50, then ten per minute.
+func WithPasswordAttempts(perClient, perLink ratelimit.Limit) Option {
+	return func(c *config) {
+		c.passwordLimit = perClient
+		c.passwordLinkLimit = perLink
+	}
+}
+
+// randomSecret returns 32 random bytes
+func randomSecret() []byte {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic("routes: generating secret: " + err.Error())
+	}
+	return b
+}
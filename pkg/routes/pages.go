@@ -0,0 +1,34 @@
+package routes
+
+import (
+	"html/template"
+	"net/http"
+)
+
+// warningPage is shown instead of redirecting when a link has been flagged as unsafe
+var warningPage = template.Must(template.New("warning").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>Warning: unsafe link</title></head>
+<body>
+<h1>This link may be unsafe</h1>
+<p>The short link <strong>{{.Key}}</strong> points to a destination that has been flagged: {{.Reason}}.</p>
+{{if .Disabled}}<p>The link has been disabled.</p>
+{{else}}<p>Destination: <code>{{.URL}}</code></p>
+<p><a href="{{.URL}}" rel="noopener noreferrer nofollow">Continue at your own risk</a></p>
+{{end}}</body>
+</html>
+`))
+
+type warningPageData struct {
+	Key      string
+	URL      string
+	Reason   string
+	Disabled bool
+}
+
+// renderPage executes t with data, writing the result with the provided status code
+func renderPage(w http.ResponseWriter, status int, t *template.Template, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_ = t.Execute(w, data)
+}
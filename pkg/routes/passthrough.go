@@ -0,0 +1,76 @@
+package routes
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/giannimassi/shorturl/pkg/storage"
+)
+
+// queryPrecedenceField is the name of the payload field selecting the query precedence
+const queryPrecedenceField = "QueryPrecedence"
+
+// splitRequestPath splits the escaped path of a redirect request into the key, its first segment,
+// and the rest of the path including its leading slash, empty if the path is the key alone
+func splitRequestPath(path string) (key, rest string) {
+	path = strings.TrimPrefix(path, "/")
+	if i := strings.Index(path, "/"); i >= 0 {
+		return path[:i], path[i:]
+	}
+	return path, ""
+}
+
+// validPassthroughPath returns false if the escaped path contains dot segments, which would escape
+// the path of the url they are appended to
+func validPassthroughPath(rest string) bool {
+	for _, segment := range strings.Split(rest, "/") {
+		if unescaped, err := url.PathUnescape(segment); err != nil || unescaped == "." || unescaped == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// passthroughURL returns a copy of u with the escaped path rest appended to its path and query
+// merged into its query according to p
+func passthroughURL(u *url.URL, rest string, query url.Values, p storage.QueryPrecedence) *url.URL {
+	target := *u
+	if rest != "" {
+		escaped := strings.TrimSuffix(u.EscapedPath(), "/") + rest
+		if path, err := url.PathUnescape(escaped); err == nil {
+			target.Path, target.RawPath = path, escaped
+		}
+	}
+	if len(query) > 0 {
+		target.RawQuery = mergeQuery(u.Query(), query, p).Encode()
+	}
+	return &target
+}
+
+// mergeQuery merges the query of a request into the one of the url of a link. Parameters appearing
+// in both keep the values selected by p.
+func mergeQuery(target, request url.Values, p storage.QueryPrecedence) url.Values {
+	merged := make(url.Values, len(target)+len(request))
+	for k, vs := range target {
+		merged[k] = append([]string(nil), vs...)
+	}
+	for k, vs := range request {
+		_, conflict := merged[k]
+		switch {
+		case !conflict, p == storage.PrecedenceRequest, p == "":
+			merged[k] = append([]string(nil), vs...)
+		case p == storage.PrecedenceBoth:
+			merged[k] = append(merged[k], vs...)
+		}
+	}
+	return merged
+}
+
+// validQueryPrecedence returns true if p is a known query precedence or empty
+func validQueryPrecedence(p storage.QueryPrecedence) bool {
+	switch p {
+	case "", storage.PrecedenceRequest, storage.PrecedenceTarget, storage.PrecedenceBoth:
+		return true
+	}
+	return false
+}
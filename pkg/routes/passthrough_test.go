@@ -0,0 +1,128 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/giannimassi/shorturl/pkg/logging"
+	"github.com/giannimassi/shorturl/pkg/storage"
+	"github.com/gin-gonic/gin"
+)
+
+func Test_passthroughURL(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		path       string
+		precedence storage.QueryPrecedence
+		expected   string
+	}{
+		{
+			name:     "key-only",
+			target:   "https://docs.example/manual/",
+			path:     "/docs",
+			expected: "https://docs.example/manual/",
+		},
+		{
+			name:     "path",
+			target:   "https://docs.example/manual/",
+			path:     "/docs/getting-started",
+			expected: "https://docs.example/manual/getting-started",
+		},
+		{
+			name:     "path-without-trailing-slash",
+			target:   "https://docs.example/manual",
+			path:     "/docs/a/b%2Fc",
+			expected: "https://docs.example/manual/a/b%2Fc",
+		},
+		{
+			name:     "query",
+			target:   "https://docs.example/manual?lang=en&v=2",
+			path:     "/docs/getting-started?lang=it",
+			expected: "https://docs.example/manual/getting-started?lang=it&v=2",
+		},
+		{
+			name:       "query/target-precedence",
+			target:     "https://docs.example/manual?lang=en",
+			path:       "/docs?lang=it&q=x",
+			precedence: storage.PrecedenceTarget,
+			expected:   "https://docs.example/manual?lang=en&q=x",
+		},
+		{
+			name:       "query/both",
+			target:     "https://docs.example/manual?tag=a",
+			path:       "/docs?tag=b",
+			precedence: storage.PrecedenceBoth,
+			expected:   "https://docs.example/manual?tag=a&tag=b",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, _ := url.Parse(tt.target)
+			req := httptest.NewRequest("GET", tt.path, nil)
+			_, rest := splitRequestPath(req.URL.EscapedPath())
+			if got := passthroughURL(target, rest, req.URL.Query(), tt.precedence).String(); got != tt.expected {
+				t.Errorf("got %v want %v", got, tt.expected)
+			}
+			if target.String() != tt.target {
+				t.Errorf("target url should not be modified: %v", target)
+			}
+		})
+	}
+}
+
+func Test_validPassthroughPath(t *testing.T) {
+	for path, expected := range map[string]bool{
+		"/a/b":       true,
+		"/":          true,
+		"/../admin":  false,
+		"/a/%2e%2e/": false,
+		"/./a":       false,
+	} {
+		if valid := validPassthroughPath(path); valid != expected {
+			t.Errorf("%q: got %v want %v", path, valid, expected)
+		}
+	}
+}
+
+func Test_redirectPassthrough(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := storage.NewMemoryStore()
+	u, _ := url.Parse("https://docs.example/manual/")
+	ctx := context.Background()
+	if err := store.AddURL(ctx, "docs", *u, storage.Metadata{Passthrough: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddURL(ctx, "plain", *u, storage.Metadata{}); err != nil {
+		t.Fatal(err)
+	}
+	r := newRouter(store, newConfig(WithLogger(logging.Discard(), 0)))
+
+	tests := []struct {
+		path     string
+		status   int
+		location string
+	}{
+		{path: "/docs/getting-started?lang=it", status: http.StatusMovedPermanently, location: "https://docs.example/manual/getting-started?lang=it"},
+		{path: "/docs/../admin", status: http.StatusNotFound},
+		{path: "/docs/c++", status: http.StatusMovedPermanently, location: "https://docs.example/manual/c++"},
+		{path: "/docs/c++?preview=1", status: http.StatusOK},
+		{path: "/plain?lang=it", status: http.StatusMovedPermanently, location: "https://docs.example/manual/"},
+		{path: "/plain/getting-started", status: http.StatusNotFound},
+		{path: "/missing/getting-started", status: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.status || w.Header().Get("Location") != tt.location {
+			t.Errorf("%s: got %v %q want %v %q", tt.path, w.Code, w.Header().Get("Location"), tt.status, tt.location)
+		}
+	}
+
+	if _, hits, _ := store.ShortURLInfo(ctx, "plain"); hits != 1 {
+		t.Errorf("requests not valid for the link should not count hits, got %d", hits)
+	}
+}
@@ -0,0 +1,162 @@
+package routes
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"html/template"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/giannimassi/shorturl/pkg/password"
+	"github.com/giannimassi/shorturl/pkg/ratelimit"
+	"github.com/giannimassi/shorturl/pkg/storage"
+	"github.com/giannimassi/shorturl/pkg/validation"
+)
+
+// passwordField is the name of the payload field holding the password of a link
+const passwordField = "Password"
+
+// maxPasswordLength is the maximum length in bytes of the password of a link
+const maxPasswordLength = 256
+
+// maxPasswordFormSize is the maximum size of the body of password form submissions
+const maxPasswordFormSize = 4 << 10
+
+// accessCookiePrefix is the prefix of the names of the cookies granting access to protected links,
+// followed by a digest of the key so that each link has its own cookie
+const accessCookiePrefix = "shorturl_access_"
+
+// defaultAccessTTL is how long a client can follow a protected link after entering its password
+const defaultAccessTTL = 15 * time.Minute
+
+// Default limits of failed attempts: each client can submit 5 wrong passwords for a link, then one
+// per minute, and all clients together 50, then ten per minute
+var (
+	defaultPasswordAttempts     = ratelimit.Limit{Rate: 1.0 / 60, Burst: 5}
+	defaultPasswordLinkAttempts = ratelimit.Limit{Rate: 10.0 / 60, Burst: 50}
+)
+
+// passwordPage asks for the password of a protected link
+var passwordPage = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>Protected link: {{.Key}}</title></head>
+<body>
+<h1>{{if .Title}}{{.Title}}{{else}}{{.Key}}{{end}}</h1>
+<p>The short link <strong>{{.Key}}</strong> is protected by a password.</p>
+{{if .Error}}<p><strong>{{.Error}}</strong></p>
+{{end}}<form method="post">
+<label>Password <input type="password" name="password" autofocus required></label>
+<button type="submit">Continue</button>
+</form>
+</body>
+</html>
+`))
+
+type passwordPageData struct {
+	Key   string
+	Title string
+	Error string
+}
+
+// validatePassword checks the password of a new link, returning its hash to be stored or an empty
+// string if the link is not protected. Failures are reported as *validation.Error.
+func validatePassword(p string) (string, error) {
+	switch {
+	case p == "":
+		return "", nil
+	case len(p) > maxPasswordLength:
+		return "", &validation.Error{Field: passwordField, Code: validation.CodeTooLong, Message: "password is longer than " + strconv.Itoa(maxPasswordLength) + " bytes"}
+	}
+	return password.Hash(p)
+}
+
+// checkAccess returns true if the client of r can follow the link for storageKey, because it is not
+// protected or the client has entered its password recently. Otherwise it serves the password form,
+// or checks the submitted password, redirecting back to the requested url with an access cookie if
+// it is correct, and returns false. Failed attempts are limited per client and link, and per link.
+func checkAccess(w http.ResponseWriter, r *http.Request, c *config, storageKey, key string, md storage.Metadata) bool {
+	if md.PasswordHash == "" || hasAccess(r, c, storageKey, md) {
+		return true
+	}
+	data := passwordPageData{Key: key, Title: md.Title}
+	if r.Method != http.MethodPost {
+		addLogFields(r, "outcome", "password_required")
+		renderPage(w, http.StatusUnauthorized, passwordPage, data)
+		return false
+	}
+
+	// the attempt is charged before the slow verification, so that concurrent guesses cannot exceed
+	// the limits, and refunded if the password is correct
+	clientKey := clientIP(r, c) + "|" + storageKey
+	ok, wait := c.passwordAttempts.Allow(clientKey)
+	if ok {
+		if ok, wait = c.passwordLinkAttempts.Allow(storageKey); !ok {
+			c.passwordAttempts.Refund(clientKey)
+		}
+	}
+	if !ok {
+		addLogFields(r, "outcome", "password_rate_limited")
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		data.Error = "Too many wrong passwords, retry in " + wait.Round(time.Second).String()
+		renderPage(w, http.StatusTooManyRequests, passwordPage, data)
+		return false
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxPasswordFormSize)
+	if err := password.Verify(md.PasswordHash, r.PostFormValue("password")); err != nil {
+		addLogFields(r, "outcome", "password_rejected")
+		data.Error = "Wrong password"
+		renderPage(w, http.StatusUnauthorized, passwordPage, data)
+		return false
+	}
+
+	c.passwordAttempts.Refund(clientKey)
+	c.passwordLinkAttempts.Refund(storageKey)
+	expires := time.Now().Add(c.accessTTL)
+	http.SetCookie(w, &http.Cookie{
+		Name:     accessCookieName(storageKey),
+		Value:    strconv.FormatInt(expires.Unix(), 10) + "." + accessSignature(c, storageKey, md, expires.Unix()),
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	addLogFields(r, "outcome", "password_accepted")
+	http.Redirect(w, r, r.URL.RequestURI(), http.StatusSeeOther)
+	return false
+}
+
+// hasAccess returns true if r carries an unexpired access cookie for the link
+func hasAccess(r *http.Request, c *config, storageKey string, md storage.Metadata) bool {
+	cookie, err := r.Cookie(accessCookieName(storageKey))
+	if err != nil {
+		return false
+	}
+	parts := strings.SplitN(cookie.Value, ".", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	expires, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || time.Now().Unix() >= expires {
+		return false
+	}
+	return hmac.Equal([]byte(parts[1]), []byte(accessSignature(c, storageKey, md, expires)))
+}
+
+// accessSignature signs the access to the link until expires. The password hash is part of the
+// signed data, so that cookies are invalidated when the link is recreated with another password.
+func accessSignature(c *config, storageKey string, md storage.Metadata, expires int64) string {
+	mac := hmac.New(sha256.New, c.accessSecret)
+	mac.Write([]byte(storageKey + "\n" + strconv.FormatInt(expires, 10) + "\n" + md.PasswordHash))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func accessCookieName(storageKey string) string {
+	digest := sha256.Sum256([]byte(storageKey))
+	return accessCookiePrefix + hex.EncodeToString(digest[:8])
+}
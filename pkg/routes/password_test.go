@@ -0,0 +1,157 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/giannimassi/shorturl/pkg/logging"
+	"github.com/giannimassi/shorturl/pkg/ratelimit"
+	"github.com/giannimassi/shorturl/pkg/storage"
+	"github.com/giannimassi/shorturl/pkg/validation"
+	"github.com/gin-gonic/gin"
+)
+
+func Test_passwordProtection(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := storage.NewMemoryStore()
+	attempts, linkAttempts := ratelimit.Limit{Rate: 0.001, Burst: 2}, ratelimit.Limit{Rate: 0.001, Burst: 4}
+	r := newRouter(store, newConfig(WithLogger(logging.Discard(), 0), WithPasswordAttempts(attempts, linkAttempts)))
+
+	remoteAddr := "192.0.2.1:1234"
+	serve := func(method, path, body string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.RemoteAddr = remoteAddr
+		if method == "POST" {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+	submit := func(key, password string) *httptest.ResponseRecorder {
+		return serve("POST", "/"+key, url.Values{"password": {password}}.Encode())
+	}
+
+	for _, key := range []string{"wiki", "hr"} {
+		w := serve("PUT", "/api", `{"Key":"`+key+`","URL":"https://intranet.example/`+key+`","Password":"s3cret"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("wrong status code: %v %s", w.Code, w.Body)
+		}
+	}
+	assertProblem(t, serve("PUT", "/api", `{"Key":"long","URL":"https://intranet.example/","Password":"`+strings.Repeat("a", maxPasswordLength+1)+`"}`),
+		http.StatusUnprocessableEntity, validation.CodeTooLong)
+	if md, _ := store.Metadata(context.Background(), "wiki"); !strings.HasPrefix(md.PasswordHash, "pbkdf2-sha256$") {
+		t.Errorf("password should be stored hashed, got %q", md.PasswordHash)
+	}
+
+	for _, path := range []string{"/wiki", "/wiki+", "/wiki?preview=1"} {
+		w := serve("GET", path, "")
+		if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), `type="password"`) || w.Header().Get("Location") != "" {
+			t.Errorf("%s: expected the password form, got %v %q", path, w.Code, w.Header().Get("Location"))
+		}
+	}
+	if w := submit("wiki", "wrong"); w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "Wrong password") {
+		t.Errorf("expected the password to be rejected, got %v", w.Code)
+	}
+
+	w := submit("wiki", "s3cret")
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/wiki" {
+		t.Fatalf("expected a redirect to the link, got %v %q", w.Code, w.Header().Get("Location"))
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].HttpOnly {
+		t.Fatalf("expected an access cookie, got %v", cookies)
+	}
+	if w := serve("GET", "/wiki", "", cookies[0]); w.Code != http.StatusFound || w.Header().Get("Location") != "https://intranet.example/wiki" {
+		t.Errorf("cookie should grant access, got %v %q", w.Code, w.Header().Get("Location"))
+	} else if cc := w.Header().Get("Cache-Control"); cc != "no-store, private" {
+		t.Errorf("redirects of protected links should not be cached, got %q", cc)
+	}
+	if w := serve("GET", "/hr", "", &http.Cookie{Name: accessCookieName("hr"), Value: cookies[0].Value}); w.Code != http.StatusUnauthorized {
+		t.Errorf("cookie should only grant access to its link, got %v", w.Code)
+	}
+	forged := *cookies[0]
+	forged.Value = "9999999999" + forged.Value[strings.Index(forged.Value, "."):]
+	if w := serve("GET", "/wiki", "", &forged); w.Code != http.StatusUnauthorized {
+		t.Errorf("forged cookie should not grant access, got %v", w.Code)
+	}
+	if _, hits, _ := store.ShortURLInfo(context.Background(), "wiki"); hits != 1 {
+		t.Errorf("only followed redirects should count hits, got %d", hits)
+	}
+
+	submit("wiki", "wrong")
+	w = submit("wiki", "s3cret")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("expected failed attempts to be limited, got %v", w.Code)
+	}
+	if w := submit("hr", "s3cret"); w.Code != http.StatusSeeOther {
+		t.Errorf("attempts should be limited per link, got %v", w.Code)
+	}
+
+	// other clients are not locked out by a client guessing, up to the ceiling of the link
+	remoteAddr = "192.0.2.2:1234"
+	if w := submit("wiki", "wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("attempts should be limited per client, got %v", w.Code)
+	}
+	remoteAddr = "192.0.2.3:1234"
+	if w := submit("wiki", "wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("attempts should be limited per client, got %v", w.Code)
+	}
+	remoteAddr = "192.0.2.4:1234"
+	if w := submit("wiki", "s3cret"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected the attempts of all clients to be limited per link, got %v", w.Code)
+	}
+
+	var info infoResponsePayload
+	if err := json.NewDecoder(serve("GET", "/api", `{"Key":"wiki"}`).Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	if !info.Protected {
+		t.Errorf("unexpected info: %+v", info)
+	}
+}
+
+func Test_passwordProtection_concurrentGuesses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limit := ratelimit.Limit{Rate: 0.001, Burst: 3}
+	r := newRouter(storage.NewMemoryStore(), newConfig(WithLogger(logging.Discard(), 0), WithPasswordAttempts(limit, ratelimit.Limit{})))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("PUT", "/api", strings.NewReader(`{"Key":"wiki","URL":"https://intranet.example/","Password":"s3cret"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("wrong status code: %v %s", w.Code, w.Body)
+	}
+
+	const guesses = 4 * 3
+	codes := make(chan int, guesses)
+	var wg sync.WaitGroup
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/wiki", strings.NewReader(url.Values{"password": {"guess" + strconv.Itoa(i)}}.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.ServeHTTP(w, req)
+			codes <- w.Code
+		}(i)
+	}
+	wg.Wait()
+	close(codes)
+	counts := map[int]int{}
+	for code := range codes {
+		counts[code]++
+	}
+	if counts[http.StatusUnauthorized] != limit.Burst || counts[http.StatusTooManyRequests] != guesses-limit.Burst {
+		t.Errorf("expected %d guesses to be verified and the others limited, got %v", limit.Burst, counts)
+	}
+}
@@ -0,0 +1,120 @@
+package routes
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/giannimassi/shorturl/pkg/domains"
+	"github.com/giannimassi/shorturl/pkg/storage"
+)
+
+// previewSuffix can be appended to a key to request its preview page instead of being redirected
+const previewSuffix = "+"
+
+// previewPage shows where a link goes before following it
+var previewPage = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>Preview: {{.Key}}</title></head>
+<body>
+<h1>{{if .Title}}{{.Title}}{{else}}{{.Key}}{{end}}</h1>
+<p>The short link <strong>{{.Key}}</strong> points to:</p>
+<p><code>{{.URL}}</code></p>
+<ul>
+{{if not .CreatedAt.IsZero}}<li>Created: {{.CreatedAt.Format "2006-01-02 15:04 MST"}}</li>
+{{end}}<li>Visits: {{.Hits}}</li>
+</ul>
+{{if .Reason}}<p><strong>Warning:</strong> the destination has been flagged: {{.Reason}}.</p>
+{{end}}<p><a href="{{.URL}}" rel="noopener noreferrer nofollow">Continue to the destination</a></p>
+</body>
+</html>
+`))
+
+type previewPageData struct {
+	Key       string
+	Title     string
+	URL       string
+	CreatedAt time.Time
+	Hits      int
+	Reason    string
+}
+
+// isPreviewRequest returns true if the request asks for the preview page of a link,
+// either with the preview query parameter or by appending previewSuffix to the key
+func isPreviewRequest(r *http.Request) bool {
+	return r.URL.Query().Get("preview") == "1" || hasPreviewSuffix(r.URL.EscapedPath())
+}
+
+// hasPreviewSuffix returns true if the escaped path is a key followed by previewSuffix. Paths
+// forwarded to passthrough and template links may end with previewSuffix too, e.g. /docs/c++.
+func hasPreviewSuffix(path string) bool {
+	_, rest := splitRequestPath(path)
+	return rest == "" && strings.HasSuffix(path, previewSuffix)
+}
+
+// previewHandler implements a handler that renders the preview page of the link for the requested key.
+// Showing the preview does not count as a hit.
+func previewHandler(s ShortURLProvider, c *config) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, span := startSpan(r, "previewHandler")
+		defer span.End()
+		d := requestDomain(r, c)
+		path := r.URL.EscapedPath()
+		if hasPreviewSuffix(path) {
+			path = strings.TrimSuffix(path, previewSuffix)
+		}
+		rawKey, rest := splitRequestPath(path)
+		key, err := c.keyPolicy.ParseKey(rawKey)
+		if err != nil {
+			writeNotFound(w, r, c, d, "")
+			return
+		}
+		addLogFields(r, "key", key)
+		storageKey := domains.ScopedKey(d.Host, key)
+		shortURL, hits, err := s.ShortURLInfo(r.Context(), storageKey)
+		if err != nil {
+			writeRedirectError(w, r, c, d, key, err)
+			return
+		}
+		md, err := s.Metadata(r.Context(), storageKey)
+		if err != nil {
+			writeRedirectError(w, r, c, d, key, err)
+			return
+		}
+		if rest != "" && !acceptsPath(md, rest) {
+			writeNotFound(w, r, c, d, "")
+			return
+		}
+		if md.Flag == storage.FlagDisabled {
+			addLogFields(r, "outcome", "disabled")
+			renderPage(w, http.StatusForbidden, warningPage, warningPageData{Key: key, Reason: md.FlagReason, Disabled: true})
+			return
+		}
+		if !checkSchedule(w, r, key, md) {
+			return
+		}
+		if !checkAccess(w, r, c, storageKey, key, md) {
+			return
+		}
+		query := r.URL.Query()
+		query.Del("preview")
+		if shortURL, err = linkTarget(shortURL, rest, query, md); err != nil {
+			writeRedirectError(w, r, c, d, key, err)
+			return
+		}
+		addLogFields(r, "outcome", "preview")
+		renderPage(w, http.StatusOK, previewPage, newPreviewPageData(key, shortURL.String(), hits, md))
+	})
+}
+
+func newPreviewPageData(key, u string, hits int, md storage.Metadata) previewPageData {
+	return previewPageData{
+		Key:       key,
+		Title:     md.Title,
+		URL:       u,
+		CreatedAt: md.CreatedAt,
+		Hits:      hits,
+		Reason:    md.FlagReason,
+	}
+}
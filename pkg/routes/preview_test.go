@@ -0,0 +1,105 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/giannimassi/shorturl/pkg/storage"
+)
+
+func Test_redirectHandler_preview(t *testing.T) {
+	createdAt := time.Date(2020, 7, 30, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		path string
+		md   storage.Metadata
+		err  error
+
+		expectedStatusCode int
+		expectedBody       []string
+	}{
+		{
+			name: "ok/suffix",
+			path: "/abcdef+",
+			md:   storage.Metadata{Title: "Example <page>", CreatedAt: createdAt},
+
+			expectedStatusCode: 200,
+			expectedBody:       []string{redirectTo, "Example &lt;page&gt;", "2020-07-30 10:00 UTC", "Visits: 3"},
+		},
+		{
+			name: "ok/query",
+			path: "/abcdef?preview=1",
+
+			expectedStatusCode: 200,
+			expectedBody:       []string{redirectTo, "<h1>abcdef</h1>"},
+		},
+		{
+			name: "ok/interstitial",
+			path: "/abcdef",
+			md:   storage.Metadata{Interstitial: true},
+
+			expectedStatusCode: 200,
+			expectedBody:       []string{redirectTo, "Continue to the destination"},
+		},
+		{
+			name: "ok/not-interstitial",
+			path: "/abcdef",
+
+			expectedStatusCode: 301,
+		},
+		{
+			name: "ok/flagged",
+			path: "/abcdef+",
+			md:   storage.Metadata{Flag: storage.FlagWarn, FlagReason: "reported"},
+
+			expectedStatusCode: 200,
+			expectedBody:       []string{redirectTo, "reported"},
+		},
+		{
+			name: "ko/disabled",
+			path: "/abcdef+",
+			md:   storage.Metadata{Flag: storage.FlagDisabled, FlagReason: "phishing"},
+
+			expectedStatusCode: 403,
+			expectedBody:       []string{"phishing"},
+		},
+		{
+			name: "ko/key-not-found",
+			path: "/abcdef+",
+			err:  storage.ErrKeyNotFound,
+
+			expectedStatusCode: 404,
+		},
+		{
+			name: "ko/invalid-key",
+			path: "/abc/def+",
+
+			expectedStatusCode: 404,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "https://shorturl.com"+tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w := httptest.NewRecorder()
+			provider := newMockProvider(redirectTo, 3, tt.err)
+			provider.md = tt.md
+			redirectHandler(provider, newConfig()).ServeHTTP(w, req)
+
+			if status := w.Code; status != tt.expectedStatusCode {
+				t.Fatalf("wrong status code: got %v want %v", status, tt.expectedStatusCode)
+			}
+			for _, expected := range tt.expectedBody {
+				if !strings.Contains(w.Body.String(), expected) {
+					t.Errorf("expected %q in body: %s", expected, w.Body.String())
+				}
+			}
+		})
+	}
+}
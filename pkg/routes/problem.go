@@ -0,0 +1,100 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/giannimassi/shorturl/pkg/domains"
+	"github.com/giannimassi/shorturl/pkg/quota"
+	"github.com/giannimassi/shorturl/pkg/storage"
+	"github.com/giannimassi/shorturl/pkg/validation"
+)
+
+// problemContentType is the media type of error responses
+// Reference: https://tools.ietf.org/html/rfc7807
+const problemContentType = "application/problem+json"
+
+// Stable error codes returned in problemPayload.Code, in addition to the validation error codes
+const (
+	codePayloadMalformed = "payload_malformed"
+	codeKeyNotFound      = "key_not_found"
+	codeKeyAlreadyExists = "key_already_exists"
+	codeDomainNotFound   = "domain_not_found"
+	codeQuotaExceeded    = "quota_exceeded"
+	codeUnknownAPIKey    = "unknown_api_key"
+	codeNotOwner         = "not_owner"
+	codeStorageTimeout   = "storage_timeout"
+	codeInternal         = "internal_error"
+)
+
+// statusClientClosedRequest is the non-standard status logged when the client goes away before
+// the response is ready, as popularized by nginx
+const statusClientClosedRequest = 499
+
+// outcomeCanceled is the logged outcome of requests canceled by the client
+const outcomeCanceled = "canceled"
+
+// problemPayload godoc
+type problemPayload struct {
+	Type   string `json:"type"`            // URI identifying the problem type, always about:blank
+	Title  string `json:"title"`           // Short summary of the problem type
+	Status int    `json:"status"`          // HTTP status code
+	Detail string `json:"detail"`          // Human-readable explanation of this occurrence of the problem
+	Code   string `json:"code"`            // Stable machine-readable error code
+	Field  string `json:"field,omitempty"` // Name of the offending field in the request payload, if any
+}
+
+// writeProblem writes an RFC 7807 error response
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, code, field, detail string) {
+	addLogFields(r, "outcome", code)
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(&problemPayload{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+		Field:  field,
+	})
+}
+
+// writeError maps err to a problem response. Storage and validation errors are reported with
+// their own status and code, any other error as an internal error.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var vErr *validation.Error
+	switch {
+	case errors.As(err, &vErr):
+		writeProblem(w, r, http.StatusUnprocessableEntity, vErr.Code, vErr.Field, vErr.Message)
+	case errors.Is(err, storage.ErrKeyNotFound):
+		writeProblem(w, r, http.StatusNotFound, codeKeyNotFound, validation.KeyField, "no url is associated with the provided key")
+	case errors.Is(err, storage.ErrKeyAlreadyExists):
+		writeProblem(w, r, http.StatusConflict, codeKeyAlreadyExists, validation.KeyField, "an url is already associated with the provided key")
+	case errors.Is(err, domains.ErrNotFound):
+		writeProblem(w, r, http.StatusNotFound, codeDomainNotFound, domains.HostField, "the domain is not registered")
+	case errors.Is(err, errUnknownAPIKey):
+		writeProblem(w, r, http.StatusUnauthorized, codeUnknownAPIKey, "", "the API key is not valid")
+	case errors.Is(err, errNotOwner):
+		writeProblem(w, r, http.StatusForbidden, codeNotOwner, "", "the link is owned by another API key")
+	case errors.Is(err, domains.ErrNotOwner):
+		writeProblem(w, r, http.StatusForbidden, codeNotOwner, domains.HostField, "the domain is owned by another API key or configured at startup")
+	case errors.Is(err, quota.ErrExceeded):
+		writeProblem(w, r, http.StatusForbidden, codeQuotaExceeded, "", err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		addLogFields(r, "error", err)
+		writeProblem(w, r, http.StatusServiceUnavailable, codeStorageTimeout, "", "the storage did not respond in time")
+	case errors.Is(err, context.Canceled):
+		addLogFields(r, "outcome", outcomeCanceled)
+		w.WriteHeader(statusClientClosedRequest)
+	default:
+		addLogFields(r, "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, codeInternal, "", "the server has encountered an unknown error")
+	}
+}
+
+// writePayloadError reports a request payload that cannot be decoded
+func writePayloadError(w http.ResponseWriter, r *http.Request, err error) {
+	writeProblem(w, r, http.StatusBadRequest, codePayloadMalformed, "", "payload cannot be decoded: "+err.Error())
+}
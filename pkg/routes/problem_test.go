@@ -0,0 +1,71 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/giannimassi/shorturl/pkg/storage"
+	"github.com/giannimassi/shorturl/pkg/validation"
+)
+
+func Test_writeError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+
+		expectedStatus int
+		expectedCode   string
+		expectedField  string
+	}{
+		{
+			name:           "validation",
+			err:            fmt.Errorf("wrapped: %w", &validation.Error{Field: validation.URLField, Code: validation.CodeTooLong, Message: "too long"}),
+			expectedStatus: 422,
+			expectedCode:   validation.CodeTooLong,
+			expectedField:  validation.URLField,
+		},
+		{
+			name:           "not-found",
+			err:            fmt.Errorf("wrapped: %w", storage.ErrKeyNotFound),
+			expectedStatus: 404,
+			expectedCode:   codeKeyNotFound,
+			expectedField:  validation.KeyField,
+		},
+		{
+			name:           "already-exists",
+			err:            storage.ErrKeyAlreadyExists,
+			expectedStatus: 409,
+			expectedCode:   codeKeyAlreadyExists,
+			expectedField:  validation.KeyField,
+		},
+		{
+			name:           "unknown",
+			err:            errors.New("connection refused"),
+			expectedStatus: 500,
+			expectedCode:   codeInternal,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			writeError(w, httptest.NewRequest("PUT", "/api", nil), tt.err)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tt.expectedStatus)
+			}
+			var payload problemPayload
+			if err := json.NewDecoder(w.Body).Decode(&payload); err != nil {
+				t.Fatal(err)
+			}
+			if payload.Code != tt.expectedCode || payload.Field != tt.expectedField || payload.Type != "about:blank" {
+				t.Errorf("unexpected payload: %+v", payload)
+			}
+			if tt.expectedStatus == 500 && payload.Detail == tt.err.Error() {
+				t.Errorf("internal error details should not be exposed")
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/giannimassi/shorturl/pkg/quota"
+	"github.com/giannimassi/shorturl/pkg/storage"
+)
+
+// usageResponsePayload godoc
+type usageResponsePayload struct {
+	Links    int   // Number of active links
+	MaxLinks int   // Maximum number of active links, 0 if unlimited
+	Bytes    int64 // Storage used by the links
+	MaxBytes int64 // Maximum storage used by the links, 0 if unlimited
+}
+
+// usageHandler returns an http.Handler reporting the usage and quota of the API key of the request
+// @Summary Return quota usage
+// @Description Returns the number of links and the storage used by the API key, along with its quota
+// @Produce json
+// @Produce application/problem+json
+// @Param X-API-Key header string false "API key for which usage is requested, anonymous usage if empty"
+// @Success 200 {object} usageResponsePayload
+// @Failure 401 {object} problemPayload "The API key is not valid"
+// @Failure 429 {object} problemPayload "Too many requests from the client, retry after the Retry-After header seconds"
+// @Router /api/usage [get]
+func usageHandler(c *config) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		owner, err := requestOwner(r, c)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		usage, q := c.quotas.Usage(owner)
+		w.Header().Add("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(&usageResponsePayload{
+			Links:    usage.Links,
+			MaxLinks: q.MaxLinks,
+			Bytes:    usage.Bytes,
+			MaxBytes: q.MaxBytes,
+		})
+	})
+}
+
+// deleteAndRelease deletes the link for key with metadata md, releasing its share of the quota of
+// its owner
+func deleteAndRelease(ctx context.Context, s ShortURLProvider, t *quota.Tracker, key string, md storage.Metadata) error {
+	u, _, err := s.ShortURLInfo(ctx, key)
+	if err != nil {
+		return err
+	}
+	if err := s.DeleteURL(ctx, key); err != nil {
+		return err
+	}
+	t.Release(md.Owner, quota.Size(key, u, md))
+	return nil
+}
@@ -0,0 +1,70 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/giannimassi/shorturl/pkg/logging"
+	"github.com/giannimassi/shorturl/pkg/quota"
+	"github.com/giannimassi/shorturl/pkg/storage"
+	"github.com/gin-gonic/gin"
+)
+
+func Test_quotas(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c := newConfig(WithLogger(logging.Discard(), 0), WithQuotas(quota.NewTracker(quota.Quota{MaxLinks: 2}), 0), WithAPIKeys("team1", "team2"))
+	r := newRouter(storage.NewMemoryStore(), c)
+
+	serve := func(method, path, apiKey, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if apiKey != "" {
+			req.Header.Set(apiKeyHeader, apiKey)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	add := func(apiKey, key string) *httptest.ResponseRecorder {
+		return serve("PUT", "/api", apiKey, fmt.Sprintf(`{"Key":%q,"URL":"https://example.org/%s"}`, key, key))
+	}
+
+	for _, key := range []string{"a", "b"} {
+		if w := add("team1", key); w.Code != http.StatusOK {
+			t.Fatalf("wrong status code adding %s: got %v want %v", key, w.Code, http.StatusOK)
+		}
+	}
+	assertProblem(t, add("team1", "c"), http.StatusForbidden, codeQuotaExceeded)
+	if w := add("team2", "c"); w.Code != http.StatusOK {
+		t.Errorf("other API keys should not be limited: got %v", w.Code)
+	}
+
+	// failed additions do not use the quota
+	assertProblem(t, add("team2", "a"), http.StatusConflict, codeKeyAlreadyExists)
+
+	w := serve("GET", "/api/usage", "team2", "")
+	var usage usageResponsePayload
+	if err := json.NewDecoder(w.Body).Decode(&usage); err != nil {
+		t.Fatal(err)
+	}
+	if usage.Links != 1 || usage.MaxLinks != 2 || usage.Bytes != int64(len("c")+len("https://example.org/c")) {
+		t.Errorf("unexpected usage: %+v", usage)
+	}
+
+	// keys that are not configured cannot own links, and links can only be deleted by their owner
+	assertProblem(t, add("made-up", "e"), http.StatusUnauthorized, codeUnknownAPIKey)
+	assertProblem(t, serve("GET", "/api/usage", "made-up", ""), http.StatusUnauthorized, codeUnknownAPIKey)
+	assertProblem(t, serve("DELETE", "/api", "", `{"Key":"a"}`), http.StatusForbidden, codeNotOwner)
+	assertProblem(t, serve("DELETE", "/api", "team2", `{"Key":"a"}`), http.StatusForbidden, codeNotOwner)
+	assertProblem(t, serve("DELETE", "/api", "made-up", `{"Key":"a"}`), http.StatusUnauthorized, codeUnknownAPIKey)
+
+	if w := serve("DELETE", "/api", "team1", `{"Key":"a"}`); w.Code != http.StatusOK {
+		t.Fatalf("wrong status code deleting: got %v want %v", w.Code, http.StatusOK)
+	}
+	if w := add("team1", "d"); w.Code != http.StatusOK {
+		t.Errorf("deleting a link should free its quota: got %v", w.Code)
+	}
+}
@@ -0,0 +1,130 @@
+package routes
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/giannimassi/shorturl/pkg/metrics"
+	"github.com/giannimassi/shorturl/pkg/ratelimit"
+	"github.com/gin-gonic/gin"
+)
+
+// codeRateLimited is the problem code of requests rejected by the rate limiter
+const codeRateLimited = "rate_limited"
+
+// Names of the limiters, used as metric labels
+const (
+	apiLimiterName      = "api"
+	redirectLimiterName = "redirect"
+)
+
+// limiterMetrics records the state of the rate limiters
+type limiterMetrics struct {
+	requests *metrics.Counter
+	clients  *metrics.Gauge
+}
+
+// newLimiterMetrics registers the rate limiter metrics in reg, returning nil if reg is nil
+func newLimiterMetrics(reg *metrics.Registry) *limiterMetrics {
+	if reg == nil {
+		return nil
+	}
+	return &limiterMetrics{
+		requests: reg.NewCounter("shorturl_ratelimit_requests_total",
+			"Number of requests checked by the rate limiters, by outcome.", "limiter", "allowed"),
+		clients: reg.NewGauge("shorturl_ratelimit_clients",
+			"Number of clients tracked by the rate limiters.", "limiter"),
+	}
+}
+
+func (m *limiterMetrics) record(name string, l *ratelimit.Limiter, allowed bool) {
+	if m == nil {
+		return
+	}
+	m.requests.Inc(name, strconv.FormatBool(allowed))
+	m.clients.Set(float64(l.Len()), name)
+}
+
+// rateLimitMiddleware returns a middleware rejecting with 429 the requests of clients exceeding limit.
+// Clients are identified by their API key if it is one of the configured keys, by their IP address
+// otherwise, so that clients cannot get new buckets by sending made up keys.
+// If api is true the rejection is reported with a problem payload.
+func rateLimitMiddleware(name string, limit ratelimit.Limit, api bool, c *config, m *limiterMetrics) gin.HandlerFunc {
+	if !limit.Enabled() {
+		return func(ctx *gin.Context) {}
+	}
+	l := ratelimit.New(limit)
+	return func(ctx *gin.Context) {
+		allowed, wait := l.Allow(rateLimitKey(ctx.Request, c))
+		m.record(name, l, allowed)
+		if allowed {
+			ctx.Next()
+			return
+		}
+
+		ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		if api {
+			writeProblem(ctx.Writer, ctx.Request, http.StatusTooManyRequests, codeRateLimited, "",
+				"rate limit exceeded, retry in "+wait.Round(time.Millisecond).String())
+		} else {
+			addLogFields(ctx.Request, "outcome", codeRateLimited)
+			ctx.Writer.WriteHeader(http.StatusTooManyRequests)
+		}
+		ctx.Abort()
+	}
+}
+
+// rateLimitKey returns the key identifying the client of r
+func rateLimitKey(r *http.Request, c *config) string {
+	if key := apiKey(r, c); key != "" {
+		return "key:" + key
+	}
+	return "ip:" + clientIP(r, c)
+}
+
+// clientIP returns the IP address of the client of r. Proxy headers are only trusted if the
+// request comes from one of the trusted proxies, in which case the rightmost untrusted address
+// of the first configured header set is returned.
+func clientIP(r *http.Request, c *config) string {
+	remote, _, err := net.SplitHostPort(strings.TrimSpace(r.RemoteAddr))
+	if err != nil {
+		remote = strings.TrimSpace(r.RemoteAddr)
+	}
+	if !c.isTrustedProxy(net.ParseIP(remote)) {
+		return remote
+	}
+
+	for _, header := range c.clientIPHeaders {
+		values := r.Header.Values(header)
+		if len(values) == 0 {
+			continue
+		}
+		addrs := strings.Split(strings.Join(values, ","), ",")
+		for i := len(addrs) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(addrs[i]))
+			if ip == nil {
+				break
+			}
+			if !c.isTrustedProxy(ip) || i == 0 {
+				return ip.String()
+			}
+		}
+	}
+	return remote
+}
+
+func (c *config) isTrustedProxy(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range c.trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package routes
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/giannimassi/shorturl/pkg/logging"
+	"github.com/giannimassi/shorturl/pkg/metrics"
+	"github.com/giannimassi/shorturl/pkg/ratelimit"
+	"github.com/gin-gonic/gin"
+)
+
+func Test_rateLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	reg := metrics.NewRegistry()
+	c := newConfig(
+		WithMetrics(reg),
+		WithLogger(logging.Discard(), 0),
+		WithRateLimits(ratelimit.Limit{Rate: 0.001, Burst: 2}, ratelimit.Limit{Rate: 0.001, Burst: 1}),
+		WithAPIKeys("k1", "k2"),
+	)
+	r := newRouter(newMockProvider(redirectTo, 0, nil), c)
+
+	serve := func(path, remote, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = remote
+		if apiKey != "" {
+			req.Header.Set(apiKeyHeader, apiKey)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// Redirects
+	if w := serve("/a", "192.0.2.1:1234", ""); w.Code != http.StatusMovedPermanently {
+		t.Fatalf("wrong status code: got %v want %v", w.Code, http.StatusMovedPermanently)
+	}
+	w := serve("/a", "192.0.2.1:1234", "")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("wrong status code: got %v want %v", w.Code, http.StatusTooManyRequests)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Errorf("expected Retry-After header")
+	}
+	if w := serve("/a", "192.0.2.2:1234", ""); w.Code != http.StatusMovedPermanently {
+		t.Errorf("other clients should not be limited: got %v", w.Code)
+	}
+
+	// API requests have their own limit and are keyed by API key if it is known
+	for i := 0; i < 2; i++ {
+		if w := serve("/api", "192.0.2.1:1234", "k1"); w.Code == http.StatusTooManyRequests {
+			t.Fatalf("request %d should not be limited", i)
+		}
+	}
+	assertProblem(t, serve("/api", "192.0.2.1:1234", "k1"), http.StatusTooManyRequests, codeRateLimited)
+	if w := serve("/api", "192.0.2.1:1234", "k2"); w.Code == http.StatusTooManyRequests {
+		t.Errorf("other API keys should not be limited: got %v", w.Code)
+	}
+
+	// made up keys do not get their own bucket
+	for i, key := range []string{"r1", "r2"} {
+		if w := serve("/api", "192.0.2.4:1234", key); w.Code == http.StatusTooManyRequests {
+			t.Fatalf("request %d should not be limited", i)
+		}
+	}
+	assertProblem(t, serve("/api", "192.0.2.4:1234", "r3"), http.StatusTooManyRequests, codeRateLimited)
+
+	w = serve("/metrics", "192.0.2.3:1234", "")
+	for _, expected := range []string{
+		`shorturl_ratelimit_requests_total{limiter="redirect",allowed="false"} 1`,
+		`shorturl_ratelimit_requests_total{limiter="api",allowed="true"} 5`,
+		`shorturl_ratelimit_clients{limiter="api"} 3`,
+	} {
+		if !strings.Contains(w.Body.String(), expected) {
+			t.Errorf("expected %q in metrics:\n%s", expected, w.Body.String())
+		}
+	}
+}
+
+func Test_clientIP(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	tests := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+
+		expected string
+	}{
+		{
+			name:     "no-proxy",
+			remote:   "192.0.2.1:1234",
+			expected: "192.0.2.1",
+		},
+		{
+			name:     "untrusted-proxy",
+			remote:   "192.0.2.1:1234",
+			headers:  map[string]string{"X-Forwarded-For": "198.51.100.1"},
+			expected: "192.0.2.1",
+		},
+		{
+			name:     "trusted-proxy",
+			remote:   "10.0.0.1:1234",
+			headers:  map[string]string{"X-Forwarded-For": "198.51.100.1"},
+			expected: "198.51.100.1",
+		},
+		{
+			name:     "trusted-proxy/spoofed",
+			remote:   "10.0.0.1:1234",
+			headers:  map[string]string{"X-Forwarded-For": "203.0.113.1, 198.51.100.1, 10.0.0.2"},
+			expected: "198.51.100.1",
+		},
+		{
+			name:     "trusted-proxy/fallback-header",
+			remote:   "10.0.0.1:1234",
+			headers:  map[string]string{"X-Real-IP": "198.51.100.1"},
+			expected: "198.51.100.1",
+		},
+		{
+			name:     "trusted-proxy/malformed",
+			remote:   "10.0.0.1:1234",
+			headers:  map[string]string{"X-Forwarded-For": "nonsense"},
+			expected: "10.0.0.1",
+		},
+	}
+	c := newConfig(WithTrustedProxies([]*net.IPNet{proxies}, "X-Forwarded-For", "X-Real-IP"))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			if got := clientIP(r, c); got != tt.expected {
+				t.Errorf("clientIP() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/giannimassi/shorturl/pkg/rules"
+	"github.com/giannimassi/shorturl/pkg/storage"
+	"github.com/giannimassi/shorturl/pkg/validation"
+)
+
+// rulesField is the name of the payload field holding the routing rules of a link
+const rulesField = "Rules"
+
+// rulePayload godoc
+type rulePayload struct {
+	Platforms []string `json:"Platforms,omitempty"` // Platforms of the client: ios, android, windows, macos or linux
+	Languages []string `json:"Languages,omitempty"` // Preferred language of the client, pt matching pt-BR as well
+	Countries []string `json:"Countries,omitempty"` // ISO 3166-1 alpha-2 codes of the country of the client address
+	URL       string   `json:"URL"`                 // URL to redirect to when all conditions are satisfied
+}
+
+func newRulePayloads(rs []storage.Rule) []rulePayload {
+	payloads := make([]rulePayload, 0, len(rs))
+	for _, r := range rs {
+		payloads = append(payloads, rulePayload(r))
+	}
+	return payloads
+}
+
+// validateRules checks the routing rules of a new link, returning them with normalized conditions
+// and urls to which the campaign parameters have been added. Failures are reported as
+// *validation.Error.
+func validateRules(c *config, payloads []rulePayload, campaign storage.Campaign, template bool) ([]storage.Rule, error) {
+	switch {
+	case len(payloads) == 0:
+		return nil, nil
+	case template:
+		return nil, &validation.Error{Field: rulesField, Code: validation.CodeMalformed, Message: "template links cannot have routing rules"}
+	case len(payloads) > rules.MaxRules:
+		return nil, &validation.Error{Field: rulesField, Code: validation.CodeTooLong, Message: fmt.Sprintf("links can have at most %d routing rules", rules.MaxRules)}
+	}
+	rs := make([]storage.Rule, 0, len(payloads))
+	for i, p := range payloads {
+		field := fmt.Sprintf("%s[%d]", rulesField, i)
+		r, err := rules.Normalize(storage.Rule(p))
+		if err != nil {
+			return nil, &validation.Error{Field: field, Code: validation.CodeMalformed, Message: err.Error()}
+		}
+		u, err := normalizeTargetURL(c, field, r.URL, campaign)
+		if err != nil {
+			return nil, err
+		}
+		r.URL = u.String()
+		rs = append(rs, r)
+	}
+	return rs, nil
+}
+
+// normalizeTargetURL validates and normalizes raw, one of the alternative urls of a link held by
+// the payload field, adding the campaign parameters. Failures are reported as *validation.Error
+// on the URL of field.
+func normalizeTargetURL(c *config, field, raw string, campaign storage.Campaign) (*url.URL, error) {
+	u, err := c.urlPolicy.NormalizeURL(raw)
+	if err != nil {
+		var vErr *validation.Error
+		if errors.As(err, &vErr) {
+			err = &validation.Error{Field: field + "." + vErr.Field, Code: vErr.Code, Message: vErr.Message}
+		}
+		return nil, err
+	}
+	applyCampaign(u, campaign)
+	if isSelfReference(c, u.Hostname()) {
+		return nil, &validation.Error{Field: field + "." + validation.URLField, Code: validation.CodeSelfReference, Message: "url points to a short domain"}
+	}
+	return u, nil
+}
+
+// ruleTarget returns the url of the first of rs matched by the client sending r, false if none
+// matches. The country of the client is only resolved if a rule needs it and a resolver is set.
+func ruleTarget(r *http.Request, c *config, rs []storage.Rule) (*url.URL, bool) {
+	var country string
+	if c.geo != nil && rules.NeedsCountry(rs) {
+		country, _ = c.geo.Country(net.ParseIP(clientIP(r, c)))
+	}
+	client := rules.NewClient(r.Header.Get("User-Agent"), r.Header.Get("Accept-Language"), country)
+	i, found := rules.Select(rs, client)
+	if !found {
+		return nil, false
+	}
+	u, err := url.Parse(rs[i].URL)
+	if err != nil {
+		return nil, false
+	}
+	addLogFields(r, "rule", i)
+	return u, true
+}
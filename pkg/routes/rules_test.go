@@ -0,0 +1,105 @@
+package routes
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/giannimassi/shorturl/pkg/geo"
+	"github.com/giannimassi/shorturl/pkg/logging"
+	"github.com/giannimassi/shorturl/pkg/storage"
+	"github.com/giannimassi/shorturl/pkg/validation"
+	"github.com/gin-gonic/gin"
+)
+
+func Test_redirectRules(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := geo.ReadDatabase(strings.NewReader("198.51.100.0/24,BR\n203.0.113.0/24,IT\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, proxies, _ := net.ParseCIDR("192.0.2.0/24") // httptest requests come from 192.0.2.1
+	r := newRouter(storage.NewMemoryStore(), newConfig(WithLogger(logging.Discard(), 0), WithGeoResolver(db),
+		WithTrustedProxies([]*net.IPNet{proxies}, "X-Forwarded-For")))
+
+	serve := func(method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for name, value := range header {
+			req.Header.Set(name, value)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve("PUT", "/api", `{"Key":"app","URL":"https://app.example/","Campaign":{"Source":"qr"},"Rules":[
+		{"Platforms":["iOS"],"URL":"https://apps.apple.com/app/id1"},
+		{"Platforms":["android"],"URL":"https://play.google.com/store/apps/details?id=app"},
+		{"Languages":["pt"],"Countries":["br"],"URL":"https://app.example/pt-br"}]}`, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("wrong status code: %v %s", w.Code, w.Body)
+	}
+
+	tests := []struct {
+		name     string
+		header   map[string]string
+		location string
+	}{
+		{
+			name:     "ios",
+			header:   map[string]string{"User-Agent": "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)"},
+			location: "https://apps.apple.com/app/id1?utm_source=qr",
+		},
+		{
+			name:     "android",
+			header:   map[string]string{"User-Agent": "Mozilla/5.0 (Linux; Android 14; Pixel 8)"},
+			location: "https://play.google.com/store/apps/details?id=app&utm_source=qr",
+		},
+		{
+			name:     "language-and-country",
+			header:   map[string]string{"Accept-Language": "pt-BR,pt;q=0.9", "X-Forwarded-For": "198.51.100.7"},
+			location: "https://app.example/pt-br?utm_source=qr",
+		},
+		{
+			name:     "other-country",
+			header:   map[string]string{"Accept-Language": "pt-BR", "X-Forwarded-For": "203.0.113.7"},
+			location: "https://app.example/?utm_source=qr",
+		},
+		{
+			name:     "default",
+			header:   map[string]string{"User-Agent": "curl/8.4.0"},
+			location: "https://app.example/?utm_source=qr",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve("GET", "/app", "", tt.header)
+			if w.Code != http.StatusFound || w.Header().Get("Location") != tt.location {
+				t.Errorf("got %v %q want %v %q", w.Code, w.Header().Get("Location"), http.StatusFound, tt.location)
+			}
+			if w.Header().Get("Vary") == "" {
+				t.Error("expected Vary header")
+			}
+		})
+	}
+
+	var info infoResponsePayload
+	if err := json.NewDecoder(serve("GET", "/api", `{"Key":"app"}`, nil).Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Rules) != 3 || info.Rules[0].Platforms[0] != "ios" || info.Rules[2].Countries[0] != "BR" {
+		t.Errorf("unexpected rules: %+v", info.Rules)
+	}
+
+	for body, code := range map[string]string{
+		`{"Key":"r1","URL":"https://a.example","Rules":[{"URL":"https://b.example"}]}`:                                         validation.CodeMalformed,
+		`{"Key":"r2","URL":"https://a.example","Rules":[{"Platforms":["palm"],"URL":"https://b.example"}]}`:                    validation.CodeMalformed,
+		`{"Key":"r3","URL":"https://a.example","Rules":[{"Platforms":["ios"],"URL":"ftp://b.example"}]}`:                       validation.CodeSchemeNotAllowed,
+		`{"Key":"r4","URL":"https://a.example/{1}","Template":true,"Rules":[{"Platforms":["ios"],"URL":"https://b.example"}]}`: validation.CodeMalformed,
+	} {
+		assertProblem(t, serve("PUT", "/api", body, nil), http.StatusUnprocessableEntity, code)
+	}
+}
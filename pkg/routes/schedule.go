@@ -0,0 +1,180 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/giannimassi/shorturl/pkg/domains"
+	"github.com/giannimassi/shorturl/pkg/storage"
+	"github.com/giannimassi/shorturl/pkg/validation"
+)
+
+// Names of the payload fields of the activation window of a link
+const (
+	notBeforeField     = "NotBefore"
+	notAfterField      = "NotAfter"
+	comingSoonURLField = "ComingSoonURL"
+)
+
+// schedulePage is shown when a link is requested outside of its activation window
+var schedulePage = template.Must(template.New("schedule").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>{{if .Ended}}Link expired{{else}}Coming soon{{end}}: {{.Key}}</title></head>
+<body>
+{{if .Ended}}<h1>This link has expired</h1>
+<p>The short link <strong>{{.Key}}</strong> is no longer available.</p>
+{{else}}<h1>{{if .Title}}{{.Title}}{{else}}Coming soon{{end}}</h1>
+<p>The short link <strong>{{.Key}}</strong> will be available from {{.NotBefore.Format "2006-01-02 15:04 MST"}}.</p>
+{{end}}</body>
+</html>
+`))
+
+type schedulePageData struct {
+	Key       string
+	Title     string
+	NotBefore time.Time
+	Ended     bool
+}
+
+// validateSchedule checks the activation window of a new link, returning the normalized url of
+// its coming soon redirect. Failures are reported as *validation.Error.
+func validateSchedule(c *config, notBefore, notAfter time.Time, comingSoonURL string) (string, error) {
+	if !notBefore.IsZero() && !notAfter.IsZero() && !notAfter.After(notBefore) {
+		return "", &validation.Error{Field: notAfterField, Code: validation.CodeMalformed, Message: "the end of the activation window must follow its start"}
+	}
+	if comingSoonURL == "" {
+		return "", nil
+	}
+	if notBefore.IsZero() {
+		return "", &validation.Error{Field: comingSoonURLField, Code: validation.CodeMalformed, Message: "only links with a start time can redirect before it"}
+	}
+	u, err := c.urlPolicy.NormalizeURL(comingSoonURL)
+	if err != nil {
+		var vErr *validation.Error
+		if errors.As(err, &vErr) {
+			err = &validation.Error{Field: comingSoonURLField, Code: vErr.Code, Message: vErr.Message}
+		}
+		return "", err
+	}
+	if isSelfReference(c, u.Hostname()) {
+		return "", &validation.Error{Field: comingSoonURLField, Code: validation.CodeSelfReference, Message: "url points to a short domain"}
+	}
+	return u.String(), nil
+}
+
+// checkSchedule returns true if the link can be followed now. Otherwise it redirects to the coming
+// soon url of a scheduled link or shows a page, and returns false.
+func checkSchedule(w http.ResponseWriter, r *http.Request, key string, md storage.Metadata) bool {
+	switch md.State(time.Now()) {
+	case storage.StateScheduled:
+		addLogFields(r, "outcome", "scheduled")
+		if md.ComingSoonURL != "" {
+			http.Redirect(w, r, md.ComingSoonURL, http.StatusFound)
+			return false
+		}
+		renderPage(w, http.StatusNotFound, schedulePage, schedulePageData{Key: key, Title: md.Title, NotBefore: md.NotBefore})
+		return false
+	case storage.StateEnded:
+		addLogFields(r, "outcome", "ended")
+		renderPage(w, http.StatusGone, schedulePage, schedulePageData{Key: key, Ended: true})
+		return false
+	}
+	return true
+}
+
+// timePointer returns nil for the zero time, so that it is omitted from payloads
+func timePointer(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// linkPayload godoc
+type linkPayload struct {
+	Key       string        `json:"Key"`                 // Key of the link
+	Domain    string        `json:"Domain,omitempty"`    // Short domain of the key, omitted for the default domain
+	URL       string        `json:"URL"`                 // URL to redirect to
+	State     storage.State `json:"State"`               // Whether the link redirects: scheduled, active or ended
+	NotBefore *time.Time    `json:"NotBefore,omitempty"` // When the link starts redirecting, omitted if active since its creation
+	NotAfter  *time.Time    `json:"NotAfter,omitempty"`  // When the link stops redirecting, omitted if it never does
+}
+
+// listLinksHandler returns an http.Handler listing the stored links. Every link is read from the
+// storage, so the list is meant for occasional use.
+// @Summary List short urls
+// @Description Lists the stored links in key order, optionally restricted to a short domain and to the links in a state of their activation window
+// @Produce json
+// @Produce application/problem+json
+// @Param state query string false "State of the links: scheduled, active or ended, all if empty"
+// @Param domain query string false "Short domain of the links, all domains if empty"
+// @Success 200 {array} linkPayload
+// @Failure 422 {object} problemPayload "The state is unknown or the domain is not registered"
+// @Failure 429 {object} problemPayload "Too many requests from the client, retry after the Retry-After header seconds"
+// @Failure 500 {object} problemPayload "The server has encountered an unknown error"
+// @Failure 503 {object} problemPayload "The storage did not respond in time"
+// @Router /api/links [get]
+func listLinksHandler(s ShortURLProvider, c *config) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, span := startSpan(r, "listLinksHandler")
+		defer span.End()
+		query := r.URL.Query()
+		state := storage.State(query.Get("state"))
+		switch state {
+		case "", storage.StateScheduled, storage.StateActive, storage.StateEnded:
+		default:
+			writeError(w, r, &validation.Error{Field: "state", Code: validation.CodeMalformed, Message: "unknown state " + string(state)})
+			return
+		}
+		domain := query.Get("domain")
+		host, err := payloadDomain(c, domain)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		keys, err := s.Keys(r.Context())
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		now := time.Now()
+		links := []linkPayload{}
+		for _, storageKey := range keys {
+			h, key := domains.SplitKey(storageKey)
+			if domain != "" && h != host {
+				continue
+			}
+			md, err := s.Metadata(r.Context(), storageKey)
+			if err == nil && state != "" && md.State(now) != state {
+				continue
+			}
+			var shortURL *url.URL
+			if err == nil {
+				shortURL, _, err = s.ShortURLInfo(r.Context(), storageKey)
+			}
+			if errors.Is(err, storage.ErrKeyNotFound) {
+				continue // deleted in the meantime
+			}
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			links = append(links, linkPayload{
+				Key:       key,
+				Domain:    h,
+				URL:       shortURL.String(),
+				State:     md.State(now),
+				NotBefore: timePointer(md.NotBefore),
+				NotAfter:  timePointer(md.NotAfter),
+			})
+		}
+		addLogFields(r, "outcome", "found")
+		w.Header().Add("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(links)
+	})
+}
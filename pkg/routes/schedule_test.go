@@ -0,0 +1,104 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/giannimassi/shorturl/pkg/logging"
+	"github.com/giannimassi/shorturl/pkg/storage"
+	"github.com/giannimassi/shorturl/pkg/validation"
+	"github.com/gin-gonic/gin"
+)
+
+func Test_activationWindows(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := storage.NewMemoryStore()
+	r := newRouter(store, newConfig(WithLogger(logging.Discard(), 0)))
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	now := time.Now()
+	past, future := now.Add(-time.Hour).Format(time.RFC3339), now.Add(time.Hour).Format(time.RFC3339)
+	for _, body := range []string{
+		`{"Key":"launch","URL":"https://shop.example/launch","NotBefore":"` + future + `"}`,
+		`{"Key":"teaser","URL":"https://shop.example/launch","NotBefore":"` + future + `","ComingSoonURL":"https://shop.example/soon"}`,
+		`{"Key":"sale","URL":"https://shop.example/sale","NotBefore":"` + past + `","NotAfter":"` + future + `"}`,
+		`{"Key":"old","URL":"https://shop.example/old","NotAfter":"` + past + `"}`,
+		`{"Key":"plain","URL":"https://shop.example/"}`,
+	} {
+		if w := serve("PUT", "/api", body); w.Code != http.StatusOK {
+			t.Fatalf("wrong status code: %v %s", w.Code, w.Body)
+		}
+	}
+
+	for path, expected := range map[string]struct {
+		code     int
+		location string
+	}{
+		"/launch":           {http.StatusNotFound, ""},
+		"/launch?preview=1": {http.StatusNotFound, ""},
+		"/teaser":           {http.StatusFound, "https://shop.example/soon"},
+		"/sale":             {http.StatusFound, "https://shop.example/sale"},
+		"/old":              {http.StatusGone, ""},
+		"/plain":            {http.StatusMovedPermanently, "https://shop.example/"},
+	} {
+		w := serve("GET", path, "")
+		if w.Code != expected.code || w.Header().Get("Location") != expected.location {
+			t.Errorf("%s: got %v %q want %v %q", path, w.Code, w.Header().Get("Location"), expected.code, expected.location)
+		}
+	}
+	if w := serve("GET", "/launch", ""); !strings.Contains(w.Body.String(), "will be available from") {
+		t.Errorf("expected the coming soon page, got %s", w.Body)
+	}
+	for _, key := range []string{"launch", "teaser", "old"} {
+		if _, hits, _ := store.ShortURLInfo(context.Background(), key); hits != 0 {
+			t.Errorf("%s: hits should not be counted outside of the window, got %d", key, hits)
+		}
+	}
+
+	var info infoResponsePayload
+	if err := json.NewDecoder(serve("GET", "/api", `{"Key":"sale"}`).Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	if info.State != storage.StateActive || info.NotBefore == nil || info.NotAfter == nil || info.NotAfter.Format(time.RFC3339) != future {
+		t.Errorf("unexpected info: %+v", info)
+	}
+
+	for state, expected := range map[string][]string{
+		"":          {"launch", "old", "plain", "sale", "teaser"},
+		"scheduled": {"launch", "teaser"},
+		"active":    {"plain", "sale"},
+		"ended":     {"old"},
+	} {
+		w := serve("GET", "/api/links?state="+state, "")
+		var links []linkPayload
+		if err := json.NewDecoder(w.Body).Decode(&links); err != nil {
+			t.Fatal(err)
+		}
+		var keys []string
+		for _, l := range links {
+			keys = append(keys, l.Key)
+		}
+		if strings.Join(keys, ",") != strings.Join(expected, ",") {
+			t.Errorf("%q: got %v want %v", state, keys, expected)
+		}
+	}
+	assertProblem(t, serve("GET", "/api/links?state=paused", ""), http.StatusUnprocessableEntity, validation.CodeMalformed)
+
+	for body, code := range map[string]string{
+		`{"Key":"w1","URL":"https://shop.example/","NotBefore":"` + future + `","NotAfter":"` + past + `"}`:            validation.CodeMalformed,
+		`{"Key":"w2","URL":"https://shop.example/","ComingSoonURL":"https://shop.example/soon"}`:                       validation.CodeMalformed,
+		`{"Key":"w3","URL":"https://shop.example/","NotBefore":"` + future + `","ComingSoonURL":"ftp://shop.example"}`: validation.CodeSchemeNotAllowed,
+	} {
+		assertProblem(t, serve("PUT", "/api", body), http.StatusUnprocessableEntity, code)
+	}
+}
@@ -0,0 +1,82 @@
+package routes
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/giannimassi/shorturl/pkg/linktemplate"
+	"github.com/giannimassi/shorturl/pkg/storage"
+	"github.com/giannimassi/shorturl/pkg/validation"
+)
+
+// templateField is the name of the payload field marking template links
+const templateField = "Template"
+
+// acceptsPath returns true if a link with the provided metadata can be requested with the escaped
+// path rest after its key: the arguments of a template link, or any path for a passthrough link
+func acceptsPath(md storage.Metadata, rest string) bool {
+	switch {
+	case md.Template != "":
+		t, err := linktemplate.Parse(md.Template)
+		if err != nil {
+			return false
+		}
+		args, ok := pathArguments(rest)
+		return ok && len(args) == t.Arity()
+	case md.Passthrough:
+		return validPassthroughPath(rest)
+	}
+	return false
+}
+
+// linkTarget returns the url a request with the escaped path rest after the key and the provided
+// query is redirected to, u being the stored url of the link. The path must be accepted by the
+// link according to acceptsPath.
+func linkTarget(u *url.URL, rest string, query url.Values, md storage.Metadata) (*url.URL, error) {
+	switch {
+	case md.Template != "" && rest != "":
+		t, err := linktemplate.Parse(md.Template)
+		if err != nil {
+			return nil, err
+		}
+		args, _ := pathArguments(rest)
+		return t.Expand(args...)
+	case md.Passthrough:
+		return passthroughURL(u, rest, query, md.QueryPrecedence), nil
+	}
+	return u, nil
+}
+
+// pathArguments returns the unescaped segments of the escaped path rest, false if a segment is
+// empty or cannot be unescaped
+func pathArguments(rest string) ([]string, bool) {
+	if rest == "" {
+		return nil, true
+	}
+	segments := strings.Split(strings.TrimPrefix(rest, "/"), "/")
+	for i, s := range segments {
+		unescaped, err := url.PathUnescape(s)
+		if err != nil || unescaped == "" {
+			return nil, false
+		}
+		segments[i] = unescaped
+	}
+	return segments, true
+}
+
+// validateTemplate checks the url template raw of a new link, returning its base url to be stored
+// and validated as the url of the link. Failures are reported as *validation.Error.
+func validateTemplate(raw string, passthrough bool) (string, error) {
+	if passthrough {
+		return "", &validation.Error{Field: templateField, Code: validation.CodeMalformed, Message: "template links cannot be passthrough links"}
+	}
+	t, err := linktemplate.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", &validation.Error{Field: validation.URLField, Code: validation.CodeMalformed, Message: err.Error()}
+	}
+	base, err := t.Base()
+	if err != nil {
+		return "", &validation.Error{Field: validation.URLField, Code: validation.CodeMalformed, Message: err.Error()}
+	}
+	return base.String(), nil
+}
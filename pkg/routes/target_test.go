@@ -0,0 +1,71 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/giannimassi/shorturl/pkg/logging"
+	"github.com/giannimassi/shorturl/pkg/storage"
+	"github.com/giannimassi/shorturl/pkg/validation"
+	"github.com/gin-gonic/gin"
+)
+
+func Test_templateLinks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := storage.NewMemoryStore()
+	r := newRouter(store, newConfig(WithLogger(logging.Discard(), 0)))
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+	add := func(key, template string, passthrough bool) *httptest.ResponseRecorder {
+		return serve("PUT", "/api", fmt.Sprintf(`{"Key":%q,"URL":%q,"Template":true,"Passthrough":%v}`, key, template, passthrough))
+	}
+
+	for key, template := range map[string]string{
+		"jira":   "https://jira.example/browse/{1}",
+		"gh":     "https://github.com/{1}/{2}",
+		"search": "https://search.example/?q={1}&lang=en",
+	} {
+		if w := add(key, template, false); w.Code != http.StatusOK {
+			t.Fatalf("wrong status code adding %s: %v %s", key, w.Code, w.Body)
+		}
+	}
+	assertProblem(t, add("host", "https://{1}.example/", false), http.StatusUnprocessableEntity, validation.CodeMalformed)
+	assertProblem(t, add("braces", "https://example.org/{x}", false), http.StatusUnprocessableEntity, validation.CodeMalformed)
+	assertProblem(t, add("both", "https://example.org/{1}", true), http.StatusUnprocessableEntity, validation.CodeMalformed)
+	assertProblem(t, add("scheme", "ftp://example.org/{1}", false), http.StatusUnprocessableEntity, validation.CodeSchemeNotAllowed)
+
+	tests := []struct {
+		path     string
+		status   int
+		location string
+	}{
+		{path: "/jira/ABC-123", status: http.StatusMovedPermanently, location: "https://jira.example/browse/ABC-123"},
+		{path: "/jira", status: http.StatusMovedPermanently, location: "https://jira.example/browse/"},
+		{path: "/jira/ABC-123/more", status: http.StatusNotFound},
+		{path: "/jira/a%2F..%2Fadmin", status: http.StatusMovedPermanently, location: "https://jira.example/browse/a%2F..%2Fadmin"},
+		{path: "/gh/golang/go", status: http.StatusMovedPermanently, location: "https://github.com/golang/go"},
+		{path: "/gh/golang", status: http.StatusNotFound},
+		{path: "/search/a%26lang%3Dit", status: http.StatusMovedPermanently, location: "https://search.example/?q=a%26lang%3Dit&lang=en"},
+	}
+	for _, tt := range tests {
+		w := serve("GET", tt.path, "")
+		if w.Code != tt.status || w.Header().Get("Location") != tt.location {
+			t.Errorf("%s: got %v %q want %v %q", tt.path, w.Code, w.Header().Get("Location"), tt.status, tt.location)
+		}
+	}
+
+	if w := serve("GET", "/jira/ABC-123?preview=1", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "https://jira.example/browse/ABC-123") {
+		t.Errorf("preview should show the expanded url: %v %s", w.Code, w.Body)
+	}
+	// the preview suffix only follows bare keys, arguments may end with it
+	if w := serve("GET", "/jira/ABC-123+", ""); w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "https://jira.example/browse/ABC-123+" {
+		t.Errorf("unexpected redirect of argument ending with the preview suffix: %v %v", w.Code, w.Header())
+	}
+}
@@ -0,0 +1,53 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/giannimassi/shorturl/pkg/logging"
+	"github.com/gin-gonic/gin"
+)
+
+// blockingProvider is a mockProvider whose lookups block until their context is done
+type blockingProvider struct {
+	*mockProvider
+}
+
+func (s blockingProvider) ShortURL(ctx context.Context, key string) (*url.URL, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (s blockingProvider) ShortURLInfo(ctx context.Context, key string) (*url.URL, int, error) {
+	<-ctx.Done()
+	return nil, 0, ctx.Err()
+}
+
+func Test_storageTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c := newConfig(WithLogger(logging.Discard(), 0), WithStorageTimeout(10*time.Millisecond))
+	r := newRouter(blockingProvider{newMockProvider(redirectTo, 0, nil)}, c)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api", strings.NewReader(`{"Key":"abcdef"}`)))
+	assertProblem(t, w, http.StatusServiceUnavailable, codeStorageTimeout)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/abcdef", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("wrong status code: got %v want %v", w.Code, http.StatusServiceUnavailable)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/abcdef", nil).WithContext(ctx))
+	if w.Code != statusClientClosedRequest {
+		t.Errorf("wrong status code: got %v want %v", w.Code, statusClientClosedRequest)
+	}
+}
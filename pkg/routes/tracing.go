@@ -0,0 +1,44 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/giannimassi/shorturl/pkg/tracing"
+	"github.com/gin-gonic/gin"
+)
+
+// tracingMiddleware starts a span for every request, continuing the trace of the incoming
+// traceparent header if valid
+func tracingMiddleware(t *tracing.Tracer) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		route := ctx.FullPath()
+		if route == "" {
+			route = redirectRoute
+		}
+		remote, _ := tracing.Extract(ctx.Request.Header)
+		rctx, span := t.Start(ctx.Request.Context(), ctx.Request.Method+" "+route, remote)
+		span.SetAttributes(
+			"http.method", ctx.Request.Method,
+			"http.route", route,
+			"http.target", ctx.Request.URL.Path,
+			"request_id", requestID(rctx),
+		)
+		ctx.Request = ctx.Request.WithContext(rctx)
+		ctx.Next()
+
+		status := ctx.Writer.Status()
+		span.SetAttributes("http.status_code", status)
+		if status >= http.StatusInternalServerError {
+			span.SetError(fmt.Errorf("request failed with status %d", status))
+		}
+		span.End()
+	}
+}
+
+// startSpan starts a span named name as a child of the span of the request, returning
+// the request carrying the new span
+func startSpan(r *http.Request, name string) (*http.Request, *tracing.Span) {
+	ctx, span := tracing.StartSpan(r.Context(), name)
+	return r.WithContext(ctx), span
+}
@@ -0,0 +1,44 @@
+package routes
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/giannimassi/shorturl/pkg/logging"
+	"github.com/giannimassi/shorturl/pkg/tracing"
+	"github.com/gin-gonic/gin"
+)
+
+func Test_tracingMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rec := &tracing.Recorder{}
+	c := newConfig(WithTracer(tracing.NewTracer(rec, nil)), WithLogger(logging.Discard(), 0))
+	r := newRouter(newMockProvider(redirectTo, 0, nil), c)
+
+	req := httptest.NewRequest("GET", "/abc", nil)
+	req.Header.Set(tracing.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := rec.Spans()
+	names := make([]string, 0, len(spans))
+	for _, s := range spans {
+		names = append(names, s.Name)
+		if s.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("span %s not part of the incoming trace", s.Name)
+		}
+	}
+	expected := []string{"storage.Metadata", "storage.ShortURL", "redirectHandler", "GET redirect"}
+	if len(names) != len(expected) {
+		t.Fatalf("unexpected spans: got %v want %v", names, expected)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Fatalf("unexpected spans: got %v want %v", names, expected)
+		}
+	}
+
+	server, handler := spans[3], spans[2]
+	if server.ParentSpanID.String() != "00f067aa0ba902b7" || handler.ParentSpanID != server.SpanID || spans[0].ParentSpanID != handler.SpanID {
+		t.Errorf("unexpected span hierarchy: %+v", spans)
+	}
+}
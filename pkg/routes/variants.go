@@ -0,0 +1,163 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/giannimassi/shorturl/pkg/storage"
+	"github.com/giannimassi/shorturl/pkg/validation"
+)
+
+// variantsField is the name of the payload field holding the variants of a split link
+const variantsField = "Variants"
+
+// maxVariants is the maximum number of variants of a split link
+const maxVariants = 10
+
+// variantCookie is the name of the cookie holding the variant assigned to a client, scoped to the
+// path of each link
+const variantCookie = "shorturl_variant"
+
+// variantCookieMaxAge is how long clients keep the variant assigned to them
+const variantCookieMaxAge = 30 * 24 * time.Hour
+
+// variantRand picks the variants of the requests without assignment
+var variantRand = struct {
+	sync.Mutex
+	*rand.Rand
+}{Rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// variantPayload godoc
+type variantPayload struct {
+	URL    string // URL to redirect to
+	Weight int    // Share of the requests sent to the variant, relative to the sum of all weights
+}
+
+// variantStatsPayload godoc
+type variantStatsPayload struct {
+	URL    string `json:"URL"`    // URL of the variant
+	Weight int    `json:"Weight"` // Share of the requests sent to the variant
+	Hits   int    `json:"Hits"`   // Number of requests redirected to the variant
+}
+
+// validateVariants checks the variants of a new split link, returning them with normalized urls to
+// which the campaign parameters have been added. Failures are reported as *validation.Error.
+func validateVariants(c *config, payloads []variantPayload, campaign storage.Campaign, template bool) ([]storage.Variant, error) {
+	switch {
+	case len(payloads) == 0:
+		return nil, nil
+	case template:
+		return nil, &validation.Error{Field: variantsField, Code: validation.CodeMalformed, Message: "template links cannot be split"}
+	case len(payloads) == 1:
+		return nil, &validation.Error{Field: variantsField, Code: validation.CodeTooShort, Message: "split links need at least 2 variants"}
+	case len(payloads) > maxVariants:
+		return nil, &validation.Error{Field: variantsField, Code: validation.CodeTooLong, Message: fmt.Sprintf("split links can have at most %d variants", maxVariants)}
+	}
+	vs := make([]storage.Variant, 0, len(payloads))
+	total := 0
+	for i, p := range payloads {
+		field := fmt.Sprintf("%s[%d]", variantsField, i)
+		if p.Weight < 0 {
+			return nil, &validation.Error{Field: field + ".Weight", Code: validation.CodeMalformed, Message: "weight cannot be negative"}
+		}
+		total += p.Weight
+		u, err := normalizeTargetURL(c, field, p.URL, campaign)
+		if err != nil {
+			return nil, err
+		}
+		vs = append(vs, storage.Variant{URL: u.String(), Weight: p.Weight})
+	}
+	if total == 0 {
+		return nil, &validation.Error{Field: variantsField, Code: validation.CodeMalformed, Message: "at least one variant needs a positive weight"}
+	}
+	return vs, nil
+}
+
+// pickVariant returns the index of the variant of vs selected by n, between 0 and the sum of the
+// weights excluded: each variant is selected by as many values as its weight
+func pickVariant(vs []storage.Variant, n int) int {
+	for i, v := range vs {
+		if n < v.Weight {
+			return i
+		}
+		n -= v.Weight
+	}
+	return len(vs) - 1
+}
+
+// stickyVariant returns the variant assigned to the client of r by a previous redirect of the link,
+// false if there is none or it cannot be selected anymore
+func stickyVariant(r *http.Request, vs []storage.Variant) (int, bool) {
+	cookie, err := r.Cookie(variantCookie)
+	if err != nil {
+		return 0, false
+	}
+	i, err := strconv.Atoi(cookie.Value)
+	if err != nil || i < 0 || i >= len(vs) || vs[i].Weight <= 0 {
+		return 0, false
+	}
+	return i, true
+}
+
+// variantTarget selects the variant of the split link for key to redirect r to, assigning it to the
+// client if the link is sticky, and counts a hit for it. Failures to count the hit are only logged.
+func variantTarget(w http.ResponseWriter, r *http.Request, s ShortURLProvider, storageKey, key string, md storage.Metadata) (*url.URL, error) {
+	i, assigned := -1, false
+	if md.Sticky {
+		i, assigned = stickyVariant(r, md.Variants)
+	}
+	if !assigned {
+		total := 0
+		for _, v := range md.Variants {
+			total += v.Weight
+		}
+		variantRand.Lock()
+		i = pickVariant(md.Variants, variantRand.Intn(total))
+		variantRand.Unlock()
+		if md.Sticky {
+			http.SetCookie(w, &http.Cookie{
+				Name:     variantCookie,
+				Value:    strconv.Itoa(i),
+				Path:     "/" + url.PathEscape(key),
+				MaxAge:   int(variantCookieMaxAge / time.Second),
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+	}
+	addLogFields(r, "variant", i)
+	if counter, ok := s.(storage.VariantCounter); ok {
+		if err := counter.AddVariantHit(r.Context(), storageKey, i); err != nil {
+			addLogFields(r, "variant_error", err)
+		}
+	}
+	return url.Parse(md.Variants[i].URL)
+}
+
+// newVariantStats returns the variants of a split link along with their hits
+func newVariantStats(vs []storage.Variant, hits []int) []variantStatsPayload {
+	stats := make([]variantStatsPayload, 0, len(vs))
+	for i, v := range vs {
+		p := variantStatsPayload{URL: v.URL, Weight: v.Weight}
+		if i < len(hits) {
+			p.Hits = hits[i]
+		}
+		stats = append(stats, p)
+	}
+	return stats
+}
+
+// variantHits returns the hits of each variant of the link for key, nil if s does not count them
+func variantHits(ctx context.Context, s ShortURLProvider, key string) ([]int, error) {
+	counter, ok := s.(storage.VariantCounter)
+	if !ok {
+		return nil, nil
+	}
+	return counter.VariantHits(ctx, key)
+}
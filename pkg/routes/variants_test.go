@@ -0,0 +1,101 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/giannimassi/shorturl/pkg/logging"
+	"github.com/giannimassi/shorturl/pkg/storage"
+	"github.com/giannimassi/shorturl/pkg/validation"
+	"github.com/gin-gonic/gin"
+)
+
+func Test_pickVariant(t *testing.T) {
+	vs := []storage.Variant{{Weight: 1}, {Weight: 0}, {Weight: 3}}
+	for n, expected := range map[int]int{0: 0, 1: 2, 3: 2} {
+		if got := pickVariant(vs, n); got != expected {
+			t.Errorf("%d: got %d want %d", n, got, expected)
+		}
+	}
+}
+
+func Test_splitLinks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := newRouter(storage.NewMemoryStore(), newConfig(WithLogger(logging.Discard(), 0)))
+
+	serve := func(method, path, body string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve("PUT", "/api", `{"Key":"exp","Sticky":true,"Variants":[{"URL":"https://a.example/","Weight":1},{"URL":"https://b.example/","Weight":1}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("wrong status code: %v %s", w.Code, w.Body)
+	}
+	w = serve("PUT", "/api", `{"Key":"paused","Variants":[{"URL":"https://a.example/","Weight":0},{"URL":"https://b.example/","Weight":2}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("wrong status code: %v %s", w.Code, w.Body)
+	}
+
+	w = serve("GET", "/exp", "")
+	if w.Code != http.StatusFound {
+		t.Fatalf("wrong status code: %v", w.Code)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != variantCookie || cookies[0].Path != "/exp" {
+		t.Fatalf("expected a variant cookie, got %v", cookies)
+	}
+	first := w.Header().Get("Location")
+	for i := 0; i < 5; i++ {
+		w := serve("GET", "/exp", "", cookies[0])
+		if location := w.Header().Get("Location"); location != first {
+			t.Errorf("sticky variant not kept: got %v want %v", location, first)
+		}
+		if len(w.Result().Cookies()) != 0 {
+			t.Error("assigned clients should not get a new cookie")
+		}
+	}
+	for i := 0; i < 3; i++ {
+		w := serve("GET", "/paused", "")
+		if location := w.Header().Get("Location"); location != "https://b.example/" {
+			t.Errorf("variants without weight should not be selected, got %v", location)
+		}
+		if len(w.Result().Cookies()) != 0 {
+			t.Error("links that are not sticky should not set cookies")
+		}
+	}
+
+	var info infoResponsePayload
+	if err := json.NewDecoder(serve("GET", "/api", `{"Key":"exp"}`).Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	if info.URL != "https://a.example/" || !info.Sticky || len(info.Variants) != 2 || info.Variants[0].Hits+info.Variants[1].Hits != 6 || info.Hits != 6 {
+		t.Errorf("unexpected info: %+v", info)
+	}
+
+	var stats statsResponsePayload
+	if err := json.NewDecoder(serve("GET", "/api/stats", "").Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Splits) != 2 || stats.Splits[1].Key != "paused" || stats.Splits[1].Variants[1].Hits != 3 {
+		t.Errorf("unexpected split stats: %+v", stats.Splits)
+	}
+
+	for body, code := range map[string]string{
+		`{"Key":"s1","URL":"https://a.example","Variants":[{"URL":"https://a.example","Weight":1},{"URL":"https://b.example","Weight":1}]}`: validation.CodeMalformed,
+		`{"Key":"s2","Variants":[{"URL":"https://a.example","Weight":1}]}`:                                                                  validation.CodeTooShort,
+		`{"Key":"s3","Variants":[{"URL":"https://a.example","Weight":-1},{"URL":"https://b.example","Weight":2}]}`:                          validation.CodeMalformed,
+		`{"Key":"s4","Variants":[{"URL":"https://a.example"},{"URL":"https://b.example"}]}`:                                                 validation.CodeMalformed,
+		`{"Key":"s5","Variants":[{"URL":"https://a.example","Weight":1},{"URL":"ftp://b.example","Weight":1}]}`:                             validation.CodeSchemeNotAllowed,
+	} {
+		assertProblem(t, serve("PUT", "/api", body), http.StatusUnprocessableEntity, code)
+	}
+}
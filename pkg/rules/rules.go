@@ -0,0 +1,198 @@
+// Package rules selects the target of a link among its storage.Rule according to the platform,
+// language and country of the client
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/giannimassi/shorturl/pkg/geo"
+	"github.com/giannimassi/shorturl/pkg/storage"
+)
+
+// Platforms detected from the User-Agent header
+const (
+	PlatformIOS     = "ios"
+	PlatformAndroid = "android"
+	PlatformWindows = "windows"
+	PlatformMacOS   = "macos"
+	PlatformLinux   = "linux"
+)
+
+// MaxRules is the maximum number of rules of a link
+const MaxRules = 20
+
+// Client holds the attributes of a request rules are matched against
+type Client struct {
+	Platform string // One of the Platform constants, empty if not detected
+	Language string // Most preferred language tag, empty if not set
+	Country  string // Country of the client address, empty if not known
+}
+
+// NewClient returns the Client of a request with the provided User-Agent and Accept-Language
+// headers and the country of its address
+func NewClient(userAgent, acceptLanguage, country string) Client {
+	return Client{
+		Platform: Platform(userAgent),
+		Language: PreferredLanguage(acceptLanguage),
+		Country:  country,
+	}
+}
+
+// Platform returns the platform of the device sending a User-Agent header, empty if unknown.
+// iPads reporting themselves as Macs, as Safari does by default, are detected as macos.
+func Platform(userAgent string) string {
+	switch {
+	case strings.Contains(userAgent, "Windows Phone"):
+		return "" // claims to be both Android and iOS
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"), strings.Contains(userAgent, "iPod"):
+		return PlatformIOS
+	case strings.Contains(userAgent, "Android"):
+		return PlatformAndroid
+	case strings.Contains(userAgent, "Windows"):
+		return PlatformWindows
+	case strings.Contains(userAgent, "Macintosh"):
+		return PlatformMacOS
+	case strings.Contains(userAgent, "Linux"):
+		return PlatformLinux
+	}
+	return ""
+}
+
+// PreferredLanguage returns the language tag with the highest weight of an Accept-Language header,
+// the first one listed among equal weights. The wildcard and malformed weights are ignored.
+func PreferredLanguage(acceptLanguage string) string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var tags []weighted
+	for _, item := range strings.Split(acceptLanguage, ",") {
+		params := strings.Split(item, ";")
+		tag := strings.TrimSpace(params[0])
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				var err error
+				if q, err = strconv.ParseFloat(p[2:], 64); err != nil {
+					q = 0
+				}
+			}
+		}
+		if q > 0 {
+			tags = append(tags, weighted{tag: tag, q: q})
+		}
+	}
+	if len(tags) == 0 {
+		return ""
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].q > tags[j].q
+	})
+	return tags[0].tag
+}
+
+// Match returns true if c satisfies all the conditions of r. A language condition matches its
+// own tag and the more specific ones, e.g. pt matches pt-BR.
+func Match(r storage.Rule, c Client) bool {
+	return matchAny(r.Platforms, func(p string) bool { return p == c.Platform }) &&
+		matchAny(r.Languages, func(l string) bool { return matchLanguage(l, c.Language) }) &&
+		matchAny(r.Countries, func(country string) bool { return country == c.Country })
+}
+
+// Select returns the index of the first of rules matching c, false if none matches
+func Select(rules []storage.Rule, c Client) (int, bool) {
+	for i, r := range rules {
+		if Match(r, c) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// NeedsCountry returns true if any of rules has a country condition, so that the country of the
+// client only needs to be resolved when it is used
+func NeedsCountry(rules []storage.Rule) bool {
+	for _, r := range rules {
+		if len(r.Countries) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize checks the conditions of r, returning it with platforms in lower case and country
+// codes in upper case. The url is not checked.
+func Normalize(r storage.Rule) (storage.Rule, error) {
+	if len(r.Platforms)+len(r.Languages)+len(r.Countries) == 0 {
+		return r, errors.New("rule has no conditions")
+	}
+	n := storage.Rule{URL: r.URL}
+	for _, p := range r.Platforms {
+		p = strings.ToLower(strings.TrimSpace(p))
+		switch p {
+		case PlatformIOS, PlatformAndroid, PlatformWindows, PlatformMacOS, PlatformLinux:
+			n.Platforms = append(n.Platforms, p)
+		default:
+			return r, fmt.Errorf("unknown platform %q", p)
+		}
+	}
+	for _, l := range r.Languages {
+		l = strings.TrimSpace(l)
+		if !validLanguage(l) {
+			return r, fmt.Errorf("malformed language tag %q", l)
+		}
+		n.Languages = append(n.Languages, l)
+	}
+	for _, country := range r.Countries {
+		country = strings.ToUpper(strings.TrimSpace(country))
+		if !geo.ValidCountry(country) {
+			return r, fmt.Errorf("malformed country code %q", country)
+		}
+		n.Countries = append(n.Countries, country)
+	}
+	return n, nil
+}
+
+func matchAny(values []string, match func(string) bool) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchLanguage(condition, tag string) bool {
+	if len(tag) < len(condition) || !strings.EqualFold(tag[:len(condition)], condition) {
+		return false
+	}
+	return len(tag) == len(condition) || tag[len(condition)] == '-'
+}
+
+// validLanguage returns true if tag is made of alphanumeric subtags of 1 to 8 characters separated
+// by dashes, the first one being alphabetic
+func validLanguage(tag string) bool {
+	for i, sub := range strings.Split(tag, "-") {
+		if len(sub) == 0 || len(sub) > 8 {
+			return false
+		}
+		for j := 0; j < len(sub); j++ {
+			c := sub[j] | 0x20 // lower case
+			if !(c >= 'a' && c <= 'z') && !(i > 0 && sub[j] >= '0' && sub[j] <= '9') {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,92 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/giannimassi/shorturl/pkg/storage"
+)
+
+func TestPlatform(t *testing.T) {
+	for userAgent, expected := range map[string]string{
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148":       PlatformIOS,
+		"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 Chrome/120.0 Mobile Safari/537.36":   PlatformAndroid,
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0 Safari/537.36":         PlatformWindows,
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_0) AppleWebKit/605.1.15 Version/17.0 Safari/605.1.15":  PlatformMacOS,
+		"Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0":                          PlatformLinux,
+		"Mozilla/5.0 (Windows Phone 10.0; Android 6.0.1) AppleWebKit/537.36 Mobile Safari/537.36 Edge/15": "",
+		"curl/8.4.0": "",
+	} {
+		if got := Platform(userAgent); got != expected {
+			t.Errorf("%q: got %q want %q", userAgent, got, expected)
+		}
+	}
+}
+
+func TestPreferredLanguage(t *testing.T) {
+	for header, expected := range map[string]string{
+		"it-IT,it;q=0.9,en;q=0.8": "it-IT",
+		"en;q=0.5, fr":            "fr",
+		"de;q=0.7, es;q=0.7":      "de",
+		"*, en;q=0.1":             "en",
+		"en;q=0, *":               "",
+		"":                        "",
+	} {
+		if got := PreferredLanguage(header); got != expected {
+			t.Errorf("%q: got %q want %q", header, got, expected)
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	rules := []storage.Rule{
+		{Platforms: []string{PlatformIOS}, URL: "https://apps.apple.com/app/id1"},
+		{Platforms: []string{PlatformAndroid}, URL: "https://play.google.com/store/apps/details?id=app"},
+		{Languages: []string{"pt"}, Countries: []string{"BR"}, URL: "https://example.org/pt-br"},
+	}
+	tests := []struct {
+		name   string
+		client Client
+		index  int
+		found  bool
+	}{
+		{name: "ios", client: Client{Platform: PlatformIOS, Language: "pt-BR", Country: "BR"}, index: 0, found: true},
+		{name: "android", client: Client{Platform: PlatformAndroid}, index: 1, found: true},
+		{name: "language-and-country", client: Client{Platform: PlatformWindows, Language: "pt-br", Country: "BR"}, index: 2, found: true},
+		{name: "language-prefix-only", client: Client{Language: "ptx", Country: "BR"}},
+		{name: "country-only", client: Client{Language: "en", Country: "BR"}},
+		{name: "unknown", client: Client{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index, found := Select(rules, tt.client)
+			if index != tt.index || found != tt.found {
+				t.Errorf("got %d %v want %d %v", index, found, tt.index, tt.found)
+			}
+		})
+	}
+	if !NeedsCountry(rules) || NeedsCountry(rules[:2]) {
+		t.Error("wrong result of NeedsCountry")
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	r, err := Normalize(storage.Rule{Platforms: []string{" iOS"}, Languages: []string{"zh-Hant-TW"}, Countries: []string{"it"}, URL: "https://example.org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Platforms[0] != PlatformIOS || r.Languages[0] != "zh-Hant-TW" || r.Countries[0] != "IT" {
+		t.Errorf("unexpected rule: %+v", r)
+	}
+
+	for _, invalid := range []storage.Rule{
+		{URL: "https://example.org"},
+		{Platforms: []string{"blackberry"}},
+		{Languages: []string{"en_US"}},
+		{Languages: []string{"1en"}},
+		{Countries: []string{"ITA"}},
+	} {
+		if _, err := Normalize(invalid); err == nil {
+			t.Errorf("expected an error for %+v", invalid)
+		}
+	}
+}
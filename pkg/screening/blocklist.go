@@ -0,0 +1,109 @@
+package screening
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/giannimassi/shorturl/pkg/storage"
+)
+
+// Blocklist is a Screener backed by local lists of domains. A domain matches itself and all of
+// its subdomains; disabled domains take precedence over the ones that only trigger a warning.
+type Blocklist struct {
+	m        sync.RWMutex
+	disabled map[string]struct{}
+	warn     map[string]struct{}
+}
+
+// NewBlocklist returns a Blocklist disabling urls whose host matches any of the disabled domains
+// and flagging with a warning urls whose host matches any of the warn domains
+func NewBlocklist(disabled, warn []string) *Blocklist {
+	b := &Blocklist{
+		disabled: make(map[string]struct{}),
+		warn:     make(map[string]struct{}),
+	}
+	for _, d := range disabled {
+		b.Add(d, storage.FlagDisabled)
+	}
+	for _, d := range warn {
+		b.Add(d, storage.FlagWarn)
+	}
+	return b
+}
+
+// Add adds domain to the list associated with flag. storage.FlagNone removes the domain from the lists.
+func (b *Blocklist) Add(domain string, flag storage.Flag) {
+	domain = normalizeDomain(domain)
+	if domain == "" {
+		return
+	}
+	b.m.Lock()
+	defer b.m.Unlock()
+	delete(b.disabled, domain)
+	delete(b.warn, domain)
+	switch flag {
+	case storage.FlagDisabled:
+		b.disabled[domain] = struct{}{}
+	case storage.FlagWarn:
+		b.warn[domain] = struct{}{}
+	}
+}
+
+// Load reads a domain list from r, with one domain per line, and adds every domain with flag.
+// Empty lines and lines starting with '#' are ignored; hosts-file style lines such as
+// "0.0.0.0 example.org" are also accepted.
+func (b *Blocklist) Load(r io.Reader, flag storage.Flag) error {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		b.Add(fields[len(fields)-1], flag)
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("reading domain list: %w", err)
+	}
+	return nil
+}
+
+// Screen implements Screener
+func (b *Blocklist) Screen(_ context.Context, u *url.URL) (Result, error) {
+	b.m.RLock()
+	defer b.m.RUnlock()
+	for _, domain := range parentDomains(normalizeDomain(u.Hostname())) {
+		if _, found := b.disabled[domain]; found {
+			return Result{Flag: storage.FlagDisabled, Reason: fmt.Sprintf("domain %s is blocklisted", domain)}, nil
+		}
+	}
+	for _, domain := range parentDomains(normalizeDomain(u.Hostname())) {
+		if _, found := b.warn[domain]; found {
+			return Result{Flag: storage.FlagWarn, Reason: fmt.Sprintf("domain %s is reported as suspicious", domain)}, nil
+		}
+	}
+	return Result{}, nil
+}
+
+func normalizeDomain(domain string) string {
+	return strings.Trim(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
+
+// parentDomains returns host and all of its parent domains, e.g. a.b.c, b.c, c
+func parentDomains(host string) []string {
+	var domains []string
+	for host != "" {
+		domains = append(domains, host)
+		i := strings.IndexByte(host, '.')
+		if i < 0 {
+			break
+		}
+		host = host[i+1:]
+	}
+	return domains
+}
@@ -0,0 +1,92 @@
+package screening
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/giannimassi/shorturl/pkg/storage"
+)
+
+// Store is the subset of the short url storage needed to re-check stored links
+type Store interface {
+	Keys(ctx context.Context) ([]string, error)
+	ShortURLInfo(ctx context.Context, key string) (*url.URL, int, error)
+	Metadata(ctx context.Context, key string) (storage.Metadata, error)
+	SetMetadata(ctx context.Context, key string, md storage.Metadata) error
+}
+
+// Rechecker periodically screens all stored links and the alternative urls they redirect to,
+// updating their flag when the verdict changes
+type Rechecker struct {
+	store    Store
+	screener Screener
+}
+
+// NewRechecker returns a Rechecker screening the links in store with screener
+func NewRechecker(store Store, screener Screener) *Rechecker {
+	return &Rechecker{store: store, screener: screener}
+}
+
+// Run re-checks all links every interval until ctx is done
+func (r *Rechecker) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			_, _ = r.RecheckAll(ctx)
+		}
+	}
+}
+
+// RecheckAll screens all links once, returning the number of links whose flag changed
+func (r *Rechecker) RecheckAll(ctx context.Context) (int, error) {
+	keys, err := r.store.Keys(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("listing keys: %w", err)
+	}
+
+	var changed int
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return changed, err
+		}
+		updated, err := r.recheck(ctx, key)
+		if errors.Is(err, storage.ErrKeyNotFound) {
+			// deleted in the meantime
+			continue
+		} else if err != nil {
+			return changed, fmt.Errorf("re-checking key %s: %w", key, err)
+		}
+		if updated {
+			changed++
+		}
+	}
+	return changed, nil
+}
+
+// recheck screens all the targets of the link for key, as done when it was added
+func (r *Rechecker) recheck(ctx context.Context, key string) (bool, error) {
+	u, _, err := r.store.ShortURLInfo(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	md, err := r.store.Metadata(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	res, _, err := ScreenLink(ctx, r.screener, u, md)
+	if err != nil {
+		return false, err
+	}
+	if md.Flag == res.Flag && md.FlagReason == res.Reason {
+		return false, nil
+	}
+	md.Flag, md.FlagReason = res.Flag, res.Reason
+	return true, r.store.SetMetadata(ctx, key, md)
+}
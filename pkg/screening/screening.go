@@ -0,0 +1,49 @@
+// Package screening checks destination urls against lists of known malicious or suspicious sites
+package screening
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/giannimassi/shorturl/pkg/storage"
+)
+
+// Result is the outcome of screening a url
+type Result struct {
+	Flag   storage.Flag // storage.FlagNone if the url is considered safe
+	Reason string       // Why the url has been flagged
+}
+
+// Screener checks whether a url is safe to redirect to
+type Screener interface {
+	Screen(ctx context.Context, u *url.URL) (Result, error)
+}
+
+// ScreenerFunc allows to use a function as a Screener, e.g. to hook an external reputation service
+type ScreenerFunc func(ctx context.Context, u *url.URL) (Result, error)
+
+// Screen calls f(ctx, u)
+func (f ScreenerFunc) Screen(ctx context.Context, u *url.URL) (Result, error) {
+	return f(ctx, u)
+}
+
+// Chain returns a Screener that runs all screeners in order and returns the most severe result.
+// Screening stops as soon as a url is disabled or an error is returned.
+func Chain(screeners ...Screener) Screener {
+	return ScreenerFunc(func(ctx context.Context, u *url.URL) (Result, error) {
+		var worst Result
+		for _, s := range screeners {
+			res, err := s.Screen(ctx, u)
+			if err != nil {
+				return Result{}, err
+			}
+			if res.Flag > worst.Flag {
+				worst = res
+			}
+			if worst.Flag == storage.FlagDisabled {
+				break
+			}
+		}
+		return worst, nil
+	})
+}
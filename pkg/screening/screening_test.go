@@ -0,0 +1,187 @@
+package screening
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/giannimassi/shorturl/pkg/storage"
+)
+
+func TestBlocklist_Screen(t *testing.T) {
+	b := NewBlocklist([]string{"evil.com"}, []string{"Sketchy.org."})
+	list := "# comment\n\n0.0.0.0 phish.net\nbad.io\n"
+	if err := b.Load(strings.NewReader(list), storage.FlagDisabled); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url      string
+		expected storage.Flag
+	}{
+		{url: "https://example.org/", expected: storage.FlagNone},
+		{url: "https://evil.com/login", expected: storage.FlagDisabled},
+		{url: "https://www.EVIL.com/login", expected: storage.FlagDisabled},
+		{url: "https://notevil.com/", expected: storage.FlagNone},
+		{url: "https://a.sketchy.org/", expected: storage.FlagWarn},
+		{url: "https://phish.net/", expected: storage.FlagDisabled},
+		{url: "https://x.bad.io:8080/", expected: storage.FlagDisabled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			res, err := b.Screen(context.Background(), mustParse(tt.url))
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if res.Flag != tt.expected {
+				t.Errorf("unexpected flag: got %v, want %v", res.Flag, tt.expected)
+			}
+			if res.Flag != storage.FlagNone && res.Reason == "" {
+				t.Errorf("missing reason for flagged url")
+			}
+		})
+	}
+
+	b.Add("evil.com", storage.FlagNone)
+	if res, _ := b.Screen(context.Background(), mustParse("https://evil.com")); res.Flag != storage.FlagNone {
+		t.Errorf("unexpected flag after removal: %v", res.Flag)
+	}
+}
+
+func TestChain(t *testing.T) {
+	warn := NewBlocklist(nil, []string{"example.org"})
+	calls := 0
+	external := ScreenerFunc(func(ctx context.Context, u *url.URL) (Result, error) {
+		calls++
+		if u.Hostname() == "down.example.org" {
+			return Result{}, errors.New("reputation service unavailable")
+		}
+		if u.Path == "/phish" {
+			return Result{Flag: storage.FlagDisabled, Reason: "phishing"}, nil
+		}
+		return Result{}, nil
+	})
+	s := Chain(warn, external)
+
+	res, err := s.Screen(context.Background(), mustParse("https://example.org/phish"))
+	if err != nil || res.Flag != storage.FlagDisabled || res.Reason != "phishing" {
+		t.Errorf("unexpected result: %+v (%v)", res, err)
+	}
+	res, err = s.Screen(context.Background(), mustParse("https://example.org/"))
+	if err != nil || res.Flag != storage.FlagWarn {
+		t.Errorf("unexpected result: %+v (%v)", res, err)
+	}
+	if _, err := s.Screen(context.Background(), mustParse("https://down.example.org/")); err == nil {
+		t.Errorf("expected error")
+	}
+	if calls != 3 {
+		t.Errorf("unexpected calls to external screener: got %d, want 3", calls)
+	}
+}
+
+func TestRechecker_RecheckAll(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	for key, u := range map[string]string{
+		"a": "https://example.org",
+		"b": "https://evil.com/x",
+		"c": "https://sketchy.org",
+	} {
+		if err := store.AddURL(ctx, key, *mustParse(u), storage.Metadata{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := NewBlocklist([]string{"evil.com"}, []string{"sketchy.org"})
+	r := NewRechecker(store, b)
+	changed, err := r.RecheckAll(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if changed != 2 {
+		t.Errorf("unexpected changed links: got %d, want 2", changed)
+	}
+	for key, expected := range map[string]storage.Flag{"a": storage.FlagNone, "b": storage.FlagDisabled, "c": storage.FlagWarn} {
+		if md, _ := store.Metadata(ctx, key); md.Flag != expected {
+			t.Errorf("unexpected flag for %s: got %v, want %v", key, md.Flag, expected)
+		}
+	}
+
+	b.Add("sketchy.org", storage.FlagNone)
+	if changed, err := r.RecheckAll(context.Background()); err != nil || changed != 1 {
+		t.Errorf("unexpected recheck result: %d (%v)", changed, err)
+	}
+	if md, _ := store.Metadata(ctx, "c"); md.Flag != storage.FlagNone || md.FlagReason != "" {
+		t.Errorf("flag not cleared: %+v", md)
+	}
+}
+
+func TestRechecker_RecheckAll_targets(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	links := map[string]storage.Metadata{
+		"split": {Variants: []storage.Variant{{URL: "https://example.org", Weight: 1}, {URL: "https://later-evil.com/b", Weight: 1}}},
+		"rules": {Rules: []storage.Rule{{Platforms: []string{"ios"}, URL: "https://sketchy.org/app"}}},
+		"soon":  {ComingSoonURL: "https://later-evil.com/soon"},
+	}
+	for key, md := range links {
+		if err := store.AddURL(ctx, key, *mustParse("https://example.org"), md); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := NewBlocklist(nil, []string{"sketchy.org"})
+	r := NewRechecker(store, b)
+	if changed, err := r.RecheckAll(ctx); err != nil || changed != 1 {
+		t.Errorf("unexpected recheck result: %d (%v)", changed, err)
+	}
+	b.Add("later-evil.com", storage.FlagDisabled)
+	if changed, err := r.RecheckAll(ctx); err != nil || changed != 2 {
+		t.Errorf("unexpected recheck result: %d (%v)", changed, err)
+	}
+	// flags are not changed again by a recheck with the same blocklist
+	if changed, err := r.RecheckAll(ctx); err != nil || changed != 0 {
+		t.Errorf("unexpected second recheck result: %d (%v)", changed, err)
+	}
+	expected := map[string]struct {
+		flag   storage.Flag
+		prefix string
+	}{
+		"split": {storage.FlagDisabled, "Variants[1].URL: "},
+		"rules": {storage.FlagWarn, "Rules[0].URL: "},
+		"soon":  {storage.FlagDisabled, "ComingSoonURL: "},
+	}
+	for key, e := range expected {
+		if md, _ := store.Metadata(ctx, key); md.Flag != e.flag || !strings.HasPrefix(md.FlagReason, e.prefix) {
+			t.Errorf("unexpected flag for %s: got %v (%q), want %v (%q...)", key, md.Flag, md.FlagReason, e.flag, e.prefix)
+		}
+	}
+}
+
+func TestTargets(t *testing.T) {
+	md := storage.Metadata{
+		Rules:         []storage.Rule{{URL: "https://a.example"}},
+		Variants:      []storage.Variant{{URL: "https://example.org"}, {URL: "https://b.example"}},
+		ComingSoonURL: "https://c.example",
+	}
+	expected := []Target{
+		{Field: "URL", URL: "https://example.org"},
+		{Field: "Rules[0].URL", URL: "https://a.example"},
+		{Field: "Variants[1].URL", URL: "https://b.example"},
+		{Field: "ComingSoonURL", URL: "https://c.example"},
+	}
+	if got := Targets(mustParse("https://example.org"), md); !reflect.DeepEqual(got, expected) {
+		t.Errorf("unexpected targets: got %+v want %+v", got, expected)
+	}
+}
+
+func mustParse(str string) *url.URL {
+	u, err := url.Parse(str)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
@@ -0,0 +1,61 @@
+package screening
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/giannimassi/shorturl/pkg/storage"
+	"github.com/giannimassi/shorturl/pkg/validation"
+)
+
+// Target is one of the urls a link can redirect to
+type Target struct {
+	Field string // Name of the payload field holding the url, e.g. URL or Rules[0].URL
+	URL   string
+}
+
+// Targets returns the urls a link redirecting to u with metadata md can redirect to: u, the urls of
+// its rules, those of its variants other than the first one, which is u, and its coming soon redirect
+func Targets(u *url.URL, md storage.Metadata) []Target {
+	targets := []Target{{Field: validation.URLField, URL: u.String()}}
+	for i, r := range md.Rules {
+		targets = append(targets, Target{Field: fmt.Sprintf("Rules[%d].%s", i, validation.URLField), URL: r.URL})
+	}
+	for i := 1; i < len(md.Variants); i++ {
+		targets = append(targets, Target{Field: fmt.Sprintf("Variants[%d].%s", i, validation.URLField), URL: md.Variants[i].URL})
+	}
+	if md.ComingSoonURL != "" {
+		targets = append(targets, Target{Field: "ComingSoonURL", URL: md.ComingSoonURL})
+	}
+	return targets
+}
+
+// ScreenLink screens all the targets of a link, returning the most severe result along with the
+// field of the target it was found for. The reasons of the results of targets other than u are
+// prefixed with their field. Screening stops as soon as a target is disabled.
+func ScreenLink(ctx context.Context, s Screener, u *url.URL, md storage.Metadata) (Result, string, error) {
+	var worst Result
+	var field string
+	for _, t := range Targets(u, md) {
+		tu, err := url.Parse(t.URL)
+		if err != nil {
+			return Result{}, "", fmt.Errorf("parsing %s: %w", t.Field, err)
+		}
+		res, err := s.Screen(ctx, tu)
+		if err != nil {
+			return Result{}, "", err
+		}
+		if res.Flag <= worst.Flag {
+			continue
+		}
+		if t.Field != validation.URLField {
+			res.Reason = t.Field + ": " + res.Reason
+		}
+		worst, field = res, t.Field
+		if worst.Flag == storage.FlagDisabled {
+			break
+		}
+	}
+	return worst, field, nil
+}
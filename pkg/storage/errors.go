@@ -7,4 +7,7 @@ var (
 	ErrKeyNotFound = errors.New(`key not found`)
 	// ErrKeyAlreadyExists is returned when an operation would overwrite an exising key in the store
 	ErrKeyAlreadyExists = errors.New(`key already exists`)
+	// ErrNotSupported is returned by decorators when the decorated provider does not implement an
+	// optional interface
+	ErrNotSupported = errors.New(`operation not supported by the storage`)
 )
@@ -0,0 +1,106 @@
+package storage
+
+import "context"
+
+// Forwarder implements the optional interfaces of providers for the decorators of Next, which
+// embed it so that they do not have to forward each of them. Calls are forwarded to Next if it
+// implements the interface, wrapped by Wrap if set: decorators use it to add their behavior, e.g. a
+// timeout, to the optional operations too.
+//
+// Since decorators always have the methods of the optional interfaces, HitCounterOf and HitQueueOf
+// should be used instead of type assertions to find out whether the decorated provider supports them.
+type Forwarder struct {
+	Next Provider
+	Wrap func(ctx context.Context, method, key string, call func(ctx context.Context) error) error
+}
+
+func (f Forwarder) do(ctx context.Context, method, key string, call func(ctx context.Context) error) error {
+	if f.Wrap == nil {
+		return call(ctx)
+	}
+	return f.Wrap(ctx, method, key, call)
+}
+
+// Ping forwards the call to Next if it implements Pinger
+func (f Forwarder) Ping(ctx context.Context) error {
+	pinger, ok := f.Next.(Pinger)
+	if !ok {
+		return nil
+	}
+	return f.do(ctx, "Ping", "", pinger.Ping)
+}
+
+// AddVariantHit forwards the call to Next if it implements VariantCounter
+func (f Forwarder) AddVariantHit(ctx context.Context, key string, i int) error {
+	counter, ok := f.Next.(VariantCounter)
+	if !ok {
+		return nil
+	}
+	return f.do(ctx, "AddVariantHit", key, func(ctx context.Context) error {
+		return counter.AddVariantHit(ctx, key, i)
+	})
+}
+
+// VariantHits forwards the call to Next if it implements VariantCounter
+func (f Forwarder) VariantHits(ctx context.Context, key string) ([]int, error) {
+	counter, ok := f.Next.(VariantCounter)
+	if !ok {
+		return nil, nil
+	}
+	var hits []int
+	err := f.do(ctx, "VariantHits", key, func(ctx context.Context) error {
+		var err error
+		hits, err = counter.VariantHits(ctx, key)
+		return err
+	})
+	return hits, err
+}
+
+// AddHits forwards the call to Next if it supports HitCounter, returning ErrNotSupported otherwise
+func (f Forwarder) AddHits(ctx context.Context, key string, n int) error {
+	counter := HitCounterOf(f.Next)
+	if counter == nil {
+		return ErrNotSupported
+	}
+	return f.do(ctx, "AddHits", key, func(ctx context.Context) error {
+		return counter.AddHits(ctx, key, n)
+	})
+}
+
+// CountsHits returns true if Next supports HitCounter
+func (f Forwarder) CountsHits() bool {
+	return HitCounterOf(f.Next) != nil
+}
+
+// PendingHits forwards the call to Next if it supports HitQueue, returning zero otherwise
+func (f Forwarder) PendingHits() int {
+	if q := HitQueueOf(f.Next); q != nil {
+		return q.PendingHits()
+	}
+	return 0
+}
+
+// QueuesHits returns true if Next supports HitQueue
+func (f Forwarder) QueuesHits() bool {
+	return HitQueueOf(f.Next) != nil
+}
+
+// HitCounterOf returns p as a HitCounter if it supports counting hits, also through decorators
+// embedding a Forwarder, and nil otherwise
+func HitCounterOf(p Provider) HitCounter {
+	if d, ok := p.(interface{ CountsHits() bool }); ok && !d.CountsHits() {
+		return nil
+	}
+	counter, _ := p.(HitCounter)
+	return counter
+}
+
+// HitQueueOf returns p as a HitQueue if it aggregates hits asynchronously, also behind decorators
+// embedding a Forwarder, and nil otherwise
+func HitQueueOf(p Provider) HitQueue {
+	if d, ok := p.(interface{ QueuesHits() bool }); ok && !d.QueuesHits() {
+		return nil
+	}
+	q, _ := p.(HitQueue)
+	return q
+}
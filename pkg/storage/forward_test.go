@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// recordingProvider is a decorator embedding a Forwarder that records the wrapped methods
+type recordingProvider struct {
+	Forwarder
+	Provider
+	methods []string
+}
+
+func newRecordingProvider(next Provider) *recordingProvider {
+	p := &recordingProvider{Provider: next}
+	p.Forwarder = Forwarder{Next: next, Wrap: func(ctx context.Context, method, _ string, call func(context.Context) error) error {
+		p.methods = append(p.methods, method)
+		return call(ctx)
+	}}
+	return p
+}
+
+// queueStore is a MemoryStore aggregating hits asynchronously
+type queueStore struct {
+	*MemoryStore
+}
+
+func (s queueStore) PendingHits() int { return 3 }
+
+func TestForwarder(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	if err := store.AddURL(ctx, "a", mustMkURL("http://url1.com"), Metadata{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// optional interfaces are forwarded through several decorators
+	outer := newRecordingProvider(newRecordingProvider(store))
+	counter := HitCounterOf(outer)
+	if counter == nil {
+		t.Fatal("decorators of a HitCounter should support counting hits")
+	}
+	if err := counter.AddHits(ctx, "a", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := outer.AddVariantHit(ctx, "a", 1); err != nil {
+		t.Fatal(err)
+	}
+	if hits, err := outer.VariantHits(ctx, "a"); err != nil || !reflect.DeepEqual(hits, []int{0, 1}) {
+		t.Errorf("unexpected variant hits: %v %v", hits, err)
+	}
+	if _, hits, _ := store.ShortURLInfo(ctx, "a"); hits != 2 {
+		t.Errorf("unexpected hits: %d", hits)
+	}
+	if expected := []string{"AddHits", "AddVariantHit", "VariantHits"}; !reflect.DeepEqual(outer.methods, expected) {
+		t.Errorf("unexpected wrapped methods: %v, want %v", outer.methods, expected)
+	}
+	if HitQueueOf(outer) != nil {
+		t.Error("decorators of a MemoryStore should not queue hits")
+	}
+	if q := HitQueueOf(newRecordingProvider(queueStore{store})); q == nil || q.PendingHits() != 3 {
+		t.Error("decorators of a HitQueue should forward the pending hits")
+	}
+
+	// providers without the optional interfaces
+	bare := newRecordingProvider(struct{ Provider }{store})
+	if HitCounterOf(bare) != nil {
+		t.Error("decorators of a provider not counting hits should not support counting hits")
+	}
+	if err := bare.AddHits(ctx, "a", 1); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+	if err := bare.Ping(ctx); err != nil {
+		t.Errorf("unexpected ping error: %v", err)
+	}
+	if hits, err := bare.VariantHits(ctx, "a"); err != nil || hits != nil {
+		t.Errorf("unexpected variant hits: %v %v", hits, err)
+	}
+	if len(bare.methods) != 0 {
+		t.Errorf("unsupported operations should not be wrapped: %v", bare.methods)
+	}
+}
@@ -1,19 +1,25 @@
 package storage
 
 import (
+	"context"
+	"fmt"
 	"net/url"
+	"sort"
 	"sync"
 )
 
-// MemoryStore is a simple mock providing a memory-based storage of key-url associations
+// MemoryStore is a simple mock providing a memory-based storage of key-url associations.
+// Its operations complete immediately and ignore the context.
 type MemoryStore struct {
 	m    sync.RWMutex
 	urls map[string]urlData
 }
 
 type urlData struct {
-	url  url.URL
-	hits int
+	url         url.URL
+	hits        int
+	variantHits []int
+	md          Metadata
 }
 
 // NewMemoryStore returns a new copy of MemoryStore
@@ -24,7 +30,7 @@ func NewMemoryStore() *MemoryStore {
 }
 
 // ShortURL returns a url and true if the key matches an entry, nil and false if otherwise
-func (s *MemoryStore) ShortURL(key string) (*url.URL, error) {
+func (s *MemoryStore) ShortURL(ctx context.Context, key string) (*url.URL, error) {
 	s.m.Lock()
 	defer s.m.Unlock()
 	u, found := s.urls[key]
@@ -36,20 +42,63 @@ func (s *MemoryStore) ShortURL(key string) (*url.URL, error) {
 	return &u.url, nil
 }
 
-// AddURL adds a key-url association
-func (s *MemoryStore) AddURL(key string, u url.URL) error {
+// AddHits adds n hits to the provided key
+func (s *MemoryStore) AddHits(ctx context.Context, key string, n int) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	u, found := s.urls[key]
+	if !found {
+		return ErrKeyNotFound
+	}
+	u.hits += n
+	s.urls[key] = u
+	return nil
+}
+
+// AddVariantHit counts a hit of the variant at index i of the link for the provided key
+func (s *MemoryStore) AddVariantHit(ctx context.Context, key string, i int) error {
+	if i < 0 {
+		return fmt.Errorf("invalid variant index %d", i)
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	u, found := s.urls[key]
+	if !found {
+		return ErrKeyNotFound
+	}
+	for len(u.variantHits) <= i {
+		u.variantHits = append(u.variantHits, 0)
+	}
+	u.variantHits[i]++
+	s.urls[key] = u
+	return nil
+}
+
+// VariantHits returns the hits counted for each variant of the provided key
+func (s *MemoryStore) VariantHits(ctx context.Context, key string) ([]int, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	u, found := s.urls[key]
+	if !found {
+		return nil, ErrKeyNotFound
+	}
+	return append([]int(nil), u.variantHits...), nil
+}
+
+// AddURL adds a key-url association along with its metadata
+func (s *MemoryStore) AddURL(ctx context.Context, key string, u url.URL, md Metadata) error {
 	s.m.Lock()
 	defer s.m.Unlock()
 	if _, found := s.urls[key]; found {
 		return ErrKeyAlreadyExists
 	}
 
-	s.urls[key] = urlData{url: u}
+	s.urls[key] = urlData{url: u, md: md}
 	return nil
 }
 
 // DeleteURL allows to remove a key-url association for the specified key
-func (s *MemoryStore) DeleteURL(key string) error {
+func (s *MemoryStore) DeleteURL(ctx context.Context, key string) error {
 	s.m.Lock()
 	defer s.m.Unlock()
 	if _, found := s.urls[key]; !found {
@@ -60,7 +109,7 @@ func (s *MemoryStore) DeleteURL(key string) error {
 }
 
 // ShortURLInfo returns true and the number of hits if a short url is found for the provided key, false otherwise
-func (s *MemoryStore) ShortURLInfo(key string) (*url.URL, int, error) {
+func (s *MemoryStore) ShortURLInfo(ctx context.Context, key string) (*url.URL, int, error) {
 	s.m.RLock()
 	defer s.m.RUnlock()
 	u, found := s.urls[key]
@@ -69,3 +118,39 @@ func (s *MemoryStore) ShortURLInfo(key string) (*url.URL, int, error) {
 	}
 	return &u.url, u.hits, nil
 }
+
+// Metadata returns the metadata stored for the provided key
+func (s *MemoryStore) Metadata(ctx context.Context, key string) (Metadata, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	u, found := s.urls[key]
+	if !found {
+		return Metadata{}, ErrKeyNotFound
+	}
+	return u.md, nil
+}
+
+// SetMetadata replaces the metadata stored for the provided key
+func (s *MemoryStore) SetMetadata(ctx context.Context, key string, md Metadata) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	u, found := s.urls[key]
+	if !found {
+		return ErrKeyNotFound
+	}
+	u.md = md
+	s.urls[key] = u
+	return nil
+}
+
+// Keys returns all the keys in the store in lexicographical order
+func (s *MemoryStore) Keys(ctx context.Context) ([]string, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	keys := make([]string, 0, len(s.urls))
+	for key := range s.urls {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
@@ -1,12 +1,15 @@
 package storage
 
 import (
+	"context"
 	"errors"
 	"net/url"
+	"reflect"
 	"testing"
 )
 
 func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
 	m := NewMemoryStore()
 	assertLen := func(expected int) {
 		t.Helper()
@@ -33,13 +36,13 @@ func TestMemoryStore(t *testing.T) {
 
 	assertURLForKey := func(key, expected string) {
 		t.Helper()
-		u, err := m.ShortURL(key)
+		u, err := m.ShortURL(ctx, key)
 		cmpURL(u, err, expected, nil)
 	}
 
 	assertInfoForKey := func(key, expectedURL string, expectedHits int, expectedErr error) {
 		t.Helper()
-		u, hits, err := m.ShortURLInfo(key)
+		u, hits, err := m.ShortURLInfo(ctx, key)
 		cmpURL(u, err, expectedURL, expectedErr)
 		if hits != expectedHits {
 			t.Errorf("unexpected hits: got %d, want %d", hits, expectedHits)
@@ -47,7 +50,7 @@ func TestMemoryStore(t *testing.T) {
 	}
 
 	assertLen(0)
-	u, err := m.ShortURL("")
+	u, err := m.ShortURL(ctx, "")
 	if !errors.Is(err, ErrKeyNotFound) || u != nil {
 		t.Errorf("unexpected short url in memory store: %s", u.String())
 	}
@@ -57,26 +60,26 @@ func TestMemoryStore(t *testing.T) {
 		url2 = "http://url2.com"
 	)
 
-	m.AddURL("a", mustMkURL(url1))
+	m.AddURL(ctx, "a", mustMkURL(url1), Metadata{})
 	assertLen(1)
 	assertURLForKey("a", url1)
 	assertInfoForKey("a", url1, 1, nil)
 
-	m.AddURL("b", mustMkURL(url1))
+	m.AddURL(ctx, "b", mustMkURL(url1), Metadata{})
 	assertLen(2)
 	assertURLForKey("a", url1)
 	assertURLForKey("b", url1)
 	assertInfoForKey("a", url1, 2, nil)
 	assertInfoForKey("b", url1, 1, nil)
 
-	m.AddURL("b", mustMkURL(url2))
+	m.AddURL(ctx, "b", mustMkURL(url2), Metadata{})
 	assertLen(2)
 	assertURLForKey("a", url1)
 	assertURLForKey("b", url1)
 	assertInfoForKey("a", url1, 3, nil)
 	assertInfoForKey("b", url1, 2, nil)
 
-	m.AddURL("c", mustMkURL(url2))
+	m.AddURL(ctx, "c", mustMkURL(url2), Metadata{})
 	assertLen(3)
 	assertURLForKey("a", url1)
 	assertURLForKey("b", url1)
@@ -85,27 +88,119 @@ func TestMemoryStore(t *testing.T) {
 	assertInfoForKey("b", url1, 3, nil)
 	assertInfoForKey("c", url2, 1, nil)
 
-	if err := m.DeleteURL("a"); err != nil {
+	if err := m.DeleteURL(ctx, "a"); err != nil {
 		t.Errorf("unexpected err: %v", err)
 	}
 	assertLen(2)
 	assertInfoForKey("a", "", 0, ErrKeyNotFound)
 
-	if err := m.DeleteURL("b"); err != nil {
+	if err := m.DeleteURL(ctx, "b"); err != nil {
 		t.Errorf("unexpected err: %v", err)
 	}
 	assertLen(1)
 
-	if err := m.DeleteURL("c"); err != nil {
+	if err := m.DeleteURL(ctx, "c"); err != nil {
 		t.Errorf("unexpected err: %v", err)
 	}
 	assertLen(0)
 
-	if err := m.DeleteURL("a"); !errors.Is(err, ErrKeyNotFound) {
+	if err := m.DeleteURL(ctx, "a"); !errors.Is(err, ErrKeyNotFound) {
 		t.Errorf("unexpected err: %v", err)
 	}
 }
 
+func TestMemoryStore_Metadata(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryStore()
+	if _, err := m.Metadata(ctx, "a"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("unexpected err: %v", err)
+	}
+	if err := m.SetMetadata(ctx, "a", Metadata{}); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("unexpected err: %v", err)
+	}
+
+	md := Metadata{Flag: FlagWarn, FlagReason: "suspicious"}
+	if err := m.AddURL(ctx, "b", mustMkURL("http://url1.com"), md); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := m.AddURL(ctx, "a", mustMkURL("http://url2.com"), Metadata{}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if got, err := m.Metadata(ctx, "b"); err != nil || !reflect.DeepEqual(got, md) {
+		t.Errorf("unexpected metadata: got %+v (%v), want %+v", got, err, md)
+	}
+
+	md.Flag = FlagDisabled
+	if err := m.SetMetadata(ctx, "b", md); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if got, err := m.Metadata(ctx, "b"); err != nil || !reflect.DeepEqual(got, md) {
+		t.Errorf("unexpected metadata: got %+v (%v), want %+v", got, err, md)
+	}
+
+	keys, err := m.Keys(ctx)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(keys) != 2 || keys[0] != "a" || keys[1] != "b" {
+		t.Errorf("unexpected keys: %v", keys)
+	}
+}
+
+func TestMemoryStore_variantHits(t *testing.T) {
+	testVariantHits(t, NewMemoryStore())
+}
+
+// testVariantHits checks the implementation of VariantCounter of an empty provider
+func testVariantHits(t *testing.T, s interface {
+	Provider
+	VariantCounter
+}) {
+	t.Helper()
+	ctx := context.Background()
+	md := Metadata{Variants: []Variant{{URL: "http://url1.com", Weight: 1}, {URL: "http://url2.com", Weight: 1}}}
+	if err := s.AddURL(ctx, "a", mustMkURL("http://url1.com"), md); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := s.AddURL(ctx, "b", mustMkURL("http://url1.com"), Metadata{}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	for _, i := range []int{1, 1, 0} {
+		if err := s.AddVariantHit(ctx, "a", i); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+	if err := s.AddVariantHit(ctx, "b", 2); err != nil {
+		t.Fatalf("counters should be created on demand: %v", err)
+	}
+	if err := s.AddVariantHit(ctx, "missing", 0); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("unexpected err: %v", err)
+	}
+	if err := s.AddVariantHit(ctx, "a", -1); err == nil {
+		t.Error("expected an error for a negative index")
+	}
+
+	if hits, err := s.VariantHits(ctx, "a"); err != nil || !reflect.DeepEqual(hits, []int{1, 2}) {
+		t.Errorf("unexpected variant hits: %v, %v", hits, err)
+	}
+	if hits, err := s.VariantHits(ctx, "b"); err != nil || !reflect.DeepEqual(hits, []int{0, 0, 1}) {
+		t.Errorf("unexpected variant hits: %v, %v", hits, err)
+	}
+	if _, err := s.VariantHits(ctx, "missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("unexpected err: %v", err)
+	}
+
+	if err := s.DeleteURL(ctx, "a"); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := s.AddURL(ctx, "a", mustMkURL("http://url1.com"), md); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if hits, err := s.VariantHits(ctx, "a"); err != nil || (len(hits) != 0 && !reflect.DeepEqual(hits, []int{0, 0})) {
+		t.Errorf("variant hits should be reset: %v, %v", hits, err)
+	}
+}
+
 func mustMkURL(str string) url.URL {
 	u, err := url.Parse(str)
 	if err != nil {
@@ -0,0 +1,99 @@
+package storage
+
+import "time"
+
+// Flag marks links that should not be followed without warning the user
+type Flag int
+
+const (
+	// FlagNone marks links that can be followed
+	FlagNone Flag = iota
+	// FlagWarn marks links for which a warning is shown before following them
+	FlagWarn
+	// FlagDisabled marks links that cannot be followed
+	FlagDisabled
+)
+
+// QueryPrecedence selects the value kept when the query of a request and the one of the url of a
+// passthrough link have the same parameter
+type QueryPrecedence string
+
+const (
+	// PrecedenceRequest keeps the values of the request
+	PrecedenceRequest QueryPrecedence = "request"
+	// PrecedenceTarget keeps the values of the url of the link
+	PrecedenceTarget QueryPrecedence = "target"
+	// PrecedenceBoth keeps the values of the url of the link followed by the ones of the request
+	PrecedenceBoth QueryPrecedence = "both"
+)
+
+// Campaign holds the UTM parameters identifying the marketing campaign a link belongs to
+type Campaign struct {
+	Source  string // utm_source, e.g. newsletter
+	Medium  string // utm_medium, e.g. email
+	Name    string // utm_campaign, e.g. spring_sale
+	Term    string // utm_term, the paid keywords
+	Content string // utm_content, to tell apart links to the same url
+}
+
+// IsZero returns true if no parameter is set
+func (c Campaign) IsZero() bool {
+	return c == Campaign{}
+}
+
+// Rule sends the requests matching all of its conditions to an alternative url. Each condition
+// is satisfied if its list is empty or contains the value of the request.
+type Rule struct {
+	Platforms []string // Platforms detected from the User-Agent header, e.g. ios or android
+	Languages []string // Language tags of the Accept-Language header, e.g. it or pt-BR
+	Countries []string // ISO 3166-1 alpha-2 codes of the country of the client address
+	URL       string   // URL to redirect to
+}
+
+// Variant is one of the urls requests of a split link are distributed across
+type Variant struct {
+	URL    string // URL to redirect to
+	Weight int    // Share of the requests sent to the variant, relative to the sum of all weights
+}
+
+// Metadata holds the optional attributes stored alongside a key-url association
+type Metadata struct {
+	CreatedAt       time.Time       // When the link has been created
+	Title           string          // Optional human-readable title of the link
+	Interstitial    bool            // Whether a preview page is always shown before redirecting
+	Flag            Flag            // Whether the link has been flagged as unsafe
+	FlagReason      string          // Why the link has been flagged
+	Owner           string          // API key of the client that created the link, empty if anonymous
+	Passthrough     bool            // Whether the path after the key and the query of requests are forwarded to the url
+	QueryPrecedence QueryPrecedence // Values kept for parameters in both queries, PrecedenceRequest if empty
+	Template        string          // URL template expanded with the path segments after the key, empty for plain links
+	Campaign        Campaign        // Campaign whose parameters have been added to the url
+	Rules           []Rule          // Rules evaluated in order before redirecting, the first match replacing the url
+	Variants        []Variant       // Urls requests are distributed across by weight, the first one being the url
+	Sticky          bool            // If true clients keep being redirected to the first variant assigned to them
+	PasswordHash    string          // Hash of the password required to follow the link, empty if not protected
+	NotBefore       time.Time       // When the link starts redirecting, zero if it is active since its creation
+	NotAfter        time.Time       // When the link stops redirecting, zero if it never does
+	ComingSoonURL   string          // URL requests are redirected to before NotBefore, empty to show a page
+}
+
+// State describes whether a link redirects according to its activation window
+type State string
+
+// States of a link
+const (
+	StateScheduled State = "scheduled" // Before NotBefore
+	StateActive    State = "active"    // Within the window
+	StateEnded     State = "ended"     // From NotAfter on
+)
+
+// State returns the state of the link at time now
+func (md Metadata) State(now time.Time) State {
+	switch {
+	case !md.NotBefore.IsZero() && now.Before(md.NotBefore):
+		return StateScheduled
+	case !md.NotAfter.IsZero() && !now.Before(md.NotAfter):
+		return StateEnded
+	}
+	return StateActive
+}
@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMetadata_State(t *testing.T) {
+	start := time.Date(2020, 6, 1, 9, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	tests := []struct {
+		name string
+		md   Metadata
+		now  time.Time
+		want State
+	}{
+		{"no window", Metadata{}, start, StateActive},
+		{"before start", Metadata{NotBefore: start}, start.Add(-time.Second), StateScheduled},
+		{"at start", Metadata{NotBefore: start, NotAfter: end}, start, StateActive},
+		{"before end", Metadata{NotAfter: end}, end.Add(-time.Second), StateActive},
+		{"at end", Metadata{NotBefore: start, NotAfter: end}, end, StateEnded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.md.State(tt.now); got != tt.want {
+				t.Errorf("got %v want %v", got, tt.want)
+			}
+		})
+	}
+}
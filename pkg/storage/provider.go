@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"net/url"
+)
+
+// Provider is implemented by the backends storing key-url associations. Operations should give up
+// and return the error of ctx as soon as it is done.
+type Provider interface {
+	// ShortURL returns the url associated with the provided key, counting a hit
+	ShortURL(ctx context.Context, key string) (*url.URL, error)
+	// AddURL allows to store a key-url association along with its metadata
+	AddURL(ctx context.Context, key string, u url.URL, md Metadata) error
+	// DeleteURL allows to delete the key-url association for the specified key
+	DeleteURL(ctx context.Context, key string) error
+	// ShortURLInfo returns the url and the number of hits for the provided key
+	ShortURLInfo(ctx context.Context, key string) (*url.URL, int, error)
+	// Metadata returns the metadata stored for the provided key
+	Metadata(ctx context.Context, key string) (Metadata, error)
+	// SetMetadata replaces the metadata stored for the provided key
+	SetMetadata(ctx context.Context, key string, md Metadata) error
+	// Keys returns all the stored keys
+	Keys(ctx context.Context) ([]string, error)
+}
+
+// HitQueue is implemented by providers that aggregate hits asynchronously
+type HitQueue interface {
+	// PendingHits returns the number of hits not yet persisted
+	PendingHits() int
+}
+
+// HitCounter is implemented by providers that can count hits without resolving the url, allowing
+// decorators to serve urls themselves
+type HitCounter interface {
+	// AddHits adds n hits to the provided key
+	AddHits(ctx context.Context, key string, n int) error
+}
+
+// VariantCounter is implemented by providers counting the hits of each variant of split links
+type VariantCounter interface {
+	// AddVariantHit counts a hit of the variant at index i of the link for the provided key
+	AddVariantHit(ctx context.Context, key string, i int) error
+	// VariantHits returns the hits counted for each variant of the provided key, by index. Variants
+	// never requested may be missing from the end of the slice.
+	VariantHits(ctx context.Context, key string) ([]int, error)
+}
+
+// Pinger is implemented by providers that can check the connection to their backend
+type Pinger interface {
+	// Ping returns an error if the backend cannot be reached
+	Ping(ctx context.Context) error
+}
@@ -0,0 +1,413 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/giannimassi/shorturl/pkg/resp"
+)
+
+// Fields of the hash storing an association
+const (
+	redisURLField      = "url"
+	redisMetadataField = "md"
+)
+
+// redisScanCount is the number of keys requested to the server on each SCAN iteration
+const redisScanCount = "1000"
+
+// maxLinkUpdateAttempts is the number of times an update of a link is attempted while other clients
+// keep modifying it
+const maxLinkUpdateAttempts = 3
+
+// errLinkContended is returned when a link keeps being modified during an update
+var errLinkContended = errors.New("link modified concurrently")
+
+// RedisStore stores key-url associations on a Redis server, or on any server speaking its protocol.
+// Each association is stored as a hash holding the url and the JSON encoded metadata, while its hits
+// are counted in a separate integer and the hits of its variants in a separate hash.
+type RedisStore struct {
+	pool   *resp.Pool
+	prefix string
+	ttl    time.Duration
+}
+
+// NewRedisStore returns a RedisStore using the connections of pool, prepending prefix to the
+// names of the stored keys. Associations expire after ttl, rounded up to whole seconds, or never if
+// it is zero.
+func NewRedisStore(pool *resp.Pool, prefix string, ttl time.Duration) *RedisStore {
+	return &RedisStore{pool: pool, prefix: prefix, ttl: ttl}
+}
+
+func (s *RedisStore) linkKey(key string) string {
+	return s.prefix + "link:" + key
+}
+
+func (s *RedisStore) hitsKey(key string) string {
+	return s.prefix + "hits:" + key
+}
+
+func (s *RedisStore) variantsKey(key string) string {
+	return s.prefix + "variants:" + key
+}
+
+func (s *RedisStore) domainsKey() string {
+	return s.prefix + "domains"
+}
+
+// ShortURL returns the url associated with the provided key, counting a hit
+func (s *RedisStore) ShortURL(ctx context.Context, key string) (*url.URL, error) {
+	v, _, err := s.updateLink(ctx, key, []string{"INCR", s.hitsKey(key)})
+	if err != nil {
+		return nil, fmt.Errorf("redis: counting hit: %w", err)
+	}
+	return parseRedisURL(v)
+}
+
+// AddHits adds n hits to the provided key
+func (s *RedisStore) AddHits(ctx context.Context, key string, n int) error {
+	if _, _, err := s.updateLink(ctx, key, []string{"INCRBY", s.hitsKey(key), strconv.Itoa(n)}); err != nil {
+		return fmt.Errorf("redis: counting hits: %w", err)
+	}
+	return nil
+}
+
+// AddVariantHit counts a hit of the variant at index i of the link for the provided key
+func (s *RedisStore) AddVariantHit(ctx context.Context, key string, i int) error {
+	if i < 0 {
+		return fmt.Errorf("redis: invalid variant index %d", i)
+	}
+	if _, _, err := s.updateLink(ctx, key, []string{"HINCRBY", s.variantsKey(key), strconv.Itoa(i), "1"}); err != nil {
+		return fmt.Errorf("redis: counting variant hit: %w", err)
+	}
+	return nil
+}
+
+// VariantHits returns the hits counted for each variant of the provided key
+func (s *RedisStore) VariantHits(ctx context.Context, key string) ([]int, error) {
+	vs, err := s.pool.Pipeline(ctx, []string{"EXISTS", s.linkKey(key)}, []string{"HGETALL", s.variantsKey(key)})
+	if err == nil {
+		err = replyError(vs)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis: getting variant hits: %w", err)
+	}
+	if vs[0].Int == 0 {
+		return nil, ErrKeyNotFound
+	}
+	fields, err := vs[1].Strings()
+	if err != nil {
+		return nil, fmt.Errorf("redis: malformed variant hits: %w", err)
+	}
+	var hits []int
+	for j := 0; j+1 < len(fields); j += 2 {
+		i, err := strconv.Atoi(fields[j])
+		if err != nil || i < 0 {
+			return nil, fmt.Errorf("redis: malformed variant index %q", fields[j])
+		}
+		n, err := strconv.Atoi(fields[j+1])
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed variant hits %q", fields[j+1])
+		}
+		for len(hits) <= i {
+			hits = append(hits, 0)
+		}
+		hits[i] = n
+	}
+	return hits, nil
+}
+
+// AddURL stores a key-url association along with its metadata, returning ErrKeyAlreadyExists if
+// the key is already associated with an url. The link is watched while checking that the key is
+// free and all the keys of the association are written in a MULTI/EXEC transaction, so that the
+// association is stored either completely or not at all.
+func (s *RedisStore) AddURL(ctx context.Context, key string, u url.URL, md Metadata) error {
+	encoded, err := json.Marshal(md)
+	if err != nil {
+		return fmt.Errorf("redis: encoding metadata: %w", err)
+	}
+	cmds := [][]string{
+		{"MULTI"},
+		{"HSET", s.linkKey(key), redisURLField, u.String(), redisMetadataField, string(encoded)},
+		{"SET", s.hitsKey(key), "0"},
+		{"DEL", s.variantsKey(key)},
+	}
+	if len(md.Variants) > 0 {
+		// the counters are created with the link so that they expire with it
+		hset := []string{"HSET", s.variantsKey(key)}
+		for i := range md.Variants {
+			hset = append(hset, strconv.Itoa(i), "0")
+		}
+		cmds = append(cmds, hset)
+	}
+	if s.ttl > 0 {
+		secs := strconv.FormatInt(s.ttlSeconds(), 10)
+		cmds = append(cmds,
+			[]string{"EXPIRE", s.linkKey(key), secs},
+			[]string{"EXPIRE", s.hitsKey(key), secs},
+			[]string{"EXPIRE", s.variantsKey(key), secs},
+		)
+	}
+	cmds = append(cmds, []string{"EXEC"})
+
+	exists := false
+	err = s.pool.WithConn(ctx, func(c *resp.Conn) error {
+		vs, err := c.Pipeline([]string{"WATCH", s.linkKey(key)}, []string{"HEXISTS", s.linkKey(key), redisURLField})
+		if err != nil {
+			return err
+		}
+		if err := replyError(vs); err != nil || vs[1].Int == 1 {
+			exists = err == nil
+			if _, unwatchErr := c.Do("UNWATCH"); unwatchErr != nil {
+				return unwatchErr
+			}
+			return err
+		}
+		if vs, err = c.Pipeline(cmds...); err != nil {
+			return err
+		}
+		exec := vs[len(vs)-1]
+		if exec.Kind == resp.Array && exec.Null {
+			exists = true // claimed by another client after the check
+			return nil
+		}
+		if err := replyError(vs); err != nil {
+			return err
+		}
+		return replyError(exec.Elems)
+	})
+	if err != nil {
+		return fmt.Errorf("redis: adding url: %w", err)
+	}
+	if exists {
+		return ErrKeyAlreadyExists
+	}
+	return nil
+}
+
+// ttlSeconds returns the TTL of the associations in seconds, rounded up so that associations with a
+// TTL shorter than a second are not deleted as soon as they are added
+func (s *RedisStore) ttlSeconds() int64 {
+	return int64((s.ttl + time.Second - 1) / time.Second)
+}
+
+// DeleteURL deletes the key-url association for the specified key
+func (s *RedisStore) DeleteURL(ctx context.Context, key string) error {
+	vs, err := s.pool.Pipeline(ctx, []string{"DEL", s.linkKey(key)}, []string{"DEL", s.hitsKey(key)}, []string{"DEL", s.variantsKey(key)})
+	if err == nil {
+		err = replyError(vs)
+	}
+	if err != nil {
+		return fmt.Errorf("redis: deleting url: %w", err)
+	}
+	if vs[0].Int == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+// ShortURLInfo returns the url and the number of hits for the provided key
+func (s *RedisStore) ShortURLInfo(ctx context.Context, key string) (*url.URL, int, error) {
+	vs, err := s.pool.Pipeline(ctx, []string{"HGET", s.linkKey(key), redisURLField}, []string{"GET", s.hitsKey(key)})
+	if err == nil {
+		err = replyError(vs)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("redis: getting url info: %w", err)
+	}
+	u, err := parseRedisURL(vs[0])
+	if err != nil {
+		return nil, 0, err
+	}
+	hits, err := vs[1].Integer()
+	if err != nil && !errors.Is(err, resp.ErrNil) {
+		return nil, 0, fmt.Errorf("redis: parsing hits: %w", err)
+	}
+	return u, int(hits), nil
+}
+
+// Metadata returns the metadata stored for the provided key
+func (s *RedisStore) Metadata(ctx context.Context, key string) (Metadata, error) {
+	v, err := s.pool.Do(ctx, "HMGET", s.linkKey(key), redisURLField, redisMetadataField)
+	if err != nil {
+		return Metadata{}, fmt.Errorf("redis: getting metadata: %w", err)
+	}
+	if len(v.Elems) != 2 || v.Elems[0].Null {
+		return Metadata{}, ErrKeyNotFound
+	}
+	var md Metadata
+	if v.Elems[1].Null {
+		return md, nil
+	}
+	if err := json.Unmarshal([]byte(v.Elems[1].Str), &md); err != nil {
+		return Metadata{}, fmt.Errorf("redis: decoding metadata: %w", err)
+	}
+	return md, nil
+}
+
+// SetMetadata replaces the metadata stored for the provided key
+func (s *RedisStore) SetMetadata(ctx context.Context, key string, md Metadata) error {
+	encoded, err := json.Marshal(md)
+	if err != nil {
+		return fmt.Errorf("redis: encoding metadata: %w", err)
+	}
+	if _, _, err := s.updateLink(ctx, key, []string{"HSET", s.linkKey(key), redisMetadataField, string(encoded)}); err != nil {
+		return fmt.Errorf("redis: setting metadata: %w", err)
+	}
+	return nil
+}
+
+// updateLink executes cmds in a MULTI/EXEC transaction if the link for key exists, returning the
+// url field of the link and the replies of cmds, or ErrKeyNotFound. The link is watched while
+// checking that it exists, so that cmds are not applied to a link deleted, expired or replaced in
+// the meantime: counters and fields written after the link is gone would be left without a TTL.
+// The transaction is retried up to maxLinkUpdateAttempts times if the link changes.
+func (s *RedisStore) updateLink(ctx context.Context, key string, cmds ...[]string) (resp.Value, []resp.Value, error) {
+	tx := make([][]string, 0, len(cmds)+2)
+	tx = append(tx, []string{"MULTI"})
+	tx = append(tx, cmds...)
+	tx = append(tx, []string{"EXEC"})
+
+	var u resp.Value
+	var replies []resp.Value
+	err := s.pool.WithConn(ctx, func(c *resp.Conn) error {
+		for attempt := 1; ; attempt++ {
+			vs, err := c.Pipeline([]string{"WATCH", s.linkKey(key)}, []string{"HGET", s.linkKey(key), redisURLField})
+			if err != nil {
+				return err
+			}
+			if err := replyError(vs); err != nil || vs[1].Null {
+				if _, unwatchErr := c.Do("UNWATCH"); unwatchErr != nil {
+					return unwatchErr
+				}
+				if err == nil {
+					err = ErrKeyNotFound
+				}
+				return err
+			}
+			u = vs[1]
+			if vs, err = c.Pipeline(tx...); err != nil {
+				return err
+			}
+			exec := vs[len(vs)-1]
+			if exec.Kind == resp.Array && exec.Null {
+				if attempt == maxLinkUpdateAttempts {
+					return errLinkContended
+				}
+				continue
+			}
+			if err := replyError(vs); err != nil {
+				return err
+			}
+			replies = exec.Elems
+			return replyError(replies)
+		}
+	})
+	return u, replies, err
+}
+
+// Keys returns all the keys in the store in lexicographical order
+func (s *RedisStore) Keys(ctx context.Context) ([]string, error) {
+	prefix := s.linkKey("")
+	var keys []string
+	cursor := "0"
+	for {
+		v, err := s.pool.Do(ctx, "SCAN", cursor, "MATCH", prefix+"*", "COUNT", redisScanCount)
+		if err != nil {
+			return nil, fmt.Errorf("redis: scanning keys: %w", err)
+		}
+		if len(v.Elems) != 2 {
+			return nil, errors.New("redis: malformed SCAN reply")
+		}
+		if cursor, err = v.Elems[0].String(); err != nil {
+			return nil, fmt.Errorf("redis: malformed SCAN cursor: %w", err)
+		}
+		batch, err := v.Elems[1].Strings()
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed SCAN keys: %w", err)
+		}
+		for _, k := range batch {
+			keys = append(keys, strings.TrimPrefix(k, prefix))
+		}
+		if cursor == "0" {
+			break
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Ping returns an error if the server cannot be reached
+func (s *RedisStore) Ping(ctx context.Context) error {
+	if _, err := s.pool.Do(ctx, "PING"); err != nil {
+		return fmt.Errorf("redis: %w", err)
+	}
+	return nil
+}
+
+// Domains returns the records of the short domains stored with SetDomain, by host
+func (s *RedisStore) Domains(ctx context.Context) (map[string]string, error) {
+	v, err := s.pool.Do(ctx, "HGETALL", s.domainsKey())
+	if err != nil {
+		return nil, fmt.Errorf("redis: getting domains: %w", err)
+	}
+	fields, err := v.Strings()
+	if err != nil {
+		return nil, fmt.Errorf("redis: malformed domains: %w", err)
+	}
+	records := make(map[string]string, len(fields)/2)
+	for i := 0; i+1 < len(fields); i += 2 {
+		records[fields[i]] = fields[i+1]
+	}
+	return records, nil
+}
+
+// SetDomain stores the record of a short domain, replacing the one of the same host if any. Records
+// are opaque to the store and never expire.
+func (s *RedisStore) SetDomain(ctx context.Context, host, record string) error {
+	if _, err := s.pool.Do(ctx, "HSET", s.domainsKey(), host, record); err != nil {
+		return fmt.Errorf("redis: setting domain: %w", err)
+	}
+	return nil
+}
+
+// DeleteDomain removes the record of a short domain, if stored
+func (s *RedisStore) DeleteDomain(ctx context.Context, host string) error {
+	if _, err := s.pool.Do(ctx, "HDEL", s.domainsKey(), host); err != nil {
+		return fmt.Errorf("redis: deleting domain: %w", err)
+	}
+	return nil
+}
+
+// replyError returns the first error reply in vs
+func replyError(vs []resp.Value) error {
+	for _, v := range vs {
+		if err := v.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseRedisURL parses the url field of an association, returning ErrKeyNotFound if missing
+func parseRedisURL(v resp.Value) (*url.URL, error) {
+	raw, err := v.String()
+	if errors.Is(err, resp.ErrNil) {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("redis: parsing stored url: %w", err)
+	}
+	return u, nil
+}
@@ -0,0 +1,262 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/giannimassi/shorturl/pkg/resp"
+	"github.com/giannimassi/shorturl/pkg/resp/resptest"
+)
+
+func newTestRedisStore(t *testing.T, ttl time.Duration) (*RedisStore, *resptest.Server) {
+	t.Helper()
+	srv := resptest.NewServer()
+	pool := resp.NewPool(srv.Addr(), time.Second, 2)
+	t.Cleanup(func() {
+		_ = pool.Close()
+		srv.Close()
+	})
+	return NewRedisStore(pool, "test:", ttl), srv
+}
+
+func TestRedisStore(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestRedisStore(t, 0)
+
+	if _, err := s.ShortURL(ctx, "a"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("unexpected err: %v", err)
+	}
+	md := Metadata{Title: "A", Flag: FlagWarn, CreatedAt: time.Date(2020, 7, 30, 10, 0, 0, 0, time.UTC)}
+	if err := s.AddURL(ctx, "a", mustMkURL("http://url1.com/a?b=c"), md); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := s.AddURL(ctx, "a", mustMkURL("http://url2.com"), Metadata{}); !errors.Is(err, ErrKeyAlreadyExists) {
+		t.Errorf("unexpected err: %v", err)
+	}
+	if err := s.AddURL(ctx, "b", mustMkURL("http://url2.com"), Metadata{}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		u, err := s.ShortURL(ctx, "a")
+		if err != nil || u.String() != "http://url1.com/a?b=c" {
+			t.Fatalf("unexpected url: %v, %v", u, err)
+		}
+	}
+	if err := s.AddHits(ctx, "a", 3); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+	if err := s.AddHits(ctx, "missing", 3); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("unexpected err: %v", err)
+	}
+	if u, hits, err := s.ShortURLInfo(ctx, "a"); err != nil || hits != 5 || u.Host != "url1.com" {
+		t.Errorf("unexpected info: %v, %d, %v", u, hits, err)
+	}
+
+	if got, err := s.Metadata(ctx, "a"); err != nil || !reflect.DeepEqual(got, md) {
+		t.Errorf("unexpected metadata: got %+v (%v), want %+v", got, err, md)
+	}
+	md.Flag = FlagDisabled
+	if err := s.SetMetadata(ctx, "a", md); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if got, _ := s.Metadata(ctx, "a"); got.Flag != FlagDisabled {
+		t.Errorf("metadata not updated: %+v", got)
+	}
+	if err := s.SetMetadata(ctx, "missing", md); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("unexpected err: %v", err)
+	}
+
+	if keys, err := s.Keys(ctx); err != nil || !reflect.DeepEqual(keys, []string{"a", "b"}) {
+		t.Errorf("unexpected keys: %v, %v", keys, err)
+	}
+
+	if err := s.DeleteURL(ctx, "a"); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+	if err := s.DeleteURL(ctx, "a"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("unexpected err: %v", err)
+	}
+	if _, _, err := s.ShortURLInfo(ctx, "a"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("unexpected err: %v", err)
+	}
+	if _, err := s.Metadata(ctx, "a"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("unexpected err: %v", err)
+	}
+	if err := s.AddURL(ctx, "a", mustMkURL("http://url2.com"), Metadata{}); err != nil {
+		t.Errorf("deleted keys should be available: %v", err)
+	}
+	if _, hits, _ := s.ShortURLInfo(ctx, "a"); hits != 0 {
+		t.Errorf("hits should be reset: %d", hits)
+	}
+	if err := s.Ping(ctx); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+}
+
+func TestRedisStore_variantHits(t *testing.T) {
+	s, _ := newTestRedisStore(t, 0)
+	testVariantHits(t, s)
+}
+
+func TestRedisStore_ttl(t *testing.T) {
+	ctx := context.Background()
+	s, srv := newTestRedisStore(t, time.Hour)
+	if err := s.AddURL(ctx, "a", mustMkURL("http://url1.com"), Metadata{}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	srv.FastForward(59 * time.Minute)
+	if _, err := s.ShortURL(ctx, "a"); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+	srv.FastForward(time.Minute)
+	if _, err := s.ShortURL(ctx, "a"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("expired key should not be found: %v", err)
+	}
+	if err := s.AddURL(ctx, "a", mustMkURL("http://url1.com"), Metadata{}); err != nil {
+		t.Errorf("expired keys should be available: %v", err)
+	}
+}
+
+func TestRedisStore_shortTTL(t *testing.T) {
+	ctx := context.Background()
+	s, srv := newTestRedisStore(t, 500*time.Millisecond)
+	if err := s.AddURL(ctx, "a", mustMkURL("http://url1.com"), Metadata{}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if _, err := s.ShortURL(ctx, "a"); err != nil {
+		t.Errorf("TTLs shorter than a second should be rounded up: %v", err)
+	}
+	srv.FastForward(time.Second)
+	if _, err := s.ShortURL(ctx, "a"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("expired key should not be found: %v", err)
+	}
+}
+
+func TestRedisStore_concurrentAdd(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestRedisStore(t, time.Hour)
+	const clients = 8
+	errs := make(chan error, clients)
+	for i := 0; i < clients; i++ {
+		go func(i int) {
+			errs <- s.AddURL(ctx, "a", mustMkURL("http://url.com/"+strconv.Itoa(i)), Metadata{Title: strconv.Itoa(i)})
+		}(i)
+	}
+	added := 0
+	for i := 0; i < clients; i++ {
+		switch err := <-errs; {
+		case err == nil:
+			added++
+		case !errors.Is(err, ErrKeyAlreadyExists):
+			t.Errorf("unexpected err: %v", err)
+		}
+	}
+	if added != 1 {
+		t.Fatalf("expected a single client to add the key, got %d", added)
+	}
+	u, err := s.ShortURL(ctx, "a")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if md, err := s.Metadata(ctx, "a"); err != nil || "http://url.com/"+md.Title != u.String() {
+		t.Errorf("url and metadata should be written together: %v, %+v, %v", u, md, err)
+	}
+}
+
+func TestRedisStore_updateDeleted(t *testing.T) {
+	ctx := context.Background()
+	s, srv := newTestRedisStore(t, time.Hour)
+	assertNoKeys := func(key string) {
+		t.Helper()
+		if v, err := s.pool.Do(ctx, "EXISTS", s.linkKey(key), s.hitsKey(key), s.variantsKey(key)); err != nil || v.Int != 0 {
+			t.Errorf("%s: keys left without the link: %v %v", key, v.Int, err)
+		}
+	}
+
+	// updates of expired links do not create keys without TTL
+	if err := s.AddURL(ctx, "a", mustMkURL("http://url1.com"), Metadata{Variants: []Variant{{URL: "http://url1.com", Weight: 1}}}); err != nil {
+		t.Fatal(err)
+	}
+	srv.FastForward(time.Hour)
+	if _, err := s.ShortURL(ctx, "a"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("unexpected err: %v", err)
+	}
+	if err := s.AddHits(ctx, "a", 1); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("unexpected err: %v", err)
+	}
+	if err := s.AddVariantHit(ctx, "a", 0); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("unexpected err: %v", err)
+	}
+	if err := s.SetMetadata(ctx, "a", Metadata{Title: "A"}); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("unexpected err: %v", err)
+	}
+	assertNoKeys("a")
+
+	// nor do updates racing with the deletion of the link
+	for i := 0; i < 50; i++ {
+		key := "b" + strconv.Itoa(i)
+		if err := s.AddURL(ctx, key, mustMkURL("http://url2.com"), Metadata{}); err != nil {
+			t.Fatal(err)
+		}
+		updates := []func() error{
+			func() error { _, err := s.ShortURL(ctx, key); return err },
+			func() error { return s.AddHits(ctx, key, 1) },
+			func() error { return s.SetMetadata(ctx, key, Metadata{Title: key}) },
+			func() error { return s.DeleteURL(ctx, key) },
+		}
+		errs := make(chan error, len(updates))
+		for _, update := range updates {
+			go func(update func() error) { errs <- update() }(update)
+		}
+		for range updates {
+			if err := <-errs; err != nil && !errors.Is(err, ErrKeyNotFound) {
+				t.Errorf("unexpected err: %v", err)
+			}
+		}
+		assertNoKeys(key)
+	}
+}
+
+func TestRedisStore_domains(t *testing.T) {
+	ctx := context.Background()
+	s, srv := newTestRedisStore(t, time.Second)
+
+	if err := s.SetDomain(ctx, "go.company", `{"Host":"go.company"}`); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetDomain(ctx, "links.brand", `{"Host":"links.brand"}`); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddURL(ctx, "a", mustMkURL("http://url1.com"), Metadata{}); err != nil {
+		t.Fatal(err)
+	}
+	srv.FastForward(2 * time.Second)
+
+	// domains never expire and are not listed as keys
+	records, err := s.Domains(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"go.company": `{"Host":"go.company"}`, "links.brand": `{"Host":"links.brand"}`}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("unexpected domains: %v", records)
+	}
+	if keys, err := s.Keys(ctx); err != nil || len(keys) != 0 {
+		t.Errorf("unexpected keys: %v %v", keys, err)
+	}
+
+	if err := s.DeleteDomain(ctx, "go.company"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteDomain(ctx, "go.company"); err != nil {
+		t.Errorf("deleting a missing domain should not fail: %v", err)
+	}
+	if records, err := s.Domains(ctx); err != nil || len(records) != 1 || records["links.brand"] == "" {
+		t.Errorf("unexpected domains: %v %v", records, err)
+	}
+}
@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultShards is the number of shards used by NewShardedStore when none is specified
+const DefaultShards = 64
+
+// ShardedStore is a memory-based storage of key-url associations spreading keys over several
+// shards, each guarded by its own lock. Hits are counted atomically under a read lock, so that
+// redirects of different keys never wait for each other. Operations on a single key complete
+// immediately, only Keys checks the context between shards.
+type ShardedStore struct {
+	shards []shard
+}
+
+type shard struct {
+	m    sync.RWMutex
+	urls map[string]*shardEntry
+}
+
+type shardEntry struct {
+	hits        int64 // first field to guarantee 64-bit alignment for atomic operations
+	url         url.URL
+	md          Metadata
+	variantHits []int64 // only grown under the write lock
+}
+
+// NewShardedStore returns an empty ShardedStore with n shards, or DefaultShards if n is not positive
+func NewShardedStore(n int) *ShardedStore {
+	if n <= 0 {
+		n = DefaultShards
+	}
+	s := &ShardedStore{shards: make([]shard, n)}
+	for i := range s.shards {
+		s.shards[i].urls = make(map[string]*shardEntry)
+	}
+	return s
+}
+
+// shard returns the shard holding key, chosen by its FNV-1a hash
+func (s *ShardedStore) shard(key string) *shard {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return &s.shards[h%uint32(len(s.shards))]
+}
+
+// ShortURL returns the url associated with the provided key, counting a hit
+func (s *ShardedStore) ShortURL(ctx context.Context, key string) (*url.URL, error) {
+	sh := s.shard(key)
+	sh.m.RLock()
+	defer sh.m.RUnlock()
+	e, found := sh.urls[key]
+	if !found {
+		return nil, ErrKeyNotFound
+	}
+	atomic.AddInt64(&e.hits, 1)
+	u := e.url
+	return &u, nil
+}
+
+// AddHits adds n hits to the provided key
+func (s *ShardedStore) AddHits(ctx context.Context, key string, n int) error {
+	sh := s.shard(key)
+	sh.m.RLock()
+	defer sh.m.RUnlock()
+	e, found := sh.urls[key]
+	if !found {
+		return ErrKeyNotFound
+	}
+	atomic.AddInt64(&e.hits, int64(n))
+	return nil
+}
+
+// AddVariantHit counts a hit of the variant at index i of the link for the provided key
+func (s *ShardedStore) AddVariantHit(ctx context.Context, key string, i int) error {
+	if i < 0 {
+		return fmt.Errorf("invalid variant index %d", i)
+	}
+	sh := s.shard(key)
+	sh.m.RLock()
+	e, found := sh.urls[key]
+	if found && i < len(e.variantHits) {
+		atomic.AddInt64(&e.variantHits[i], 1)
+		sh.m.RUnlock()
+		return nil
+	}
+	sh.m.RUnlock()
+	if !found {
+		return ErrKeyNotFound
+	}
+
+	// the variants have been set after the link was added, the counters are grown under the write lock
+	sh.m.Lock()
+	defer sh.m.Unlock()
+	if e, found = sh.urls[key]; !found {
+		return ErrKeyNotFound
+	}
+	for len(e.variantHits) <= i {
+		e.variantHits = append(e.variantHits, 0)
+	}
+	e.variantHits[i]++
+	return nil
+}
+
+// VariantHits returns the hits counted for each variant of the provided key
+func (s *ShardedStore) VariantHits(ctx context.Context, key string) ([]int, error) {
+	sh := s.shard(key)
+	sh.m.RLock()
+	defer sh.m.RUnlock()
+	e, found := sh.urls[key]
+	if !found {
+		return nil, ErrKeyNotFound
+	}
+	hits := make([]int, len(e.variantHits))
+	for i := range e.variantHits {
+		hits[i] = int(atomic.LoadInt64(&e.variantHits[i]))
+	}
+	return hits, nil
+}
+
+// AddURL adds a key-url association along with its metadata
+func (s *ShardedStore) AddURL(ctx context.Context, key string, u url.URL, md Metadata) error {
+	sh := s.shard(key)
+	sh.m.Lock()
+	defer sh.m.Unlock()
+	if _, found := sh.urls[key]; found {
+		return ErrKeyAlreadyExists
+	}
+	sh.urls[key] = &shardEntry{url: u, md: md, variantHits: make([]int64, len(md.Variants))}
+	return nil
+}
+
+// DeleteURL allows to remove a key-url association for the specified key
+func (s *ShardedStore) DeleteURL(ctx context.Context, key string) error {
+	sh := s.shard(key)
+	sh.m.Lock()
+	defer sh.m.Unlock()
+	if _, found := sh.urls[key]; !found {
+		return ErrKeyNotFound
+	}
+	delete(sh.urls, key)
+	return nil
+}
+
+// ShortURLInfo returns the url and the number of hits for the provided key
+func (s *ShardedStore) ShortURLInfo(ctx context.Context, key string) (*url.URL, int, error) {
+	sh := s.shard(key)
+	sh.m.RLock()
+	defer sh.m.RUnlock()
+	e, found := sh.urls[key]
+	if !found {
+		return nil, 0, ErrKeyNotFound
+	}
+	u := e.url
+	return &u, int(atomic.LoadInt64(&e.hits)), nil
+}
+
+// Metadata returns the metadata stored for the provided key
+func (s *ShardedStore) Metadata(ctx context.Context, key string) (Metadata, error) {
+	sh := s.shard(key)
+	sh.m.RLock()
+	defer sh.m.RUnlock()
+	e, found := sh.urls[key]
+	if !found {
+		return Metadata{}, ErrKeyNotFound
+	}
+	return e.md, nil
+}
+
+// SetMetadata replaces the metadata stored for the provided key
+func (s *ShardedStore) SetMetadata(ctx context.Context, key string, md Metadata) error {
+	sh := s.shard(key)
+	sh.m.Lock()
+	defer sh.m.Unlock()
+	e, found := sh.urls[key]
+	if !found {
+		return ErrKeyNotFound
+	}
+	e.md = md
+	return nil
+}
+
+// Keys returns all the keys in the store in lexicographical order
+func (s *ShardedStore) Keys(ctx context.Context) ([]string, error) {
+	var keys []string
+	for i := range s.shards {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		sh := &s.shards[i]
+		sh.m.RLock()
+		for key := range sh.urls {
+			keys = append(keys, key)
+		}
+		sh.m.RUnlock()
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Len returns the number of stored keys
+func (s *ShardedStore) Len() int {
+	var n int
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.m.RLock()
+		n += len(sh.urls)
+		sh.m.RUnlock()
+	}
+	return n
+}
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestShardedStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewShardedStore(4)
+	if _, err := s.ShortURL(ctx, "a"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("unexpected err: %v", err)
+	}
+	for _, key := range []string{"c", "a", "b"} {
+		if err := s.AddURL(ctx, key, mustMkURL("http://url1.com/"+key), Metadata{Title: key}); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+	if err := s.AddURL(ctx, "a", mustMkURL("http://url2.com"), Metadata{}); !errors.Is(err, ErrKeyAlreadyExists) {
+		t.Errorf("unexpected err: %v", err)
+	}
+
+	u, err := s.ShortURL(ctx, "a")
+	if err != nil || u.String() != "http://url1.com/a" {
+		t.Fatalf("unexpected url: %v, %v", u, err)
+	}
+	u.Path = "/modified"
+	if err := s.AddHits(ctx, "a", 2); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+	if u, hits, err := s.ShortURLInfo(ctx, "a"); err != nil || hits != 3 || u.Path != "/a" {
+		t.Errorf("unexpected info: %v, %d, %v", u, hits, err)
+	}
+
+	if err := s.SetMetadata(ctx, "b", Metadata{Flag: FlagWarn}); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+	if md, err := s.Metadata(ctx, "b"); err != nil || md.Flag != FlagWarn {
+		t.Errorf("unexpected metadata: %+v, %v", md, err)
+	}
+
+	if keys, err := s.Keys(ctx); err != nil || !reflect.DeepEqual(keys, []string{"a", "b", "c"}) {
+		t.Errorf("unexpected keys: %v, %v", keys, err)
+	}
+	if err := s.DeleteURL(ctx, "a"); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+	if err := s.DeleteURL(ctx, "a"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("unexpected err: %v", err)
+	}
+	if s.Len() != 2 {
+		t.Errorf("unexpected len: %d", s.Len())
+	}
+}
+
+func TestShardedStore_variantHits(t *testing.T) {
+	testVariantHits(t, NewShardedStore(4))
+}
+
+func TestShardedStore_concurrentHits(t *testing.T) {
+	ctx := context.Background()
+	s := NewShardedStore(0)
+	const keys, workers, hits = 10, 8, 1000
+	for i := 0; i < keys; i++ {
+		if err := s.AddURL(ctx, strconv.Itoa(i), mustMkURL("http://url1.com"), Metadata{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < hits; i++ {
+				_, _ = s.ShortURL(ctx, strconv.Itoa(i%keys))
+				if i%100 == 0 {
+					_ = s.SetMetadata(ctx, strconv.Itoa(w%keys), Metadata{Title: "t"})
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	var total int
+	for i := 0; i < keys; i++ {
+		_, n, _ := s.ShortURLInfo(ctx, strconv.Itoa(i))
+		total += n
+	}
+	if total != workers*hits {
+		t.Errorf("unexpected total hits: got %d, want %d", total, workers*hits)
+	}
+}
+
+// benchStores builds the stores compared by the benchmarks
+var benchStores = map[string]func() Provider{
+	"memory":  func() Provider { return NewMemoryStore() },
+	"sharded": func() Provider { return NewShardedStore(0) },
+}
+
+// benchStore returns the store called name in benchStores, filled with n keys
+func benchStore(b *testing.B, name string, n int) Provider {
+	ctx := context.Background()
+	s := benchStores[name]()
+	for i := 0; i < n; i++ {
+		if err := s.AddURL(ctx, strconv.Itoa(i), mustMkURL("http://url1.com"), Metadata{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return s
+}
+
+func BenchmarkShortURL(b *testing.B) {
+	ctx := context.Background()
+	const keys = 10000
+	for _, name := range []string{"memory", "sharded"} {
+		s := benchStore(b, name, keys)
+		b.Run(name, func(b *testing.B) {
+			var seed int64
+			b.RunParallel(func(pb *testing.PB) {
+				i := int(atomic.AddInt64(&seed, 7919))
+				for pb.Next() {
+					i++
+					if _, err := s.ShortURL(ctx, strconv.Itoa(i%keys)); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkMixed(b *testing.B) {
+	ctx := context.Background()
+	const keys = 10000
+	for _, name := range []string{"memory", "sharded"} {
+		s := benchStore(b, name, keys)
+		b.Run(name, func(b *testing.B) {
+			var seed int64
+			b.RunParallel(func(pb *testing.PB) {
+				i := int(atomic.AddInt64(&seed, 7919))
+				for pb.Next() {
+					i++
+					key := strconv.Itoa(i % keys)
+					switch i % 10 {
+					case 0:
+						_ = s.SetMetadata(ctx, key, Metadata{Title: key})
+					case 1:
+						_, _, _ = s.ShortURLInfo(ctx, key)
+					default:
+						_, _ = s.ShortURL(ctx, key)
+					}
+				}
+			})
+		})
+	}
+}
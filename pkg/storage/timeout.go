@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"net/url"
+	"time"
+)
+
+// timeoutProvider decorates a Provider bounding the duration of every operation
+type timeoutProvider struct {
+	Forwarder
+	next    Provider
+	timeout time.Duration
+}
+
+// WithTimeout returns a Provider giving up any operation performed on p after d, in addition to
+// the deadline of the context passed by the caller. If d is not positive p is returned as is.
+func WithTimeout(p Provider, d time.Duration) Provider {
+	if d <= 0 {
+		return p
+	}
+	t := &timeoutProvider{next: p, timeout: d}
+	t.Forwarder = Forwarder{Next: p, Wrap: t.wrap}
+	return t
+}
+
+func (p *timeoutProvider) ShortURL(ctx context.Context, key string) (*url.URL, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	return p.next.ShortURL(ctx, key)
+}
+
+func (p *timeoutProvider) AddURL(ctx context.Context, key string, u url.URL, md Metadata) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	return p.next.AddURL(ctx, key, u, md)
+}
+
+func (p *timeoutProvider) DeleteURL(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	return p.next.DeleteURL(ctx, key)
+}
+
+func (p *timeoutProvider) ShortURLInfo(ctx context.Context, key string) (*url.URL, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	return p.next.ShortURLInfo(ctx, key)
+}
+
+func (p *timeoutProvider) Metadata(ctx context.Context, key string) (Metadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	return p.next.Metadata(ctx, key)
+}
+
+func (p *timeoutProvider) SetMetadata(ctx context.Context, key string, md Metadata) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	return p.next.SetMetadata(ctx, key, md)
+}
+
+func (p *timeoutProvider) Keys(ctx context.Context) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	return p.next.Keys(ctx)
+}
+
+// wrap bounds the duration of the optional operations forwarded by Forwarder
+func (p *timeoutProvider) wrap(ctx context.Context, _, _ string, call func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	return call(ctx)
+}
@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// slowStore is a MemoryStore waiting for its delay or for the context before resolving urls
+type slowStore struct {
+	*MemoryStore
+	delay time.Duration
+}
+
+func (s *slowStore) ShortURL(ctx context.Context, key string) (*url.URL, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(s.delay):
+		return s.MemoryStore.ShortURL(ctx, key)
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	ctx := context.Background()
+	s := &slowStore{MemoryStore: NewMemoryStore(), delay: 50 * time.Millisecond}
+	if err := s.AddURL(ctx, "a", mustMkURL("http://url1.com"), Metadata{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if p := WithTimeout(s, 0); p != Provider(s) {
+		t.Errorf("provider should not be decorated without timeout")
+	}
+	if _, err := WithTimeout(s, time.Second).ShortURL(ctx, "a"); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+	if _, err := WithTimeout(s, time.Millisecond).ShortURL(ctx, "a"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unexpected err: %v", err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := WithTimeout(s, time.Second).ShortURL(canceled, "a"); !errors.Is(err, context.Canceled) {
+		t.Errorf("the context of the caller should be honored: %v", err)
+	}
+}
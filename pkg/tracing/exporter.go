@@ -0,0 +1,294 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// jsonSpan is the JSON representation of a span written by WriterExporter
+type jsonSpan struct {
+	Name         string                 `json:"name"`
+	TraceID      string                 `json:"trace_id"`
+	SpanID       string                 `json:"span_id"`
+	ParentSpanID string                 `json:"parent_span_id,omitempty"`
+	Start        time.Time              `json:"start"`
+	End          time.Time              `json:"end"`
+	Duration     float64                `json:"duration_seconds"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+	Error        string                 `json:"error,omitempty"`
+}
+
+// WriterExporter writes spans as JSON lines, e.g. to stdout or a file
+type WriterExporter struct {
+	m sync.Mutex
+	w io.Writer
+}
+
+// NewWriterExporter returns a WriterExporter writing to w
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w}
+}
+
+// ExportSpan implements Exporter
+func (e *WriterExporter) ExportSpan(s SpanData) error {
+	js := jsonSpan{
+		Name:     s.Name,
+		TraceID:  s.TraceID.String(),
+		SpanID:   s.SpanID.String(),
+		Start:    s.Start.UTC(),
+		End:      s.End.UTC(),
+		Duration: s.End.Sub(s.Start).Seconds(),
+		Error:    s.Error,
+	}
+	if s.ParentSpanID.IsValid() {
+		js.ParentSpanID = s.ParentSpanID.String()
+	}
+	if len(s.Attributes) > 0 {
+		js.Attributes = make(map[string]interface{}, len(s.Attributes))
+		for _, a := range s.Attributes {
+			js.Attributes[a.Key] = a.Value
+		}
+	}
+	b, err := json.Marshal(&js)
+	if err != nil {
+		return fmt.Errorf("encoding span: %w", err)
+	}
+
+	e.m.Lock()
+	defer e.m.Unlock()
+	_, err = e.w.Write(append(b, '\n'))
+	return err
+}
+
+// HTTPExporter sends spans in batches to a collector accepting OTLP/HTTP JSON requests.
+// Spans are buffered until BatchSize spans have ended, then queued for Run to send them in the
+// background, so that ending a span never waits for the collector. Batches are dropped when the
+// queue is full, i.e. when the collector is slow or unreachable.
+type HTTPExporter struct {
+	url         string
+	serviceName string
+	batchSize   int
+	client      *http.Client
+
+	m       sync.Mutex
+	pending []SpanData
+	queue   chan []SpanData
+}
+
+// DefaultBatchSize is the number of spans sent together by HTTPExporter
+const DefaultBatchSize = 64
+
+// maxQueuedBatches is the number of batches waiting to be sent after which HTTPExporter drops them
+const maxQueuedBatches = 16
+
+// NewHTTPExporter returns an HTTPExporter posting spans of serviceName to url, e.g.
+// http://localhost:4318/v1/traces
+func NewHTTPExporter(url, serviceName string, batchSize int) *HTTPExporter {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	return &HTTPExporter{
+		url:         url,
+		serviceName: serviceName,
+		batchSize:   batchSize,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		queue:       make(chan []SpanData, maxQueuedBatches),
+	}
+}
+
+// ExportSpan implements Exporter. It never blocks, returning an error if the span is dropped
+// because the queue is full.
+func (e *HTTPExporter) ExportSpan(s SpanData) error {
+	e.m.Lock()
+	e.pending = append(e.pending, s)
+	var batch []SpanData
+	if len(e.pending) >= e.batchSize {
+		batch, e.pending = e.pending, nil
+	}
+	e.m.Unlock()
+	if batch == nil {
+		return nil
+	}
+	select {
+	case e.queue <- batch:
+		return nil
+	default:
+		return fmt.Errorf("dropping %d spans: %d batches waiting to be sent", len(batch), maxQueuedBatches)
+	}
+}
+
+// Run sends the queued batches, and the buffered spans every interval, until ctx is done. Then it
+// flushes the remaining spans and returns. Errors are passed to onError, if not nil.
+func (e *HTTPExporter) Run(ctx context.Context, interval time.Duration, onError func(error)) {
+	report := func(err error) {
+		if err != nil && onError != nil {
+			onError(err)
+		}
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			report(e.Flush())
+			return
+		case batch := <-e.queue:
+			report(e.send(batch))
+		case <-t.C:
+			report(e.send(e.takePending()))
+		}
+	}
+}
+
+// Flush sends all queued and buffered spans to the collector. It stops at the first error, so that
+// an unreachable collector does not delay shutdown once per batch.
+func (e *HTTPExporter) Flush() error {
+	for {
+		var batch []SpanData
+		select {
+		case batch = <-e.queue:
+		default:
+			batch = e.takePending()
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := e.send(batch); err != nil {
+			return err
+		}
+	}
+}
+
+func (e *HTTPExporter) takePending() []SpanData {
+	e.m.Lock()
+	defer e.m.Unlock()
+	spans := e.pending
+	e.pending = nil
+	return spans
+}
+
+// send posts spans to the collector
+func (e *HTTPExporter) send(spans []SpanData) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(newOTLPRequest(e.serviceName, spans))
+	if err != nil {
+		return fmt.Errorf("encoding spans: %w", err)
+	}
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("sending spans: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("sending spans: unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// OTLP/HTTP JSON request body, limited to the fields set by HTTPExporter
+// Reference: https://github.com/open-telemetry/opentelemetry-proto
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// otlpStatusError is the OTLP status code of failed spans
+const otlpStatusError = 2
+
+func newOTLPRequest(serviceName string, spans []SpanData) otlpRequest {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceID:           s.TraceID.String(),
+			SpanID:            s.SpanID.String(),
+			Name:              s.Name,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+		}
+		if s.ParentSpanID.IsValid() {
+			span.ParentSpanID = s.ParentSpanID.String()
+		}
+		for _, a := range s.Attributes {
+			span.Attributes = append(span.Attributes, otlpAttribute{Key: a.Key, Value: otlpValue{StringValue: fmt.Sprint(a.Value)}})
+		}
+		if s.Error != "" {
+			span.Status = &otlpStatus{Code: otlpStatusError, Message: s.Error}
+		}
+		out = append(out, span)
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpAttribute{
+			{Key: "service.name", Value: otlpValue{StringValue: serviceName}},
+		}},
+		ScopeSpans: []otlpScopeSpans{{Spans: out}},
+	}}}
+}
+
+// Recorder is an Exporter keeping all spans in memory, useful in tests
+type Recorder struct {
+	m     sync.Mutex
+	spans []SpanData
+}
+
+// ExportSpan implements Exporter
+func (r *Recorder) ExportSpan(s SpanData) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.spans = append(r.spans, s)
+	return nil
+}
+
+// Spans returns the spans recorded so far, in the order in which they ended
+func (r *Recorder) Spans() []SpanData {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return append([]SpanData(nil), r.spans...)
+}
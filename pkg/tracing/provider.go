@@ -0,0 +1,100 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/url"
+
+	"github.com/giannimassi/shorturl/pkg/storage"
+)
+
+// provider decorates a storage.Provider with a span around every operation
+type provider struct {
+	storage.Forwarder
+	next storage.Provider
+}
+
+// InstrumentProvider returns a storage.Provider creating a span for every operation performed on p,
+// as a child of the span carried by the context of the operation, if any
+func InstrumentProvider(p storage.Provider) storage.Provider {
+	ip := &provider{next: p}
+	ip.Forwarder = storage.Forwarder{Next: p, Wrap: ip.wrap}
+	return ip
+}
+
+func (p *provider) start(ctx context.Context, method, key string) (context.Context, *Span) {
+	ctx, span := StartSpan(ctx, "storage."+method)
+	if key != "" {
+		span.SetAttributes("shorturl.key", key)
+	}
+	return ctx, span
+}
+
+// end records err in span, unless it is a storage error describing a normal outcome, and ends span
+func end(span *Span, err error) {
+	switch {
+	case err == nil:
+	case errors.Is(err, storage.ErrKeyNotFound), errors.Is(err, storage.ErrKeyAlreadyExists):
+		span.SetAttributes("shorturl.outcome", err.Error())
+	default:
+		span.SetError(err)
+	}
+	span.End()
+}
+
+func (p *provider) ShortURL(ctx context.Context, key string) (*url.URL, error) {
+	ctx, span := p.start(ctx, "ShortURL", key)
+	u, err := p.next.ShortURL(ctx, key)
+	end(span, err)
+	return u, err
+}
+
+func (p *provider) AddURL(ctx context.Context, key string, u url.URL, md storage.Metadata) error {
+	ctx, span := p.start(ctx, "AddURL", key)
+	err := p.next.AddURL(ctx, key, u, md)
+	end(span, err)
+	return err
+}
+
+func (p *provider) DeleteURL(ctx context.Context, key string) error {
+	ctx, span := p.start(ctx, "DeleteURL", key)
+	err := p.next.DeleteURL(ctx, key)
+	end(span, err)
+	return err
+}
+
+func (p *provider) ShortURLInfo(ctx context.Context, key string) (*url.URL, int, error) {
+	ctx, span := p.start(ctx, "ShortURLInfo", key)
+	u, hits, err := p.next.ShortURLInfo(ctx, key)
+	end(span, err)
+	return u, hits, err
+}
+
+func (p *provider) Metadata(ctx context.Context, key string) (storage.Metadata, error) {
+	ctx, span := p.start(ctx, "Metadata", key)
+	md, err := p.next.Metadata(ctx, key)
+	end(span, err)
+	return md, err
+}
+
+func (p *provider) SetMetadata(ctx context.Context, key string, md storage.Metadata) error {
+	ctx, span := p.start(ctx, "SetMetadata", key)
+	err := p.next.SetMetadata(ctx, key, md)
+	end(span, err)
+	return err
+}
+
+func (p *provider) Keys(ctx context.Context) ([]string, error) {
+	ctx, span := p.start(ctx, "Keys", "")
+	keys, err := p.next.Keys(ctx)
+	end(span, err)
+	return keys, err
+}
+
+// wrap creates a span around the optional operations forwarded by storage.Forwarder
+func (p *provider) wrap(ctx context.Context, method, key string, call func(ctx context.Context) error) error {
+	ctx, span := p.start(ctx, method, key)
+	err := call(ctx)
+	end(span, err)
+	return err
+}
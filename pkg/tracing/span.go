@@ -0,0 +1,153 @@
+// Package tracing implements a minimal distributed tracing API: spans are created by a Tracer,
+// propagated through context.Context and W3C traceparent headers, and sent to an Exporter once ended.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// TraceID identifies a trace
+type TraceID [16]byte
+
+// String returns the hex encoding of id
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+// IsValid returns true if id is not all zeroes
+func (id TraceID) IsValid() bool { return id != TraceID{} }
+
+// SpanID identifies a span within a trace
+type SpanID [8]byte
+
+// String returns the hex encoding of id
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+// IsValid returns true if id is not all zeroes
+func (id SpanID) IsValid() bool { return id != SpanID{} }
+
+// SpanContext identifies a span and is propagated across process boundaries
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid returns true if both the trace and span IDs are valid
+func (sc SpanContext) IsValid() bool { return sc.TraceID.IsValid() && sc.SpanID.IsValid() }
+
+// Attribute is a key-value pair describing a span
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// SpanData is the immutable snapshot of an ended span passed to exporters
+type SpanData struct {
+	Name         string
+	TraceID      TraceID
+	SpanID       SpanID
+	ParentSpanID SpanID
+	Start        time.Time
+	End          time.Time
+	Attributes   []Attribute
+	Error        string
+}
+
+// Span measures an operation. A nil *Span is valid and records nothing.
+type Span struct {
+	tracer *Tracer
+
+	m     sync.Mutex
+	data  SpanData
+	ended bool
+	sc    SpanContext
+}
+
+// SpanContext returns the context identifying s
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetAttributes adds attributes, passed as alternating keys and values, to s
+func (s *Span) SetAttributes(kv ...interface{}) {
+	if s == nil || !s.sc.Sampled {
+		return
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	for i := 0; i+1 < len(kv); i += 2 {
+		key, _ := kv[i].(string)
+		s.data.Attributes = append(s.data.Attributes, Attribute{Key: key, Value: kv[i+1]})
+	}
+}
+
+// SetError marks s as failed because of err. A nil err is ignored.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil || !s.sc.Sampled {
+		return
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.data.Error = err.Error()
+}
+
+// End completes s, exporting it if sampled. Calls after the first are ignored.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.m.Lock()
+	if s.ended {
+		s.m.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = s.tracer.now()
+	data := s.data
+	s.m.Unlock()
+
+	if s.sc.Sampled {
+		s.tracer.export(data)
+	}
+}
+
+type spanKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying s
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+// SpanFromContext returns the span carried by ctx, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// StartSpan starts a child of the span carried by ctx, using the same tracer.
+// If ctx carries no span a nil span is returned, which records nothing.
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	return parent.tracer.startSpan(ctx, name, parent.sc)
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	_, _ = rand.Read(id[:])
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	_, _ = rand.Read(id[:])
+	return id
+}
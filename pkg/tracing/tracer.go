@@ -0,0 +1,57 @@
+package tracing
+
+import (
+	"context"
+	"time"
+)
+
+// Exporter sends ended spans to a tracing backend
+type Exporter interface {
+	ExportSpan(s SpanData) error
+}
+
+// Tracer creates spans and exports them once ended
+type Tracer struct {
+	exporter Exporter
+	onError  func(error)
+	now      func() time.Time
+}
+
+// NewTracer returns a Tracer exporting spans with exporter. Export errors are passed to onError, if not nil.
+func NewTracer(exporter Exporter, onError func(error)) *Tracer {
+	return &Tracer{exporter: exporter, onError: onError, now: time.Now}
+}
+
+// Start starts a span named name. The span is a child of the span carried by ctx if any,
+// otherwise of remote if valid, otherwise it starts a new trace.
+func (t *Tracer) Start(ctx context.Context, name string, remote SpanContext) (context.Context, *Span) {
+	if parent := SpanFromContext(ctx); parent != nil {
+		remote = parent.sc
+	}
+	return t.startSpan(ctx, name, remote)
+}
+
+func (t *Tracer) startSpan(ctx context.Context, name string, parent SpanContext) (context.Context, *Span) {
+	sc := SpanContext{TraceID: parent.TraceID, SpanID: newSpanID(), Sampled: parent.Sampled}
+	if !parent.IsValid() {
+		sc.TraceID, sc.Sampled = newTraceID(), true
+	}
+	s := &Span{
+		tracer: t,
+		sc:     sc,
+		data: SpanData{
+			Name:         name,
+			TraceID:      sc.TraceID,
+			SpanID:       sc.SpanID,
+			ParentSpanID: parent.SpanID,
+			Start:        t.now(),
+		},
+	}
+	return ContextWithSpan(ctx, s), s
+}
+
+func (t *Tracer) export(s SpanData) {
+	if err := t.exporter.ExportSpan(s); err != nil && t.onError != nil {
+		t.onError(err)
+	}
+}
@@ -0,0 +1,205 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/giannimassi/shorturl/pkg/storage"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+
+		expectedOK      bool
+		expectedSampled bool
+	}{
+		{name: "ok/sampled", header: traceparent, expectedOK: true, expectedSampled: true},
+		{name: "ok/not-sampled", header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", expectedOK: true},
+		{name: "ok/future-version", header: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", expectedOK: true, expectedSampled: true},
+		{name: "ko/empty"},
+		{name: "ko/invalid-version", header: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{name: "ko/zero-trace-id", header: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{name: "ko/uppercase", header: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"},
+		{name: "ko/short-span-id", header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902-01"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			h.Set(TraceparentHeader, tt.header)
+			sc, ok := Extract(h)
+			if ok != tt.expectedOK || sc.Sampled != tt.expectedSampled {
+				t.Fatalf("unexpected span context: %+v (%v)", sc, ok)
+			}
+			if !ok {
+				return
+			}
+
+			tracer := NewTracer(&Recorder{}, nil)
+			_, span := tracer.Start(context.Background(), "test", sc)
+			if got := span.SpanContext(); got.TraceID != sc.TraceID || got.SpanID == sc.SpanID || got.Sampled != sc.Sampled {
+				t.Errorf("span should continue the extracted trace: %+v", got)
+			}
+		})
+	}
+}
+
+func TestTracer(t *testing.T) {
+	rec := &Recorder{}
+	tracer := NewTracer(rec, nil)
+
+	if _, span := StartSpan(context.Background(), "orphan"); span != nil {
+		t.Errorf("expected nil span without a parent")
+	}
+
+	ctx, root := tracer.Start(context.Background(), "root", SpanContext{})
+	_, child := StartSpan(ctx, "child")
+	child.SetAttributes("key", "a")
+	child.SetError(errors.New("boom"))
+	child.End()
+	child.End()
+	root.End()
+
+	spans := rec.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("unexpected number of spans: %d", len(spans))
+	}
+	if spans[0].Name != "child" || spans[0].TraceID != spans[1].TraceID || spans[0].ParentSpanID != spans[1].SpanID {
+		t.Errorf("unexpected span hierarchy: %+v", spans)
+	}
+	if spans[1].ParentSpanID.IsValid() {
+		t.Errorf("root span should have no parent")
+	}
+	if spans[0].Error != "boom" || len(spans[0].Attributes) != 1 || spans[0].Attributes[0].Value != "a" {
+		t.Errorf("unexpected child span: %+v", spans[0])
+	}
+
+	notSampled := SpanContext{TraceID: spans[0].TraceID, SpanID: spans[0].SpanID}
+	_, span := tracer.Start(context.Background(), "not-sampled", notSampled)
+	span.End()
+	if len(rec.Spans()) != 2 {
+		t.Errorf("spans of unsampled traces should not be exported")
+	}
+}
+
+func TestWriterExporter(t *testing.T) {
+	buf := bytes.Buffer{}
+	tracer := NewTracer(NewWriterExporter(&buf), nil)
+	_, span := tracer.Start(context.Background(), "op", SpanContext{})
+	span.SetAttributes("status", 200)
+	span.End()
+
+	var js jsonSpan
+	if err := json.Unmarshal(buf.Bytes(), &js); err != nil {
+		t.Fatalf("invalid output %q: %v", buf.String(), err)
+	}
+	if js.Name != "op" || js.TraceID != span.SpanContext().TraceID.String() || js.Attributes["status"] != 200.0 {
+		t.Errorf("unexpected span: %+v", js)
+	}
+}
+
+func TestHTTPExporter(t *testing.T) {
+	var (
+		m        sync.Mutex
+		requests []otlpRequest
+	)
+	received := make(chan struct{}, 10)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req otlpRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		m.Lock()
+		requests = append(requests, req)
+		m.Unlock()
+		received <- struct{}{}
+	}))
+	defer collector.Close()
+
+	var exportErrs []error
+	e := NewHTTPExporter(collector.URL+"/v1/traces", "shorturl", 2)
+	tracer := NewTracer(e, func(err error) { exportErrs = append(exportErrs, err) })
+	end := func(names ...string) {
+		for _, name := range names {
+			_, span := tracer.Start(context.Background(), name, SpanContext{})
+			span.End()
+		}
+	}
+
+	// full batches are sent in the background by Run, the rest when it stops
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.Run(ctx, time.Hour, func(err error) { t.Errorf("unexpected send error: %v", err) })
+		close(done)
+	}()
+	end("a", "b", "c")
+	<-received
+	cancel()
+	<-done
+	m.Lock()
+	defer m.Unlock()
+	if len(requests) != 2 || len(exportErrs) != 0 {
+		t.Fatalf("unexpected requests: %d (errors: %v)", len(requests), exportErrs)
+	}
+	rs := requests[0].ResourceSpans[0]
+	if rs.Resource.Attributes[0].Value.StringValue != "shorturl" || len(rs.ScopeSpans[0].Spans) != 2 || rs.ScopeSpans[0].Spans[1].Name != "b" {
+		t.Errorf("unexpected request: %+v", requests[0])
+	}
+	if spans := requests[1].ResourceSpans[0].ScopeSpans[0].Spans; len(spans) != 1 || spans[0].Name != "c" {
+		t.Errorf("unexpected flushed spans: %+v", spans)
+	}
+
+	// batches are dropped instead of blocking once the queue is full
+	for i := 0; i < maxQueuedBatches+1; i++ {
+		end("d", "e")
+	}
+	if len(exportErrs) != 1 {
+		t.Errorf("expected a dropped batch, got %v", exportErrs)
+	}
+	collector.Close()
+	if err := e.Flush(); err == nil {
+		t.Error("expected send error")
+	}
+}
+
+func TestInstrumentProvider(t *testing.T) {
+	p := InstrumentProvider(storage.NewMemoryStore())
+	u, _ := url.Parse("https://example.org")
+	if err := p.AddURL(context.Background(), "a", *u, storage.Metadata{}); err != nil {
+		t.Fatalf("operation without span should succeed: %v", err)
+	}
+
+	rec := &Recorder{}
+	ctx, root := NewTracer(rec, nil).Start(context.Background(), "request", SpanContext{})
+	if err := p.AddURL(ctx, "b", *u, storage.Metadata{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.ShortURL(ctx, "c"); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	root.End()
+
+	spans := rec.Spans()
+	if len(spans) != 3 {
+		t.Fatalf("unexpected number of spans: %d", len(spans))
+	}
+	for _, s := range spans[:2] {
+		if !strings.HasPrefix(s.Name, "storage.") || s.ParentSpanID != root.SpanContext().SpanID || s.Error != "" {
+			t.Errorf("unexpected storage span: %+v", s)
+		}
+	}
+}
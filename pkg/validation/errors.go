@@ -0,0 +1,48 @@
+package validation
+
+import "fmt"
+
+// Error codes returned in Error.Code
+const (
+	// CodeEmpty is used when a required value is empty
+	CodeEmpty = "empty"
+	// CodeMalformed is used when a value cannot be parsed
+	CodeMalformed = "malformed"
+	// CodeTooLong is used when a value exceeds the maximum allowed length
+	CodeTooLong = "too_long"
+	// CodeTooShort is used when a value is shorter than the minimum allowed length
+	CodeTooShort = "too_short"
+	// CodeInvalidChars is used when a value contains characters that are not allowed
+	CodeInvalidChars = "invalid_chars"
+	// CodeReserved is used when a value is reserved for internal use
+	CodeReserved = "reserved"
+	// CodeNotAbsolute is used when a url is missing its scheme or host
+	CodeNotAbsolute = "not_absolute"
+	// CodeSchemeNotAllowed is used when the url scheme is not allowed by the policy
+	CodeSchemeNotAllowed = "scheme_not_allowed"
+	// CodeHostNotAllowed is used when the url host is not in the allow-list of the policy
+	CodeHostNotAllowed = "host_not_allowed"
+	// CodeHostDenied is used when the url host is in the deny-list of the policy
+	CodeHostDenied = "host_denied"
+	// CodeInvalidHost is used when the url host cannot be normalized
+	CodeInvalidHost = "invalid_host"
+	// CodeBlocked is used when a url has been rejected by screening
+	CodeBlocked = "blocked"
+	// CodeSelfReference is used when the url points back to the service itself
+	CodeSelfReference = "self_reference"
+)
+
+// Error describes why a value failed validation
+type Error struct {
+	Field   string // Name of the offending field
+	Code    string // Stable machine-readable error code
+	Message string // Human-readable description
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+func newError(field, code, format string, args ...interface{}) *Error {
+	return &Error{Field: field, Code: code, Message: fmt.Sprintf(format, args...)}
+}
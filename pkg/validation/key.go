@@ -0,0 +1,79 @@
+package validation
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// KeyField is the name of the field reported in key validation errors
+const KeyField = "Key"
+
+// DefaultKeyCharset is the set of characters allowed in keys by DefaultKeyPolicy
+const DefaultKeyCharset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_"
+
+// Default length bounds used by DefaultKeyPolicy
+const (
+	DefaultMinKeyLength = 1
+	DefaultMaxKeyLength = 64
+)
+
+// KeyPolicy defines the rules a short key must satisfy in order to be stored and looked up
+type KeyPolicy struct {
+	Charset         string   // Characters allowed in a key, DefaultKeyCharset if empty
+	MinLength       int      // Minimum length of a key
+	MaxLength       int      // Maximum length of a key, no limit if zero
+	Reserved        []string // Keys that cannot be created, compared case-insensitively
+	CaseInsensitive bool     // If true keys are lowercased before being stored or looked up
+}
+
+// DefaultKeyPolicy returns a case-sensitive policy accepting keys made of DefaultKeyCharset
+// with a length between DefaultMinKeyLength and DefaultMaxKeyLength
+func DefaultKeyPolicy() KeyPolicy {
+	return KeyPolicy{
+		Charset:   DefaultKeyCharset,
+		MinLength: DefaultMinKeyLength,
+		MaxLength: DefaultMaxKeyLength,
+	}
+}
+
+// ParseKey normalizes key and checks its syntax. It must be used whenever a key is looked up,
+// so that lookups and creations agree on the same normalized form.
+func (p KeyPolicy) ParseKey(key string) (string, error) {
+	if p.CaseInsensitive {
+		key = strings.ToLower(key)
+	}
+	if key == "" {
+		return "", newError(KeyField, CodeEmpty, "key is empty")
+	}
+
+	length := utf8.RuneCountInString(key)
+	if length < p.MinLength {
+		return "", newError(KeyField, CodeTooShort, "key is shorter than %d characters", p.MinLength)
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		return "", newError(KeyField, CodeTooLong, "key is longer than %d characters", p.MaxLength)
+	}
+
+	charset := p.Charset
+	if charset == "" {
+		charset = DefaultKeyCharset
+	}
+	for _, r := range key {
+		if !strings.ContainsRune(charset, r) {
+			return "", newError(KeyField, CodeInvalidChars, "character %q is not allowed in keys", r)
+		}
+	}
+	return key, nil
+}
+
+// ValidateKey normalizes key and checks that it can be used for a new association
+func (p KeyPolicy) ValidateKey(key string) (string, error) {
+	key, err := p.ParseKey(key)
+	if err != nil {
+		return "", err
+	}
+	if containsFold(p.Reserved, key) {
+		return "", newError(KeyField, CodeReserved, "key %q is reserved", key)
+	}
+	return key, nil
+}
@@ -0,0 +1,105 @@
+package validation
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestKeyPolicy_ValidateKey(t *testing.T) {
+	reserved := []string{"api", "swagger"}
+	tests := []struct {
+		name   string
+		policy KeyPolicy
+		key    string
+
+		expected        string
+		expectedErrCode string
+	}{
+		{
+			name:     "ok/plain",
+			policy:   DefaultKeyPolicy(),
+			key:      "Abc-12_z",
+			expected: "Abc-12_z",
+		},
+		{
+			name:     "ok/case-insensitive",
+			policy:   KeyPolicy{CaseInsensitive: true},
+			key:      "AbC",
+			expected: "abc",
+		},
+		{
+			name:     "ok/custom-charset",
+			policy:   KeyPolicy{Charset: "ab."},
+			key:      "a.b",
+			expected: "a.b",
+		},
+		{
+			name:            "ko/empty",
+			policy:          DefaultKeyPolicy(),
+			expectedErrCode: CodeEmpty,
+		},
+		{
+			name:            "ko/too-short",
+			policy:          KeyPolicy{MinLength: 4},
+			key:             "abc",
+			expectedErrCode: CodeTooShort,
+		},
+		{
+			name:            "ko/too-long",
+			policy:          DefaultKeyPolicy(),
+			key:             strings.Repeat("a", DefaultMaxKeyLength+1),
+			expectedErrCode: CodeTooLong,
+		},
+		{
+			name:            "ko/slash",
+			policy:          DefaultKeyPolicy(),
+			key:             "swagger/index.html",
+			expectedErrCode: CodeInvalidChars,
+		},
+		{
+			name:            "ko/unicode",
+			policy:          DefaultKeyPolicy(),
+			key:             "caffè",
+			expectedErrCode: CodeInvalidChars,
+		},
+		{
+			name:            "ko/reserved",
+			policy:          KeyPolicy{Reserved: reserved},
+			key:             "Swagger",
+			expectedErrCode: CodeReserved,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := tt.policy.ValidateKey(tt.key)
+			if tt.expectedErrCode != "" {
+				var vErr *Error
+				if !errors.As(err, &vErr) {
+					t.Fatalf("expected validation error, got %v", err)
+				}
+				if vErr.Code != tt.expectedErrCode || vErr.Field != KeyField {
+					t.Errorf("unexpected error: got %s (%s), want %s", vErr.Code, vErr.Field, tt.expectedErrCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if key != tt.expected {
+				t.Errorf("unexpected key: got %s, want %s", key, tt.expected)
+			}
+		})
+	}
+}
+
+func TestKeyPolicy_ParseKey_reservedAllowed(t *testing.T) {
+	p := KeyPolicy{Reserved: []string{"api"}, CaseInsensitive: true}
+	key, err := p.ParseKey("API")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if key != "api" {
+		t.Errorf("unexpected key: got %s, want api", key)
+	}
+}
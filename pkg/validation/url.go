@@ -0,0 +1,127 @@
+package validation
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// URLField is the name of the field reported in url validation errors
+const URLField = "URL"
+
+// DefaultMaxURLLength is the maximum url length used by DefaultURLPolicy
+const DefaultMaxURLLength = 2048
+
+// URLPolicy defines the rules a destination url must satisfy in order to be stored.
+// Host lists match the host itself and all of its subdomains.
+type URLPolicy struct {
+	AllowedSchemes []string // Schemes accepted, all schemes are accepted if empty
+	AllowedHosts   []string // Hosts accepted, all hosts are accepted if empty
+	DeniedHosts    []string // Hosts rejected, checked before AllowedHosts
+	SelfHosts      []string // Hosts served by this service, rejected to avoid redirect loops
+	MaxLength      int      // Maximum length of the url, no limit if zero
+}
+
+// DefaultURLPolicy returns a policy accepting absolute http and https urls up to DefaultMaxURLLength
+func DefaultURLPolicy() URLPolicy {
+	return URLPolicy{
+		AllowedSchemes: []string{"http", "https"},
+		MaxLength:      DefaultMaxURLLength,
+	}
+}
+
+// NormalizeURL parses and validates raw according to the policy, returning the normalized url.
+// Scheme and host are lowercased, internationalized hosts are converted to punycode and
+// default ports are removed. Failures are reported as *Error.
+func (p URLPolicy) NormalizeURL(raw string) (*url.URL, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, newError(URLField, CodeEmpty, "url is empty")
+	}
+	if p.MaxLength > 0 && len(raw) > p.MaxLength {
+		return nil, newError(URLField, CodeTooLong, "url is longer than %d characters", p.MaxLength)
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, newError(URLField, CodeMalformed, "url cannot be parsed")
+	}
+	if !u.IsAbs() || u.Opaque != "" || u.Host == "" {
+		return nil, newError(URLField, CodeNotAbsolute, "url must be absolute and include a host")
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	if len(p.AllowedSchemes) > 0 && !containsFold(p.AllowedSchemes, u.Scheme) {
+		return nil, newError(URLField, CodeSchemeNotAllowed, "scheme %q is not allowed", u.Scheme)
+	}
+
+	host, err := normalizeHost(u.Hostname())
+	if err != nil {
+		return nil, newError(URLField, CodeInvalidHost, "host %q is not valid", u.Hostname())
+	}
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	u.Host = joinHostPort(host, port)
+
+	if p.MaxLength > 0 && len(u.String()) > p.MaxLength {
+		return nil, newError(URLField, CodeTooLong, "url is longer than %d characters", p.MaxLength)
+	}
+	if matchesHost(p.SelfHosts, host) {
+		return nil, newError(URLField, CodeSelfReference, "url cannot point to the shortening service itself")
+	}
+	if matchesHost(p.DeniedHosts, host) {
+		return nil, newError(URLField, CodeHostDenied, "host %q is not allowed", host)
+	}
+	if len(p.AllowedHosts) > 0 && !matchesHost(p.AllowedHosts, host) {
+		return nil, newError(URLField, CodeHostNotAllowed, "host %q is not allowed", host)
+	}
+	return u, nil
+}
+
+// normalizeHost lowercases host and converts it to its ASCII (punycode) form
+func normalizeHost(host string) (string, error) {
+	if host == "" {
+		return "", newError(URLField, CodeInvalidHost, "host is empty")
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String(), nil
+	}
+	return idna.Lookup.ToASCII(strings.TrimSuffix(host, "."))
+}
+
+func joinHostPort(host, port string) string {
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port == "" {
+		return host
+	}
+	return host + ":" + port
+}
+
+// matchesHost returns true if host is equal to or a subdomain of any of the hosts in list
+func matchesHost(list []string, host string) bool {
+	for _, h := range list {
+		h, err := normalizeHost(strings.TrimPrefix(h, "."))
+		if err != nil {
+			continue
+		}
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
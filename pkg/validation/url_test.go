@@ -0,0 +1,130 @@
+package validation
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestURLPolicy_NormalizeURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy URLPolicy
+		raw    string
+
+		expected        string
+		expectedErrCode string
+	}{
+		{
+			name:     "ok/plain",
+			policy:   DefaultURLPolicy(),
+			raw:      "https://example.org/a?b=c",
+			expected: "https://example.org/a?b=c",
+		},
+		{
+			name:     "ok/case-and-default-port",
+			policy:   DefaultURLPolicy(),
+			raw:      " HTTP://Example.ORG:80/A ",
+			expected: "http://example.org/A",
+		},
+		{
+			name:     "ok/idn",
+			policy:   DefaultURLPolicy(),
+			raw:      "https://bücher.example:8443/",
+			expected: "https://xn--bcher-kva.example:8443/",
+		},
+		{
+			name:     "ok/ipv6",
+			policy:   DefaultURLPolicy(),
+			raw:      "https://[::1]:443/",
+			expected: "https://[::1]/",
+		},
+		{
+			name:     "ok/allowed-subdomain",
+			policy:   URLPolicy{AllowedHosts: []string{"example.org"}},
+			raw:      "https://www.example.org",
+			expected: "https://www.example.org",
+		},
+		{
+			name:            "ko/empty",
+			policy:          DefaultURLPolicy(),
+			raw:             "",
+			expectedErrCode: CodeEmpty,
+		},
+		{
+			name:            "ko/malformed",
+			policy:          DefaultURLPolicy(),
+			raw:             "http://a b.com/%zz",
+			expectedErrCode: CodeMalformed,
+		},
+		{
+			name:            "ko/relative",
+			policy:          DefaultURLPolicy(),
+			raw:             "a/b",
+			expectedErrCode: CodeNotAbsolute,
+		},
+		{
+			name:            "ko/javascript",
+			policy:          DefaultURLPolicy(),
+			raw:             "javascript:alert(1)",
+			expectedErrCode: CodeNotAbsolute,
+		},
+		{
+			name:            "ko/file",
+			policy:          DefaultURLPolicy(),
+			raw:             "file:///etc/passwd",
+			expectedErrCode: CodeNotAbsolute,
+		},
+		{
+			name:            "ko/ftp",
+			policy:          DefaultURLPolicy(),
+			raw:             "ftp://example.org/file",
+			expectedErrCode: CodeSchemeNotAllowed,
+		},
+		{
+			name:            "ko/too-long",
+			policy:          URLPolicy{MaxLength: 20},
+			raw:             "https://example.org/" + strings.Repeat("a", 20),
+			expectedErrCode: CodeTooLong,
+		},
+		{
+			name:            "ko/denied",
+			policy:          URLPolicy{DeniedHosts: []string{"evil.com"}},
+			raw:             "https://login.EVIL.com/",
+			expectedErrCode: CodeHostDenied,
+		},
+		{
+			name:            "ko/not-allowed",
+			policy:          URLPolicy{AllowedHosts: []string{"example.org"}},
+			raw:             "https://notexample.org/",
+			expectedErrCode: CodeHostNotAllowed,
+		},
+		{
+			name:            "ko/self-reference",
+			policy:          URLPolicy{SelfHosts: []string{"short.url"}},
+			raw:             "https://Short.URL./abc",
+			expectedErrCode: CodeSelfReference,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := tt.policy.NormalizeURL(tt.raw)
+			if tt.expectedErrCode != "" {
+				var vErr *Error
+				if !errors.As(err, &vErr) {
+					t.Fatalf("expected validation error, got %v", err)
+				}
+				if vErr.Code != tt.expectedErrCode || vErr.Field != URLField {
+					t.Errorf("unexpected error: got %s (%s), want %s", vErr.Code, vErr.Field, tt.expectedErrCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if u.String() != tt.expected {
+				t.Errorf("unexpected url: got %s, want %s", u.String(), tt.expected)
+			}
+		})
+	}
+}